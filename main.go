@@ -1,19 +1,66 @@
 package main
 
 import (
+	"context"
+	"net"
+	"net/smtp"
+	"os"
+
 	"github.com/justinthompson/appointment/pkg/appointment"
 	"github.com/justinthompson/appointment/pkg/handlers"
+	"github.com/justinthompson/appointment/pkg/notification"
+	"github.com/justinthompson/appointment/pkg/reminder"
+	"github.com/justinthompson/appointment/pkg/webhook"
 	"github.com/labstack/echo/v4"
 )
 
 func main() {
 	e := echo.New()
 
-	appManager, err := appointment.NewAppointmentManager()
+	tenants, err := appointment.NewTenants()
 	if err != nil {
-		e.Logger.Fatal(e.Start(":8000"))
+		e.Logger.Fatal(err)
+	}
+
+	// Events saved in the outboxes before a restart are sent once the dispatcher starts
+	go webhook.NewDispatcher(tenants).Run(context.Background())
+
+	offsets := reminder.DefaultOffsets
+	if s := os.Getenv("REMINDER_OFFSETS"); s != "" {
+		if offsets, err = reminder.ParseOffsets(s); err != nil {
+			e.Logger.Fatal(err)
+		}
+	}
+	notifier := newNotifier()
+	if err := notification.NewConfirmer(tenants, notifier).Start(); err != nil {
+		e.Logger.Fatal(err)
 	}
+	scheduler := reminder.NewScheduler(tenants, notifier, offsets)
+	go func() {
+		if err := scheduler.Run(context.Background()); err != nil {
+			e.Logger.Error(err)
+		}
+	}()
 
-	handlers.BuildRouter(e, appManager)
+	handlers.BuildRouter(e, tenants, handlers.Config{
+		CalendarSecret: []byte(os.Getenv("CALENDAR_SECRET")),
+		// Only for development, tenants without api keys are open to anyone
+		AllowAnonymous: os.Getenv("ALLOW_ANONYMOUS") == "true",
+	})
 	e.Logger.Fatal(e.Start(":8000"))
 }
+
+// newNotifier emails notifications when SMTP_ADDR is set, otherwise they are only logged
+func newNotifier() notification.Notifier {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		return notification.LogNotifier{}
+	}
+
+	n := notification.SMTPNotifier{Addr: addr, From: os.Getenv("SMTP_FROM")}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		n.Auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return n
+}
@@ -0,0 +1,110 @@
+package appointment
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Roles an API key can have
+const (
+	// RoleAdmin can do anything in the tenant
+	RoleAdmin Role = "admin"
+	// RoleTrainer can only see and change their own schedule
+	RoleTrainer Role = "trainer"
+	// RoleClient can only book, see and cancel their own appointments
+	RoleClient Role = "client"
+)
+
+type (
+	// Role is what an API key is allowed to do
+	Role string
+
+	// APIKey is a key that can call the API, only the SHA-256 hash of the key is kept so api_keys.json doesn't hold the keys themselves
+	APIKey struct {
+		// ID names the key so it can be told apart in logs, it isn't secret
+		ID   string `json:"id"`
+		Hash string `json:"hash"`
+		Role Role   `json:"role"`
+		// TrainerID is the trainer a trainer key belongs to
+		TrainerID int `json:"trainer_id,omitempty"`
+		// UserID is the client a client key belongs to
+		UserID int `json:"user_id,omitempty"`
+	}
+)
+
+// HashAPIKey returns the hash of the key as it is written in api_keys.json
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// init checks a key read from a file has a valid hash and the ID its role needs
+func (k *APIKey) init() error {
+	if k.ID == "" {
+		return fmt.Errorf("api key is missing an id")
+	}
+	k.Hash = strings.ToLower(k.Hash)
+	if b, err := hex.DecodeString(k.Hash); err != nil || len(b) != sha256.Size {
+		return fmt.Errorf("api key %s must have the hex SHA-256 hash of the key", k.ID)
+	}
+
+	switch k.Role {
+	case RoleAdmin:
+	case RoleTrainer:
+		if k.TrainerID == 0 {
+			return fmt.Errorf("trainer api key %s is missing a trainer_id", k.ID)
+		}
+	case RoleClient:
+		if k.UserID == 0 {
+			return fmt.Errorf("client api key %s is missing a user_id", k.ID)
+		}
+	default:
+		return fmt.Errorf("api key %s has unknown role %q", k.ID, k.Role)
+	}
+	return nil
+}
+
+// Allows reports whether the key can see and change the appointment, trainers only have their own and clients theirs
+func (k APIKey) Allows(app Appointment) bool {
+	switch k.Role {
+	case RoleAdmin:
+		return true
+	case RoleTrainer:
+		return app.TrainerID == k.TrainerID
+	case RoleClient:
+		return app.UserID == k.UserID
+	}
+	return false
+}
+
+// Scope narrows the query to the appointments the key can see.
+// It reports false when the query asks for another trainer's or client's appointments.
+func (k APIKey) Scope(query ScheduleQuery) (ScheduleQuery, bool) {
+	switch k.Role {
+	case RoleAdmin:
+		return query, true
+	case RoleTrainer:
+		if query.TrainerID != 0 && query.TrainerID != k.TrainerID {
+			return query, false
+		}
+		query.TrainerID = k.TrainerID
+		return query, true
+	case RoleClient:
+		if query.UserID != 0 && query.UserID != k.UserID {
+			return query, false
+		}
+		query.UserID = k.UserID
+		return query, true
+	}
+	return query, false
+}
+
+// GetAPIKeys returns the tenant's keys from api_keys.json
+func (a *scheduledAppointments) GetAPIKeys() ([]APIKey, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	return append([]APIKey(nil), a.apiKeys...), nil
+}
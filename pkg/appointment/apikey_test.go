@@ -0,0 +1,94 @@
+package appointment
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeys(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "tenants.json"), `[{"id": "acme", "api_keys": ["acme-key"]}, {"id": "globex"}, {"id": "initech", "api_keys": ["initech-key"]}]`)
+	writeFile(t, filepath.Join(dir, "tenants", "acme", "appointments.json"), `[]`)
+	writeFile(t, filepath.Join(dir, "tenants", "globex", "appointments.json"), `[]`)
+	writeFile(t, filepath.Join(dir, "tenants", "initech", "appointments.json"), `[]`)
+	writeFile(t, filepath.Join(dir, "tenants", "acme", "api_keys.json"), `[
+		{"id": "coach", "hash": "`+strings.ToUpper(HashAPIKey("coach-key"))+`", "role": "trainer", "trainer_id": 1},
+		{"id": "sam", "hash": "`+HashAPIKey("sam-key")+`", "role": "client", "user_id": 5}
+	]`)
+
+	tenants, err := newTenants(dir)
+	require.NoError(t, err)
+	assert.True(t, tenants.HasAPIKeys("acme"))
+	assert.False(t, tenants.HasAPIKeys("globex"))
+	// Keys in tenants.json are keys for the tenant without an api_keys.json
+	assert.True(t, tenants.HasAPIKeys("initech"))
+
+	tenantID, key, ok := tenants.Authenticate("coach-key")
+	require.True(t, ok)
+	assert.Equal(t, "acme", tenantID)
+	assert.Equal(t, APIKey{ID: "coach", Hash: HashAPIKey("coach-key"), Role: RoleTrainer, TrainerID: 1}, key)
+
+	// Keys in tenants.json are admin keys
+	tenantID, key, ok = tenants.Authenticate("acme-key")
+	require.True(t, ok)
+	assert.Equal(t, "acme", tenantID)
+	assert.Equal(t, RoleAdmin, key.Role)
+
+	// The hash is not a key
+	_, _, ok = tenants.Authenticate(HashAPIKey("sam-key"))
+	assert.False(t, ok)
+
+	t.Run("invalid keys stop the server starting", func(t *testing.T) {
+		for keys, want := range map[string]string{
+			`[{"id": "a", "hash": "abc", "role": "admin"}]`:                                                                                      "api key a must have the hex SHA-256 hash of the key",
+			`[{"id": "a", "hash": "` + HashAPIKey("a") + `", "role": "owner"}]`:                                                                  `api key a has unknown role "owner"`,
+			`[{"id": "a", "hash": "` + HashAPIKey("a") + `", "role": "trainer"}]`:                                                                "trainer api key a is missing a trainer_id",
+			`[{"id": "a", "hash": "` + HashAPIKey("a") + `", "role": "client"}]`:                                                                 "client api key a is missing a user_id",
+			`[{"hash": "` + HashAPIKey("a") + `", "role": "admin"}]`:                                                                             "api key is missing an id",
+			`[{"id": "a", "hash": "` + HashAPIKey("a") + `", "role": "admin"}, {"id": "a", "hash": "` + HashAPIKey("b") + `", "role": "admin"}]`: "api key a is defined more than once",
+		} {
+			writeFile(t, filepath.Join(dir, "tenants", "globex", "api_keys.json"), keys)
+			_, err := newTenants(dir)
+			assert.EqualError(t, err, "error loading tenant globex: "+want)
+		}
+	})
+
+	t.Run("tenants can't share a key", func(t *testing.T) {
+		writeFile(t, filepath.Join(dir, "tenants", "globex", "api_keys.json"), `[{"id": "b", "hash": "`+HashAPIKey("sam-key")+`", "role": "admin"}]`)
+		_, err := newTenants(dir)
+		assert.EqualError(t, err, "api key b of tenant globex has the same key as sam of tenant acme")
+	})
+}
+
+func TestAPIKey_Scope(t *testing.T) {
+	admin := APIKey{Role: RoleAdmin}
+	trainer := APIKey{Role: RoleTrainer, TrainerID: 1}
+	client := APIKey{Role: RoleClient, UserID: 5}
+	app := Appointment{TrainerID: 1, UserID: 6}
+
+	assert.True(t, admin.Allows(app))
+	assert.True(t, trainer.Allows(app))
+	assert.False(t, client.Allows(app))
+	assert.False(t, APIKey{}.Allows(app))
+
+	query, ok := admin.Scope(ScheduleQuery{LocationID: 2})
+	assert.True(t, ok)
+	assert.Equal(t, ScheduleQuery{LocationID: 2}, query)
+
+	// A trainer looking at a location only sees their own appointments there
+	query, ok = trainer.Scope(ScheduleQuery{LocationID: 2})
+	assert.True(t, ok)
+	assert.Equal(t, ScheduleQuery{TrainerID: 1, LocationID: 2}, query)
+	_, ok = trainer.Scope(ScheduleQuery{TrainerID: 2})
+	assert.False(t, ok)
+
+	query, ok = client.Scope(ScheduleQuery{TrainerID: 1})
+	assert.True(t, ok)
+	assert.Equal(t, ScheduleQuery{TrainerID: 1, UserID: 5}, query)
+	_, ok = client.Scope(ScheduleQuery{UserID: 6})
+	assert.False(t, ok)
+}
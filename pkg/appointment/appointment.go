@@ -2,120 +2,396 @@ package appointment
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sync"
 	"time"
 )
 
+// AppointmentDuration is how long every appointment lasts, the schedule is made of slots this long
+const AppointmentDuration = 30 * time.Minute
+
 type (
 	// Service handles operations on events
 	Manager interface {
 		// Track tracks and stores an event.
 		GetAvailableAppointments(appReq Appointment) ([]Appointment, error)
-		GetScheduledAppointments(trainerID int) ([]Appointment, error)
-		CreateAppointment(app Appointment) error
+		GetScheduledAppointments(appReq Appointment) ([]Appointment, error)
+		ListScheduledAppointments(query ScheduleQuery) (SchedulePage, error)
+		CreateAppointment(app Appointment) (Appointment, error)
+		CreateAppointments(apps []Appointment, atomic bool) ([]BatchResult, error)
+		CheckAppointments(apps []Appointment) ([]BatchResult, error)
+		TransitionAppointment(id int, action Action) (Appointment, error)
+		GetAppointment(id int) (Appointment, error)
+		UpdateAppointment(changes Appointment, version int) (Appointment, error)
+		DeleteAppointment(id int, version int) error
+		GetLocations() ([]Location, error)
+		GetBookingLocation(trainerID int, locationID int) (Location, error)
+		GetAttendanceRecord(userID int) (AttendanceRecord, error)
+		GetBusyBlocks(trainerID int) ([]BusyBlock, error)
+		ImportBusyBlocks(trainerID int, uids []string, blocks []BusyBlock) error
+		GetFreeBusy(trainerID int, from time.Time, to time.Time) ([]Interval, error)
+		CreateWebhook(webhook Webhook) (Webhook, error)
+		GetWebhooks() ([]Webhook, error)
+		DeleteWebhook(id int) error
+		DueDeliveries(now time.Time, limit int) ([]Delivery, error)
+		DeliveryDone(id int) error
+		DeliveryFailed(id int, reason string, retryAt time.Time) error
+		GetDeadLetters() ([]Delivery, error)
+		RetryDeadLetter(id int) error
+		EventsAfter(id int) (EventFeed, error)
+		GetUser(id int) (User, error)
+		GetUpcomingAppointments(from time.Time) ([]Appointment, error)
+		GetMessageTemplates() (MessageTemplates, error)
+		GetAPIKeys() ([]APIKey, error)
+		Subscribe(handler func(DomainEvent)) (unsubscribe func())
+		SubscribeAsync(handler func(DomainEvent), workers int) (unsubscribe func())
 	}
 
 	scheduledAppointments struct {
+		mu  sync.Mutex
+		now func() time.Time
+		// path is the appointments file changes are saved to, empty for managers that aren't saved
+		path             string
 		appointmentsList []Appointment
 		latestID         int
-		TrainerIDs       map[int]bool // using a map for unique values
+		trainers         map[int]Trainer // using a map for unique values
+		locations        map[int]Location
+		users            map[int]User
+		policies         Policies
+		messageTemplates MessageTemplates
+		apiKeys          []APIKey
+		// busyPath is the busy blocks file, saved like path
+		busyPath   string
+		busyBlocks []BusyBlock
+		// webhooksPath is the webhooks file, saved like path
+		webhooksPath    string
+		webhooks        []Webhook
+		latestWebhookID int
+		// The outbox has the deliveries of events that haven't been sent yet, it is saved with the appointments
+		latestEventID    int
+		latestDeliveryID int
+		outbox           []Delivery
+		deadLetters      []Delivery
+		// recent are the latest events for streams, changed is closed when one is added
+		recent  []Event
+		changed chan struct{}
+		// unpublished are the events of changes made under the lock, they are published when it is released
+		unpublished []DomainEvent
+		bus         EventBus
 	}
 
-	// the json names in the file are different to the request (started_at vs starts_at) since both are json they should be the same to make this easier
+	// Appointment is stored in appointments.json with the same names as the requests use, the handlers decide what clients see
 	Appointment struct {
-		ID        int       `json:"id,omitempty"`
-		StartTime time.Time `json:"started_at"`
-		EndTime   time.Time `json:"ended_at"`
-		UserID    int       `json:"user_id,omitempty"`
-		TrainerID int       `json:"trainer_id" validate:"required"`
+		ID         int       `json:"id,omitempty"`
+		StartTime  time.Time `json:"starts_at"`
+		EndTime    time.Time `json:"ends_at"`
+		UserID     int       `json:"user_id,omitempty"`
+		TrainerID  int       `json:"trainer_id" validate:"required"`
+		LocationID int       `json:"location_id,omitempty"`
+		// Status is confirmed for appointments that were stored before appointments had a status
+		Status        Status         `json:"status,omitempty"`
+		StatusHistory []StatusChange `json:"status_history,omitempty"`
+		// ExpiresAt is when a pending booking request releases its slot
+		ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+		SessionType string     `json:"session_type,omitempty"`
+		// LateCancellation is set when the appointment was cancelled inside its policy's free cancellation window
+		LateCancellation bool `json:"late_cancellation,omitempty"`
+		LateCancelFee    int  `json:"late_cancel_fee,omitempty"`
+		// Version goes up by one every time the appointment changes so a change based on an old copy can be refused
+		Version int `json:"version,omitempty"`
 	}
 )
 
-// GetAppointmentsFromFile reads a json file and returns a slice of appointments
+// NewAppointmentManager reads the appointment data files in the working directory
 func NewAppointmentManager() (Manager, error) {
-	// Open jsonFile
-	jsonFile, err := os.Open("appointments.json")
+	apps, err := newAppointmentManager(".")
 	if err != nil {
 		return nil, err
 	}
-	defer jsonFile.Close()
+	return apps, nil
+}
 
-	var apps scheduledAppointments
-	err = json.NewDecoder(jsonFile).Decode(&apps.appointmentsList)
+// newAppointmentManager reads the appointments, locations, trainers, users, policies, templates, api keys, busy blocks and webhooks json files in dir
+func newAppointmentManager(dir string) (*scheduledAppointments, error) {
+	apps := scheduledAppointments{
+		path:         filepath.Join(dir, "appointments.json"),
+		busyPath:     filepath.Join(dir, "busy_blocks.json"),
+		webhooksPath: filepath.Join(dir, "webhooks.json"),
+	}
+	file, migrated, err := loadAppointments(apps.path)
 	if err != nil {
-		return nil, fmt.Errorf("error decoding json: %w", err)
+		return nil, err
+	}
+	apps.appointmentsList, apps.latestID = file.Appointments, file.LatestID
+	apps.latestEventID, apps.latestDeliveryID = file.LatestEventID, file.LatestDeliveryID
+	apps.outbox, apps.deadLetters = file.Outbox, file.DeadLetters
+
+	// Locations and trainers are optional, any trainer without a location gets the default business hours
+	var locations []Location
+	if err := decodeJSONFile(filepath.Join(dir, "locations.json"), &locations); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	var trainers []Trainer
+	if err := decodeJSONFile(filepath.Join(dir, "trainers.json"), &trainers); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if err := decodeJSONFile(filepath.Join(dir, "policies.json"), &apps.policies); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	// Users are only needed to send notifications
+	var users []User
+	if err := decodeJSONFile(filepath.Join(dir, "users.json"), &users); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	apps.users = make(map[int]User, len(users))
+	for _, user := range users {
+		apps.users[user.ID] = user
+	}
+
+	// Without templates.json every notification uses the built in wording
+	if err := decodeJSONFile(filepath.Join(dir, "templates.json"), &apps.messageTemplates); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err := apps.messageTemplates.init(); err != nil {
+		return nil, err
+	}
+
+	// Without api_keys.json the tenant's API is open to anyone that can reach it
+	if err := decodeJSONFile(filepath.Join(dir, "api_keys.json"), &apps.apiKeys); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	keyIDs := make(map[string]bool, len(apps.apiKeys))
+	for i := range apps.apiKeys {
+		if err := apps.apiKeys[i].init(); err != nil {
+			return nil, err
+		}
+		if keyIDs[apps.apiKeys[i].ID] {
+			return nil, fmt.Errorf("api key %s is defined more than once", apps.apiKeys[i].ID)
+		}
+		keyIDs[apps.apiKeys[i].ID] = true
+	}
+
+	// The busy blocks file is written the first time a trainer imports their calendar
+	if err := decodeJSONFile(apps.busyPath, &apps.busyBlocks); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	// The webhooks file is written when the first webhook is added
+	var webhooks webhooksFile
+	if err := decodeJSONFile(apps.webhooksPath, &webhooks); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	apps.webhooks, apps.latestWebhookID = webhooks.Webhooks, webhooks.LatestID
+
+	apps.locations = make(map[int]Location)
+	for _, location := range locations {
+		if err := location.init(); err != nil {
+			return nil, err
+		}
+		apps.locations[location.ID] = location
 	}
 
-	apps.TrainerIDs = make(map[int]bool)
-	for _, app := range apps.appointmentsList {
+	apps.trainers = make(map[int]Trainer)
+	for _, trainer := range trainers {
+		if _, ok := apps.locations[trainer.LocationID]; trainer.LocationID != 0 && !ok {
+			return nil, fmt.Errorf("trainer %d belongs to unknown location %d", trainer.ID, trainer.LocationID)
+		}
+		apps.trainers[trainer.ID] = trainer
+	}
+
+	for i, app := range apps.appointmentsList {
 		if app.ID > apps.latestID {
 			apps.latestID = app.ID
 		}
-		apps.TrainerIDs[app.TrainerID] = true
+		if _, ok := apps.trainers[app.TrainerID]; !ok {
+			apps.trainers[app.TrainerID] = Trainer{ID: app.TrainerID}
+		}
+		if app.LocationID == 0 {
+			apps.appointmentsList[i].LocationID = apps.trainers[app.TrainerID].LocationID
+		}
+		if app.Status == "" {
+			apps.appointmentsList[i].Status = StatusConfirmed
+		}
+		if app.Version == 0 {
+			apps.appointmentsList[i].Version = 1
+		}
 	}
 
+	// Files in an older format are rewritten once so they don't need migrating every time
+	if migrated {
+		if err := apps.save(); err != nil {
+			return nil, err
+		}
+	}
 	return &apps, nil
 }
 
-// GetAvailableAppointments returns a slice of available appointments filtered by the provided start/end time and user ID
-func (a *scheduledAppointments) GetAvailableAppointments(request Appointment) ([]Appointment, error) {
-	if !isValidTrainerID(request.TrainerID, a.TrainerIDs) {
-		return nil, fmt.Errorf("trainer does not exist")
+// decodeJSONFile decodes the json file at path into v
+func decodeJSONFile(path string, v interface{}) error {
+	// Open jsonFile
+	jsonFile, err := os.Open(path)
+	if err != nil {
+		return err
 	}
+	defer jsonFile.Close()
 
-	if err := validateStartAndEndTime(request.StartTime, request.EndTime); err != nil {
-		return nil, err
+	if err := json.NewDecoder(jsonFile).Decode(v); err != nil {
+		return fmt.Errorf("error decoding %s: %w", path, err)
 	}
+	return nil
+}
+
+// GetAvailableAppointments returns a slice of available appointments filtered by the provided start/end time and trainer or location ID
+func (a *scheduledAppointments) GetAvailableAppointments(request Appointment) ([]Appointment, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	a.expirePendingRequests()
 
-	// Get relevant appointments
-	relevantAppointments, err := a.getRelevantAppointments(request)
+	trainers, err := a.trainersForRequest(request.TrainerID, request.LocationID)
 	if err != nil {
 		return nil, err
 	}
 
+	// Get relevant appointments for each trainer
+	relevantAppointments := make(map[int][]Appointment, len(trainers))
+	for _, trainer := range trainers {
+		if err := validateStartAndEndTime(request.StartTime, request.EndTime, a.trainerLocation(trainer)); err != nil {
+			return nil, err
+		}
+
+		relevantAppointments[trainer.ID], err = a.getRelevantAppointments(Appointment{
+			StartTime: request.StartTime,
+			EndTime:   request.EndTime,
+			TrainerID: trainer.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Create a slice of available appointments
 	var availableAppointments []Appointment
-	for t := request.StartTime; t.Before(request.EndTime); t = t.Add(30 * time.Minute) {
-		if a.isSlotAvailable(t, relevantAppointments) {
-			availableAppointments = append(availableAppointments, Appointment{
-				StartTime: t,
-				EndTime:   t.Add(30 * time.Minute),
-				TrainerID: request.TrainerID,
-			})
+	for t := request.StartTime; t.Before(request.EndTime); t = t.Add(AppointmentDuration) {
+		for _, trainer := range trainers {
+			if a.isSlotAvailable(t, relevantAppointments[trainer.ID]) && !a.isBusy(trainer.ID, t, t.Add(AppointmentDuration)) {
+				availableAppointments = append(availableAppointments, Appointment{
+					StartTime:  t,
+					EndTime:    t.Add(AppointmentDuration),
+					TrainerID:  trainer.ID,
+					LocationID: trainer.LocationID,
+				})
+			}
 		}
 	}
 
 	return availableAppointments, nil
 }
 
-func (a *scheduledAppointments) GetScheduledAppointments(trainerID int) ([]Appointment, error) {
-	if !isValidTrainerID(trainerID, a.TrainerIDs) {
-		fmt.Println("failed here")
-		return nil, fmt.Errorf("trainer %d does not exist", trainerID)
+// GetScheduledAppointments returns every appointment for the requested trainer, location or user
+func (a *scheduledAppointments) GetScheduledAppointments(request Appointment) ([]Appointment, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	a.expirePendingRequests()
+
+	page, err := a.listScheduledAppointments(ScheduleQuery{TrainerID: request.TrainerID, LocationID: request.LocationID, UserID: request.UserID, Limit: -1})
+	if err != nil {
+		return nil, err
 	}
+	return page.Appointments, nil
+}
 
-	var scheduledAppointments []Appointment
-	for _, app := range a.appointmentsList {
-		if app.TrainerID == trainerID {
-			scheduledAppointments = append(scheduledAppointments, app)
-		}
+// CreateAppointment books the appointment and returns it with its ID and status.
+// Appointments are confirmed unless they are requested as tentative.
+// Trainers that require approval get a pending request that holds the slot until they answer it or it expires.
+// Users over the no-show threshold can't book.
+func (a *scheduledAppointments) CreateAppointment(appointment Appointment) (Appointment, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	a.expirePendingRequests()
+
+	previous, latestID, mark := a.appointmentsList, a.latestID, a.markOutbox()
+	appointment, err := a.createAppointment(appointment)
+	if err != nil {
+		return Appointment{}, err
+	}
+	if err := a.save(); err != nil {
+		a.appointmentsList, a.latestID = previous, latestID
+		a.rollbackOutbox(mark)
+		return Appointment{}, err
 	}
-	return scheduledAppointments, nil
+	return appointment, nil
 }
 
-func (a *scheduledAppointments) CreateAppointment(appointment Appointment) error {
-	if !isValidTrainerID(appointment.TrainerID, a.TrainerIDs) {
-		return fmt.Errorf("trainer does not exist")
+// createAppointment books the appointment without saving, the caller holds the lock
+func (a *scheduledAppointments) createAppointment(appointment Appointment) (Appointment, error) {
+	trainer, ok := a.trainers[appointment.TrainerID]
+	if !ok {
+		return Appointment{}, newError(ErrTrainerNotFound, "trainer does not exist")
+	}
+
+	if appointment.LocationID != 0 && appointment.LocationID != trainer.LocationID {
+		return Appointment{}, newError(ErrValidation, "trainer %d does not belong to location %d", trainer.ID, appointment.LocationID)
+	}
+
+	if appointment.SessionType == "" {
+		appointment.SessionType = DefaultSessionType
+	}
+	if _, err := a.policies.cancellationPolicy(appointment.SessionType); err != nil {
+		return Appointment{}, err
+	}
+
+	if record := a.attendanceRecord(appointment.UserID); record.BookingBlocked {
+		return Appointment{}, newError(ErrBookingBlocked, "user %d is blocked from booking after too many no-shows", appointment.UserID)
+	}
+
+	if err := a.checkSlot(appointment, trainer); err != nil {
+		return Appointment{}, err
+	}
+
+	now := a.currentTime()
+	status := StatusConfirmed
+	appointment.ExpiresAt = nil
+	switch {
+	case trainer.RequiresApproval:
+		status = StatusPending
+		expiresAt := requestExpiry(now, appointment.StartTime)
+		appointment.ExpiresAt = &expiresAt
+	case appointment.Status == StatusTentative:
+		status = StatusTentative
 	}
 
-	if err := validateStartAndEndTime(appointment.StartTime, appointment.EndTime); err != nil {
+	a.latestID++
+	appointment.ID = a.latestID
+	appointment.LocationID = trainer.LocationID
+	appointment.Status = ""
+	appointment.StatusHistory = nil
+	appointment.LateCancellation = false
+	appointment.LateCancelFee = 0
+	appointment.Version = 0
+	appointment.setStatus(status, now)
+	a.appointmentsList = append(a.appointmentsList, appointment)
+	a.emit(EventCreated, Appointment{}, appointment, now)
+	return appointment, nil
+}
+
+// checkSlot checks that the appointment's times are a valid 30 minute slot at the trainer's location that no other appointment
+// or busy block holds
+func (a *scheduledAppointments) checkSlot(appointment Appointment, trainer Trainer) error {
+	if err := validateStartAndEndTime(appointment.StartTime, appointment.EndTime, a.trainerLocation(trainer)); err != nil {
 		return err
 	}
 
-	// Ensure the appointment duration is exactly 30 minutes
-	if appointment.EndTime.Sub(appointment.StartTime) != 30*time.Minute {
-		return fmt.Errorf("appointment duration must be exactly 30 minutes")
+	if appointment.EndTime.Sub(appointment.StartTime) != AppointmentDuration {
+		return newError(ErrValidation, "appointment duration must be exactly 30 minutes")
 	}
 
 	// Filter relevant appointments
@@ -124,23 +400,29 @@ func (a *scheduledAppointments) CreateAppointment(appointment Appointment) error
 		return err
 	}
 
-	// Check if there is any appointment overlapping this 30 min slot
+	// Check if there is any appointment overlapping this 30 min slot, an appointment being rescheduled doesn't conflict with itself
 	for _, existingAppointment := range relevantAppointments {
+		if appointment.ID != 0 && existingAppointment.ID == appointment.ID {
+			continue
+		}
 		if appointment.StartTime.Equal(existingAppointment.StartTime) {
-			return fmt.Errorf("appointment already exists at this time")
+			return newError(ErrSlotConflict, "appointment already exists at this time")
 		}
 	}
-
-	a.latestID++
-	appointment.ID = a.latestID
-	a.appointmentsList = append(a.appointmentsList, appointment)
+	if a.isBusy(trainer.ID, appointment.StartTime, appointment.EndTime) {
+		return newError(ErrSlotConflict, "trainer %d is busy at this time", trainer.ID)
+	}
 	return nil
 }
 
-// getRelevantAppointments returns a slice of appointments that are in the provided time range and belong to the provided trainer
+// getRelevantAppointments returns a slice of appointments that are in the provided time range, belong to the provided trainer
+// and are in a status that occupies the trainer's time
 func (a *scheduledAppointments) getRelevantAppointments(request Appointment) ([]Appointment, error) {
 	var relevantAppointments []Appointment
 	for _, scheduledApp := range a.appointmentsList {
+		if !scheduledApp.Status.blocksSlot() {
+			continue
+		}
 		if scheduledApp.TrainerID == request.TrainerID && scheduledApp.StartTime.Before(request.EndTime) && scheduledApp.EndTime.After(request.StartTime) {
 			relevantAppointments = append(relevantAppointments, scheduledApp)
 		}
@@ -149,6 +431,14 @@ func (a *scheduledAppointments) getRelevantAppointments(request Appointment) ([]
 	return relevantAppointments, nil
 }
 
+// currentTime returns the time used for status changes
+func (a *scheduledAppointments) currentTime() time.Time {
+	if a.now == nil {
+		return time.Now()
+	}
+	return a.now()
+}
+
 // isSlotAvailable checks if the slot is available
 func (a *scheduledAppointments) isSlotAvailable(slot time.Time, scheduledAppointments []Appointment) bool {
 	for _, scheduledApp := range scheduledAppointments {
@@ -160,27 +450,24 @@ func (a *scheduledAppointments) isSlotAvailable(slot time.Time, scheduledAppoint
 	return true
 }
 
-// isValidTrainerID checks if the trainer ID is valid
-func isValidTrainerID(trainerID int, trainersList map[int]bool) bool {
-	if _, ok := trainersList[trainerID]; !ok {
-		return false
-	}
-	return true
-}
-
-// validateStartAndEndTime checks that the start and end times are valid
-func validateStartAndEndTime(startTime time.Time, endTime time.Time) error {
-	// Normally I would handle all times in utc but since the json file is in pacific I am just treating everything like its pacific
+// validateStartAndEndTime checks that the start and end times are valid for the location's business hours
+func validateStartAndEndTime(startTime time.Time, endTime time.Time, location Location) error {
+	// Times are checked in the location's time zone, locations without one use the offset the time was sent with
+	startTime, endTime = location.localTime(startTime), location.localTime(endTime)
 	if startTime.Minute()%30 != 0 || endTime.Minute()%30 != 0 {
-		return fmt.Errorf("appointment times must start and end on the hour or half-hour")
+		return newError(ErrValidation, "appointment times must start and end on the hour or half-hour")
 	}
 
 	if startTime.After(endTime) {
-		return fmt.Errorf("start time must be before end time")
+		return newError(ErrValidation, "start time must be before end time")
 	}
 
-	if startTime.Hour() < 8 || startTime.Hour() > 17 || endTime.Hour() < 8 || endTime.Hour() > 17 {
-		return fmt.Errorf("appointment time must be between 8am and 5pm")
+	// The appointment has to end by closing time on the day it starts
+	open, close := location.OpeningHours.Open, location.OpeningHours.Close
+	y, m, d := startTime.Date()
+	opens, closes := time.Date(y, m, d, open, 0, 0, 0, startTime.Location()), time.Date(y, m, d, close, 0, 0, 0, startTime.Location())
+	if startTime.Before(opens) || endTime.After(closes) {
+		return newError(ErrValidation, "appointment time must be between %s and %s", formatHour(open), formatHour(close))
 	}
 	return nil
 }
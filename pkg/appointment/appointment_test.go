@@ -24,9 +24,7 @@ func TestGetAvailableAppointments_NoAppointments_Overlapping(t *testing.T) {
 				TrainerID: 1,
 			},
 		},
-		TrainerIDs: map[int]bool{
-			1: true,
-		},
+		trainers: map[int]Trainer{1: {ID: 1}},
 	}
 
 	appReq := Appointment{
@@ -56,9 +54,7 @@ func TestGetAvailableAppointments_Available_DifferentTrainer(t *testing.T) {
 				TrainerID: 1,
 			},
 		},
-		TrainerIDs: map[int]bool{
-			2: true,
-		},
+		trainers: map[int]Trainer{2: {ID: 2}},
 	}
 
 	appReq := Appointment{
@@ -94,10 +90,7 @@ func TestGetAvailableAppointments_Available(t *testing.T) {
 				TrainerID: 1,
 			},
 		},
-		TrainerIDs: map[int]bool{
-			1: true,
-			2: true,
-		},
+		trainers: map[int]Trainer{1: {ID: 1}, 2: {ID: 2}},
 	}
 
 	requestStartTime, err := time.Parse(time.RFC3339, "2019-01-24T10:00:00-08:00")
@@ -124,9 +117,9 @@ func TestGetScheduledAppointments(t *testing.T) {
 				{TrainerID: 1},
 				{TrainerID: 2},
 			},
-			TrainerIDs: map[int]bool{1: true, 2: true},
+			trainers: map[int]Trainer{1: {ID: 1}, 2: {ID: 2}},
 		}
-		appointments, err := a.GetScheduledAppointments(1)
+		appointments, err := a.GetScheduledAppointments(Appointment{TrainerID: 1})
 		require.NoError(t, err)
 		require.Len(t, appointments, 2)
 		for _, app := range appointments {
@@ -140,18 +133,18 @@ func TestGetScheduledAppointments(t *testing.T) {
 				{TrainerID: 1},
 				{TrainerID: 2},
 			},
-			TrainerIDs: map[int]bool{1: true, 2: true},
+			trainers: map[int]Trainer{1: {ID: 1}, 2: {ID: 2}},
 		}
-		appointments, err := a.GetScheduledAppointments(3)
+		appointments, err := a.GetScheduledAppointments(Appointment{TrainerID: 3})
 		require.Error(t, err)
 		require.Nil(t, appointments)
 	})
 	t.Run("empty appointments list", func(t *testing.T) {
 		a := scheduledAppointments{
 			appointmentsList: []Appointment{},
-			TrainerIDs:       map[int]bool{1: true},
+			trainers:         map[int]Trainer{1: {ID: 1}},
 		}
-		appointments, err := a.GetScheduledAppointments(1)
+		appointments, err := a.GetScheduledAppointments(Appointment{TrainerID: 1})
 		require.NoError(t, err)
 		require.Empty(t, appointments)
 	})
@@ -162,9 +155,9 @@ func TestGetScheduledAppointments(t *testing.T) {
 				{TrainerID: 1},
 				{TrainerID: 1},
 			},
-			TrainerIDs: map[int]bool{1: true},
+			trainers: map[int]Trainer{1: {ID: 1}},
 		}
-		appointments, err := a.GetScheduledAppointments(1)
+		appointments, err := a.GetScheduledAppointments(Appointment{TrainerID: 1})
 		require.NoError(t, err)
 		require.Len(t, appointments, 3)
 		for _, app := range appointments {
@@ -175,14 +168,14 @@ func TestGetScheduledAppointments(t *testing.T) {
 
 func TestCreateAppointment_InvalidTrainerID(t *testing.T) {
 	a := scheduledAppointments{
-		TrainerIDs: map[int]bool{1: true},
+		trainers: map[int]Trainer{1: {ID: 1}},
 	}
 
 	app := Appointment{
 		TrainerID: 2,
 	}
 
-	err := a.CreateAppointment(app)
+	_, err := a.CreateAppointment(app)
 	if err == nil || err.Error() != "trainer does not exist" {
 		t.Errorf("expected error 'trainer does not exist', got %v", err)
 	}
@@ -190,7 +183,7 @@ func TestCreateAppointment_InvalidTrainerID(t *testing.T) {
 
 func TestCreateAppointment_InvalidStartAndEndTime(t *testing.T) {
 	a := scheduledAppointments{
-		TrainerIDs: map[int]bool{1: true},
+		trainers: map[int]Trainer{1: {ID: 1}},
 	}
 
 	app := Appointment{
@@ -199,7 +192,7 @@ func TestCreateAppointment_InvalidStartAndEndTime(t *testing.T) {
 		EndTime:   time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC),
 	}
 
-	err := a.CreateAppointment(app)
+	_, err := a.CreateAppointment(app)
 	if err == nil || err.Error() != "appointment time must be between 8am and 5pm" {
 		t.Errorf("expected error 'appointment time must be between 8am and 5pm', got %v", err)
 	}
@@ -213,16 +206,16 @@ func TestCreateAppointment_InvalidDuration(t *testing.T) {
 	}
 
 	a := scheduledAppointments{
-		TrainerIDs: map[int]bool{1: true},
+		trainers: map[int]Trainer{1: {ID: 1}},
 	}
 
-	err := a.CreateAppointment(app)
+	_, err := a.CreateAppointment(app)
 	assert.ErrorContains(t, err, "appointment times must start and end on the hour or half-hour")
 }
 
 func TestCreateAppointment_OverlappingAppointment(t *testing.T) {
 	a := scheduledAppointments{
-		TrainerIDs: map[int]bool{1: true},
+		trainers: map[int]Trainer{1: {ID: 1}},
 		appointmentsList: []Appointment{
 			{
 				TrainerID: 1,
@@ -238,7 +231,7 @@ func TestCreateAppointment_OverlappingAppointment(t *testing.T) {
 		EndTime:   time.Date(2022, 1, 1, 9, 30, 0, 0, time.UTC),
 	}
 
-	err := a.CreateAppointment(app)
+	_, err := a.CreateAppointment(app)
 	if err == nil || err.Error() != "appointment already exists at this time" {
 		t.Errorf("expected error 'appointment already exists at this time', got %v", err)
 	}
@@ -246,7 +239,7 @@ func TestCreateAppointment_OverlappingAppointment(t *testing.T) {
 
 func TestCreateAppointment_Success(t *testing.T) {
 	a := scheduledAppointments{
-		TrainerIDs: map[int]bool{1: true},
+		trainers: map[int]Trainer{1: {ID: 1}},
 	}
 
 	app := Appointment{
@@ -255,7 +248,7 @@ func TestCreateAppointment_Success(t *testing.T) {
 		EndTime:   time.Date(2022, 1, 1, 9, 30, 0, 0, time.UTC),
 	}
 
-	err := a.CreateAppointment(app)
+	_, err := a.CreateAppointment(app)
 	if err != nil {
 		t.Errorf("expected no error, got %v", err)
 	}
@@ -318,6 +311,20 @@ func TestValidateStartAndEndTime(t *testing.T) {
 			wantError:  true,
 			wantErrMsg: "appointment time must be between 8am and 5pm",
 		},
+		{
+			name:       "ends at closing time",
+			startTime:  time.Date(2022, 1, 1, 16, 30, 0, 0, time.UTC),
+			endTime:    time.Date(2022, 1, 1, 17, 0, 0, 0, time.UTC),
+			wantError:  false,
+			wantErrMsg: "",
+		},
+		{
+			name:       "starts at closing time",
+			startTime:  time.Date(2022, 1, 1, 17, 0, 0, 0, time.UTC),
+			endTime:    time.Date(2022, 1, 1, 17, 30, 0, 0, time.UTC),
+			wantError:  true,
+			wantErrMsg: "appointment time must be between 8am and 5pm",
+		},
 		{
 			name:       "invalid minute values",
 			startTime:  time.Date(2022, 1, 1, 9, 15, 0, 0, time.UTC),
@@ -329,7 +336,7 @@ func TestValidateStartAndEndTime(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateStartAndEndTime(tt.startTime, tt.endTime)
+			err := validateStartAndEndTime(tt.startTime, tt.endTime, defaultLocation)
 			if (err != nil) != tt.wantError {
 				t.Errorf("Test %s: validateStartAndEndTime() error = %v, wantError %v", tt.name, err, tt.wantError)
 				return
@@ -340,3 +347,33 @@ func TestValidateStartAndEndTime(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateAppointment_ErrorKinds(t *testing.T) {
+	a := scheduledAppointments{
+		trainers: map[int]Trainer{1: {ID: 1}},
+		appointmentsList: []Appointment{
+			{
+				TrainerID: 1,
+				StartTime: time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC),
+				EndTime:   time.Date(2022, 1, 1, 9, 30, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	_, err := a.CreateAppointment(Appointment{TrainerID: 2})
+	assert.ErrorIs(t, err, ErrTrainerNotFound)
+
+	_, err = a.CreateAppointment(Appointment{
+		TrainerID: 1,
+		StartTime: time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC),
+		EndTime:   time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC),
+	})
+	assert.ErrorIs(t, err, ErrValidation)
+
+	_, err = a.CreateAppointment(Appointment{
+		TrainerID: 1,
+		StartTime: time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC),
+		EndTime:   time.Date(2022, 1, 1, 9, 30, 0, 0, time.UTC),
+	})
+	assert.ErrorIs(t, err, ErrSlotConflict)
+}
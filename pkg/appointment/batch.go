@@ -0,0 +1,71 @@
+package appointment
+
+import "fmt"
+
+// BatchResult is what happened to one appointment in a batch, Err is set when it wasn't booked
+type BatchResult struct {
+	Appointment Appointment
+	Err         error
+}
+
+// CreateAppointments books the appointments in order under one lock so they are checked against each other as well as the schedule.
+// An atomic batch books every appointment or none of them, the error is the first appointment that failed.
+// Otherwise each appointment is booked if it can be and the results say which were.
+func (a *scheduledAppointments) CreateAppointments(apps []Appointment, atomic bool) ([]BatchResult, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	a.expirePendingRequests()
+
+	previous, latestID, mark := a.appointmentsList, a.latestID, a.markOutbox()
+	results, failed := a.createAppointments(apps)
+
+	if atomic && failed >= 0 {
+		a.appointmentsList, a.latestID = previous, latestID
+		a.rollbackOutbox(mark)
+		for i := range results {
+			if results[i].Err == nil {
+				results[i] = BatchResult{Err: newError(ErrBatchAborted, "not booked because appointment %d failed", failed)}
+			}
+		}
+		return results, fmt.Errorf("appointment %d: %w", failed, results[failed].Err)
+	}
+
+	if err := a.save(); err != nil {
+		a.appointmentsList, a.latestID = previous, latestID
+		a.rollbackOutbox(mark)
+		return nil, err
+	}
+	return results, nil
+}
+
+// CheckAppointments says what would happen if the appointments were booked in order without booking them.
+// The results have the status each appointment would get but no ID.
+func (a *scheduledAppointments) CheckAppointments(apps []Appointment) ([]BatchResult, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	a.expirePendingRequests()
+
+	previous, latestID, mark := a.appointmentsList, a.latestID, a.markOutbox()
+	results, _ := a.createAppointments(apps)
+	a.appointmentsList, a.latestID = previous, latestID
+	a.rollbackOutbox(mark)
+	for i := range results {
+		results[i].Appointment.ID = 0
+	}
+	return results, nil
+}
+
+// createAppointments books each appointment without saving, failed is the first one that wasn't booked or -1
+func (a *scheduledAppointments) createAppointments(apps []Appointment) ([]BatchResult, int) {
+	results := make([]BatchResult, len(apps))
+	failed := -1
+	for i, app := range apps {
+		results[i].Appointment, results[i].Err = a.createAppointment(app)
+		if results[i].Err != nil && failed < 0 {
+			failed = i
+		}
+	}
+	return results, failed
+}
@@ -0,0 +1,71 @@
+package appointment
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAppointments(t *testing.T) {
+	now := time.Date(2022, 1, 1, 8, 0, 0, 0, time.UTC)
+	start := time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)
+	slot := func(start time.Time) Appointment {
+		return Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)}
+	}
+	// The second appointment conflicts with the first one in the same batch
+	batch := []Appointment{slot(start), slot(start), slot(start.Add(time.Hour))}
+
+	t.Run("best effort", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		results, err := a.CreateAppointments(batch, false)
+		require.NoError(t, err)
+		require.Len(t, results, 3)
+
+		assert.NoError(t, results[0].Err)
+		assert.Equal(t, 1, results[0].Appointment.ID)
+		assert.True(t, errors.Is(results[1].Err, ErrSlotConflict))
+		assert.NoError(t, results[2].Err)
+		assert.Equal(t, 2, results[2].Appointment.ID)
+		assert.Len(t, a.appointmentsList, 2)
+	})
+	t.Run("atomic", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		results, err := a.CreateAppointments(batch, true)
+		assert.True(t, errors.Is(err, ErrSlotConflict))
+		assert.EqualError(t, err, "appointment 1: appointment already exists at this time")
+		require.Len(t, results, 3)
+		assert.True(t, errors.Is(results[0].Err, ErrBatchAborted))
+		assert.True(t, errors.Is(results[1].Err, ErrSlotConflict))
+		assert.True(t, errors.Is(results[2].Err, ErrBatchAborted))
+		assert.Empty(t, a.appointmentsList)
+
+		// Nothing was booked so the IDs aren't used up
+		results, err = a.CreateAppointments(batch[1:], true)
+		require.NoError(t, err)
+		assert.Equal(t, 1, results[0].Appointment.ID)
+		assert.Equal(t, 2, results[1].Appointment.ID)
+	})
+}
+
+func TestCheckAppointments(t *testing.T) {
+	now := time.Date(2022, 1, 1, 8, 0, 0, 0, time.UTC)
+	start := time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)
+	a := newStatusAppointments(now)
+	app := Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute), Status: StatusTentative}
+
+	results, err := a.CheckAppointments([]Appointment{app, app})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.NoError(t, results[0].Err)
+	assert.Zero(t, results[0].Appointment.ID)
+	assert.Equal(t, StatusTentative, results[0].Appointment.Status)
+	// Appointments are checked against the ones before them
+	assert.True(t, errors.Is(results[1].Err, ErrSlotConflict))
+
+	// Nothing was booked
+	assert.Empty(t, a.appointmentsList)
+	assert.Zero(t, a.latestID)
+}
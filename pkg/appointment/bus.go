@@ -0,0 +1,259 @@
+package appointment
+
+import "sync"
+
+type (
+	// DomainEvent is one of the typed events below, switch on its type to handle the ones a subscriber needs
+	DomainEvent interface {
+		// Base returns the ID, type and time every event has with the appointment as it is after the event
+		Base() Event
+	}
+
+	// AppointmentCreated is a new booking, including pending requests and tentative holds
+	AppointmentCreated struct{ Event }
+
+	// AppointmentRescheduled is an appointment moved to new times, Previous has the old ones
+	AppointmentRescheduled struct {
+		Event
+		Previous Appointment
+	}
+
+	// AppointmentUpdated is a change to an appointment that isn't a reschedule, like its session type
+	AppointmentUpdated struct {
+		Event
+		Previous Appointment
+	}
+
+	// AppointmentCancelled is a cancellation, the appointment says whether it was late and the fee
+	AppointmentCancelled struct {
+		Event
+		From Status
+	}
+
+	// AppointmentStatusChanged is any other move through the lifecycle like a check-in or an expired request
+	AppointmentStatusChanged struct {
+		Event
+		From Status
+	}
+
+	// AppointmentDeleted is an appointment removed from the schedule, the appointment is how it was before
+	AppointmentDeleted struct{ Event }
+
+	// EventBus hands committed events to subscribers in the order they happened, the zero value is ready to use.
+	// Synchronous subscribers are called one event at a time by whoever publishes.
+	// Asynchronous subscribers are called on their own goroutines, an appointment's events go to the same one
+	// by trainer so each trainer's events are handled in order.
+	EventBus struct {
+		mu     sync.Mutex
+		queue  []DomainEvent
+		subs   []*subscription
+		nextID int
+		// draining is held by the goroutine handing out the queue, others leave their events to it
+		draining sync.Mutex
+	}
+
+	subscription struct {
+		id      int
+		handler func(DomainEvent)
+		// workers are set for asynchronous subscribers
+		workers []*worker
+	}
+
+	// worker calls an asynchronous subscriber with the events of its share of the trainers
+	worker struct {
+		mu      sync.Mutex
+		queue   []DomainEvent
+		wake    chan struct{}
+		stopped bool
+		done    chan struct{}
+	}
+)
+
+// Subscribe calls handler with the manager's events once their changes are saved, see EventBus
+func (a *scheduledAppointments) Subscribe(handler func(DomainEvent)) (unsubscribe func()) {
+	return a.bus.Subscribe(handler)
+}
+
+// SubscribeAsync calls handler with the manager's events on other goroutines, see EventBus
+func (a *scheduledAppointments) SubscribeAsync(handler func(DomainEvent), workers int) (unsubscribe func()) {
+	return a.bus.SubscribeAsync(handler, workers)
+}
+
+// unlock releases the manager and publishes the events of the changes made while it was held.
+// They are queued before the lock is released so changes made at the same time are published in order.
+func (a *scheduledAppointments) unlock() {
+	a.bus.enqueue(a.unpublished...)
+	a.unpublished = nil
+	a.mu.Unlock()
+	a.bus.drain()
+}
+
+// Base returns the event itself so the typed events that embed it are DomainEvents
+func (e Event) Base() Event {
+	return e
+}
+
+// domainEvent returns the typed event for the event, previous is the appointment before it
+func domainEvent(event Event, previous Appointment) DomainEvent {
+	switch event.Type {
+	case EventCreated:
+		return AppointmentCreated{event}
+	case EventRescheduled:
+		return AppointmentRescheduled{event, previous}
+	case EventUpdated:
+		return AppointmentUpdated{event, previous}
+	case EventDeleted:
+		return AppointmentDeleted{event}
+	case statusEvent(StatusCancelled):
+		return AppointmentCancelled{event, previous.Status}
+	default:
+		return AppointmentStatusChanged{event, previous.Status}
+	}
+}
+
+// Subscribe calls handler with every event from now on until unsubscribe is called.
+// The handler runs before the next event is handed out so it should be quick, changes it makes to the schedule
+// are published after the event it is handling.
+func (b *EventBus) Subscribe(handler func(DomainEvent)) (unsubscribe func()) {
+	return b.subscribe(&subscription{handler: handler})
+}
+
+// SubscribeAsync calls handler with every event from now on using up to workers goroutines at once.
+// Unsubscribing waits for the events the subscriber was already given to be handled.
+func (b *EventBus) SubscribeAsync(handler func(DomainEvent), workers int) (unsubscribe func()) {
+	if workers < 1 {
+		workers = 1
+	}
+	sub := &subscription{handler: handler}
+	for i := 0; i < workers; i++ {
+		w := &worker{wake: make(chan struct{}, 1), done: make(chan struct{})}
+		sub.workers = append(sub.workers, w)
+		go w.run(handler)
+	}
+	return b.subscribe(sub)
+}
+
+func (b *EventBus) subscribe(sub *subscription) func() {
+	b.mu.Lock()
+	b.nextID++
+	sub.id = b.nextID
+	// The list is copied so events being handed out keep the subscribers they started with
+	b.subs = append(append([]*subscription{}, b.subs...), sub)
+	b.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			subs := make([]*subscription, 0, len(b.subs))
+			for _, s := range b.subs {
+				if s.id != sub.id {
+					subs = append(subs, s)
+				}
+			}
+			b.subs = subs
+			b.mu.Unlock()
+
+			for _, w := range sub.workers {
+				w.stop()
+			}
+		})
+	}
+}
+
+// Publish hands the events to the subscribers
+func (b *EventBus) Publish(events ...DomainEvent) {
+	b.enqueue(events...)
+	b.drain()
+}
+
+// enqueue adds events to be handed out, callers that need events in order enqueue under their own lock
+func (b *EventBus) enqueue(events ...DomainEvent) {
+	if len(events) == 0 {
+		return
+	}
+	b.mu.Lock()
+	b.queue = append(b.queue, events...)
+	b.mu.Unlock()
+}
+
+// drain hands out the queued events unless another goroutine already is, in which case it hands out ours too.
+// This keeps the order when changes are made at the same time and lets a subscriber make changes of its own.
+func (b *EventBus) drain() {
+	for {
+		if !b.draining.TryLock() {
+			return
+		}
+		b.mu.Lock()
+		events, subs := b.queue, b.subs
+		b.queue = nil
+		b.mu.Unlock()
+
+		for _, event := range events {
+			for _, sub := range subs {
+				sub.handle(event)
+			}
+		}
+		b.draining.Unlock()
+
+		// Events queued while the lock was held were left to us
+		b.mu.Lock()
+		empty := len(b.queue) == 0
+		b.mu.Unlock()
+		if empty {
+			return
+		}
+	}
+}
+
+// handle calls a synchronous subscriber or gives the event to the asynchronous subscriber's worker for the trainer
+func (s *subscription) handle(event DomainEvent) {
+	if len(s.workers) == 0 {
+		s.handler(event)
+		return
+	}
+	// Trainer IDs are read from files and imports so they can be negative, the shard can't be
+	s.workers[uint(event.Base().Appointment.TrainerID)%uint(len(s.workers))].add(event)
+}
+
+func (w *worker) add(event DomainEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return
+	}
+	w.queue = append(w.queue, event)
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stop waits for the worker to handle what it was given and return
+func (w *worker) stop() {
+	w.mu.Lock()
+	w.stopped = true
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	<-w.done
+}
+
+func (w *worker) run(handler func(DomainEvent)) {
+	defer close(w.done)
+	for range w.wake {
+		w.mu.Lock()
+		events, stopped := w.queue, w.stopped
+		w.queue = nil
+		w.mu.Unlock()
+
+		for _, event := range events {
+			handler(event)
+		}
+		if stopped {
+			return
+		}
+	}
+}
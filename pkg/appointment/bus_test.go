@@ -0,0 +1,127 @@
+package appointment
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribe(t *testing.T) {
+	now := time.Date(2022, 1, 1, 8, 0, 0, 0, time.UTC)
+	start := time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)
+	slot := func(userID int, start time.Time) Appointment {
+		return Appointment{TrainerID: 1, UserID: userID, StartTime: start, EndTime: start.Add(30 * time.Minute)}
+	}
+
+	t.Run("typed events in order", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		var events []DomainEvent
+		unsubscribe := a.Subscribe(func(event DomainEvent) {
+			events = append(events, event)
+		})
+
+		app, err := a.CreateAppointment(slot(1, start))
+		require.NoError(t, err)
+		_, err = a.UpdateAppointment(Appointment{ID: app.ID, StartTime: start.Add(time.Hour), EndTime: start.Add(90 * time.Minute)}, AnyVersion)
+		require.NoError(t, err)
+		_, err = a.TransitionAppointment(app.ID, ActionCancel)
+		require.NoError(t, err)
+		unsubscribe()
+		require.NoError(t, a.DeleteAppointment(app.ID, AnyVersion))
+
+		require.Len(t, events, 3)
+		assert.IsType(t, AppointmentCreated{}, events[0])
+		rescheduled, ok := events[1].(AppointmentRescheduled)
+		require.True(t, ok)
+		assert.True(t, rescheduled.Previous.StartTime.Equal(start))
+		assert.True(t, rescheduled.Appointment.StartTime.Equal(start.Add(time.Hour)))
+		cancelled, ok := events[2].(AppointmentCancelled)
+		require.True(t, ok)
+		assert.Equal(t, StatusConfirmed, cancelled.From)
+		assert.Equal(t, 3, cancelled.Base().ID)
+	})
+	t.Run("only saved changes are published", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		a.path = filepath.Join(t.TempDir(), "missing", "appointments.json")
+		published := 0
+		a.Subscribe(func(DomainEvent) { published++ })
+
+		_, err := a.CreateAppointment(slot(1, start))
+		require.Error(t, err)
+		_, err = a.CheckAppointments([]Appointment{slot(1, start)})
+		require.NoError(t, err)
+		assert.Zero(t, published)
+	})
+	t.Run("subscribers can make changes", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		var types []EventType
+		a.Subscribe(func(event DomainEvent) {
+			types = append(types, event.Base().Type)
+			// Every booking is confirmed by the trainer straight away
+			if created, ok := event.(AppointmentCreated); ok {
+				a.TransitionAppointment(created.Appointment.ID, ActionConfirm)
+			}
+		})
+
+		_, err := a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute), Status: StatusTentative})
+		require.NoError(t, err)
+		assert.Equal(t, []EventType{EventCreated, "appointment.confirmed"}, types)
+	})
+}
+
+func TestSubscribeAsync(t *testing.T) {
+	now := time.Date(2022, 1, 1, 8, 0, 0, 0, time.UTC)
+	start := time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)
+	a := newStatusAppointments(now)
+	for id := 1; id <= 5; id++ {
+		a.trainers[id] = Trainer{ID: id}
+	}
+
+	var (
+		mu  sync.Mutex
+		ids = map[int][]int{}
+	)
+	unsubscribe := a.SubscribeAsync(func(event DomainEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		trainerID := event.Base().Appointment.TrainerID
+		ids[trainerID] = append(ids[trainerID], event.Base().ID)
+	}, 3)
+
+	// Every trainer books their day at the same time as the others
+	var wg sync.WaitGroup
+	for id := 1; id <= 5; id++ {
+		wg.Add(1)
+		go func(trainerID int) {
+			defer wg.Done()
+			for slot := 0; slot < 16; slot++ {
+				slotStart := start.Add(time.Duration(slot) * 30 * time.Minute)
+				_, err := a.CreateAppointment(Appointment{TrainerID: trainerID, UserID: trainerID*100 + slot, StartTime: slotStart, EndTime: slotStart.Add(30 * time.Minute)})
+				assert.NoError(t, err)
+			}
+		}(id)
+	}
+	wg.Wait()
+	unsubscribe()
+
+	for id := 1; id <= 5; id++ {
+		require.Len(t, ids[id], 16)
+		assert.IsIncreasing(t, ids[id], "trainer %d", id)
+	}
+}
+
+func TestSubscribeAsync_NegativeTrainerID(t *testing.T) {
+	var bus EventBus
+	handled := make(chan int, 1)
+	unsubscribe := bus.SubscribeAsync(func(event DomainEvent) {
+		handled <- event.Base().Appointment.TrainerID
+	}, 3)
+	defer unsubscribe()
+
+	bus.Publish(AppointmentCreated{Event{ID: 1, Type: EventCreated, Appointment: Appointment{ID: 1, TrainerID: -4}}})
+	assert.Equal(t, -4, <-handled)
+}
@@ -0,0 +1,90 @@
+package appointment
+
+import (
+	"sort"
+	"time"
+)
+
+// BusyBlock is time a trainer can't be booked, imported from their own calendar.
+// Every occurrence of a recurring event is a block with the event's UID.
+type BusyBlock struct {
+	UID       string    `json:"uid"`
+	TrainerID int       `json:"trainer_id"`
+	StartTime time.Time `json:"starts_at"`
+	EndTime   time.Time `json:"ends_at"`
+}
+
+// GetBusyBlocks returns the trainer's busy blocks that haven't ended, in the order they start
+func (a *scheduledAppointments) GetBusyBlocks(trainerID int) ([]BusyBlock, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	if _, ok := a.trainers[trainerID]; !ok {
+		return nil, newError(ErrTrainerNotFound, "trainer does not exist")
+	}
+
+	now := a.currentTime()
+	var blocks []BusyBlock
+	for _, block := range a.busyBlocks {
+		if block.TrainerID == trainerID && block.EndTime.After(now) {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks, nil
+}
+
+// ImportBusyBlocks replaces the trainer's blocks for each of the UIDs with the blocks that have them.
+// A UID without blocks removes the blocks it had, like an event that was cancelled. Blocks with other UIDs are kept.
+// Blocks that have already ended are dropped.
+func (a *scheduledAppointments) ImportBusyBlocks(trainerID int, uids []string, blocks []BusyBlock) error {
+	a.mu.Lock()
+	defer a.unlock()
+
+	if _, ok := a.trainers[trainerID]; !ok {
+		return newError(ErrTrainerNotFound, "trainer does not exist")
+	}
+
+	replaced := make(map[string]bool, len(uids))
+	for _, uid := range uids {
+		replaced[uid] = true
+	}
+	for _, block := range blocks {
+		if !block.EndTime.After(block.StartTime) {
+			return newError(ErrValidation, "busy block %s must end after it starts", block.UID)
+		}
+		replaced[block.UID] = true
+	}
+
+	now := a.currentTime()
+	var kept []BusyBlock
+	for _, block := range a.busyBlocks {
+		if block.EndTime.After(now) && (block.TrainerID != trainerID || !replaced[block.UID]) {
+			kept = append(kept, block)
+		}
+	}
+	for _, block := range blocks {
+		if block.EndTime.After(now) {
+			block.TrainerID = trainerID
+			kept = append(kept, block)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].StartTime.Before(kept[j].StartTime) })
+
+	previous := a.busyBlocks
+	a.busyBlocks = kept
+	if err := a.saveBusyBlocks(); err != nil {
+		a.busyBlocks = previous
+		return err
+	}
+	return nil
+}
+
+// isBusy reports whether one of the trainer's busy blocks overlaps the time from start to end
+func (a *scheduledAppointments) isBusy(trainerID int, start time.Time, end time.Time) bool {
+	for _, block := range a.busyBlocks {
+		if block.TrainerID == trainerID && block.StartTime.Before(end) && block.EndTime.After(start) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package appointment
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportBusyBlocks(t *testing.T) {
+	now := time.Date(2022, 1, 1, 8, 0, 0, 0, time.UTC)
+	start := time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)
+	block := func(uid string, start time.Time, length time.Duration) BusyBlock {
+		return BusyBlock{UID: uid, StartTime: start, EndTime: start.Add(length)}
+	}
+
+	t.Run("blocks are unavailable", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		require.NoError(t, a.ImportBusyBlocks(1, nil, []BusyBlock{block("dentist", start.Add(15*time.Minute), time.Hour)}))
+
+		available, err := a.GetAvailableAppointments(Appointment{TrainerID: 1, StartTime: start, EndTime: start.Add(2 * time.Hour)})
+		require.NoError(t, err)
+		var starts []time.Time
+		for _, app := range available {
+			starts = append(starts, app.StartTime)
+		}
+		// A block overlapping part of a slot takes the whole slot
+		assert.Equal(t, []time.Time{start.Add(90 * time.Minute)}, starts)
+
+		_, err = a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start.Add(time.Hour), EndTime: start.Add(90 * time.Minute)})
+		assert.True(t, errors.Is(err, ErrSlotConflict))
+		assert.EqualError(t, err, "trainer 1 is busy at this time")
+	})
+	t.Run("re-import replaces blocks by uid", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		a.trainers[2] = Trainer{ID: 2}
+		require.NoError(t, a.ImportBusyBlocks(1, nil, []BusyBlock{
+			block("weekly", start, time.Hour),
+			block("weekly", start.Add(7*24*time.Hour), time.Hour),
+			block("dentist", start.Add(2*time.Hour), time.Hour),
+			block("cancelled", start.Add(4*time.Hour), time.Hour),
+		}))
+		require.NoError(t, a.ImportBusyBlocks(2, nil, []BusyBlock{block("weekly", start, time.Hour)}))
+
+		// The weekly event moved, the cancelled one is only in the uids and the dentist isn't in this import
+		require.NoError(t, a.ImportBusyBlocks(1, []string{"weekly", "cancelled"}, []BusyBlock{block("weekly", start.Add(time.Hour), time.Hour)}))
+		blocks, err := a.GetBusyBlocks(1)
+		require.NoError(t, err)
+		require.Len(t, blocks, 2)
+		assert.Equal(t, BusyBlock{UID: "weekly", TrainerID: 1, StartTime: start.Add(time.Hour), EndTime: start.Add(2 * time.Hour)}, blocks[0])
+		assert.Equal(t, "dentist", blocks[1].UID)
+
+		// Other trainers' blocks with the same uid are kept
+		blocks, err = a.GetBusyBlocks(2)
+		require.NoError(t, err)
+		assert.Len(t, blocks, 1)
+	})
+	t.Run("past blocks are dropped", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		require.NoError(t, a.ImportBusyBlocks(1, nil, []BusyBlock{block("past", now.Add(-2*time.Hour), time.Hour), block("now", now.Add(-time.Hour), 2*time.Hour)}))
+		blocks, err := a.GetBusyBlocks(1)
+		require.NoError(t, err)
+		require.Len(t, blocks, 1)
+		assert.Equal(t, "now", blocks[0].UID)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		err := a.ImportBusyBlocks(9, nil, nil)
+		assert.True(t, errors.Is(err, ErrTrainerNotFound))
+
+		err = a.ImportBusyBlocks(1, nil, []BusyBlock{block("backwards", start, -time.Hour)})
+		assert.True(t, errors.Is(err, ErrValidation))
+	})
+	t.Run("saved", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "appointments.json"), `{"version": 2, "appointments": []}`)
+		writeFile(t, filepath.Join(dir, "trainers.json"), `[{"id": 1}]`)
+		a, err := newAppointmentManager(dir)
+		require.NoError(t, err)
+		a.now = func() time.Time { return now }
+		require.NoError(t, a.ImportBusyBlocks(1, nil, []BusyBlock{block("dentist", start, time.Hour)}))
+
+		reloaded, err := newAppointmentManager(dir)
+		require.NoError(t, err)
+		require.Len(t, reloaded.busyBlocks, 1)
+		assert.True(t, reloaded.isBusy(1, start, start.Add(30*time.Minute)))
+	})
+}
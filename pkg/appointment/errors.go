@@ -0,0 +1,48 @@
+package appointment
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the Manager can be matched against these with errors.Is
+var (
+	ErrTrainerNotFound     = errors.New("trainer not found")
+	ErrLocationNotFound    = errors.New("location not found")
+	ErrAppointmentNotFound = errors.New("appointment not found")
+	ErrTenantNotFound      = errors.New("tenant not found")
+	ErrWebhookNotFound     = errors.New("webhook not found")
+	ErrDeliveryNotFound    = errors.New("delivery not found")
+	ErrUserNotFound        = errors.New("user not found")
+	// ErrSlotConflict is returned when the trainer is already booked at the requested time
+	ErrSlotConflict = errors.New("slot conflict")
+	// ErrInvalidTransition is returned when an action can't be taken from the appointment's current status
+	ErrInvalidTransition = errors.New("invalid status transition")
+	// ErrBookingBlocked is returned when a user over the no-show threshold tries to book
+	ErrBookingBlocked = errors.New("booking blocked")
+	// ErrVersionMismatch is returned when an appointment has changed since the version the change was based on
+	ErrVersionMismatch = errors.New("version mismatch")
+	// ErrBatchAborted is returned for the appointments in an all or nothing batch that weren't booked because another one failed
+	ErrBatchAborted = errors.New("batch aborted")
+	// ErrValidation is returned when the request breaks a booking rule such as business hours or duration
+	ErrValidation = errors.New("validation failed")
+)
+
+// kindError keeps the readable message of an error while matching one of the sentinel errors
+type kindError struct {
+	kind    error
+	message string
+}
+
+func (e *kindError) Error() string {
+	return e.message
+}
+
+func (e *kindError) Unwrap() error {
+	return e.kind
+}
+
+// newError formats an error message that matches kind with errors.Is
+func newError(kind error, format string, args ...interface{}) error {
+	return &kindError{kind: kind, message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,222 @@
+package appointment
+
+import "time"
+
+// EventType says what happened to an appointment
+type EventType string
+
+// Event types, a status change is appointment. followed by the new status like appointment.cancelled
+const (
+	EventCreated     EventType = "appointment.created"
+	EventRescheduled EventType = "appointment.rescheduled"
+	// EventUpdated is a change that isn't a reschedule, like the session type
+	EventUpdated EventType = "appointment.updated"
+	EventDeleted EventType = "appointment.deleted"
+)
+
+type (
+	// Event is a change to an appointment, the appointment is how it was after the change
+	Event struct {
+		// ID goes up by one for every event of the tenant so receivers can ignore events they've already seen
+		ID          int         `json:"id"`
+		Type        EventType   `json:"type"`
+		At          time.Time   `json:"at"`
+		Appointment Appointment `json:"appointment"`
+	}
+
+	// Delivery is an event waiting to be sent to a webhook
+	Delivery struct {
+		ID            int       `json:"id"`
+		WebhookID     int       `json:"webhook_id"`
+		Event         Event     `json:"event"`
+		Attempts      int       `json:"attempts"`
+		NextAttemptAt time.Time `json:"next_attempt_at"`
+		LastError     string    `json:"last_error,omitempty"`
+	}
+
+	// outboxMark is the end of the outbox before a change so the change's events can be rolled back with it
+	outboxMark struct {
+		latestEventID    int
+		latestDeliveryID int
+		size             int
+	}
+)
+
+// EventTypes returns every event type webhooks can subscribe to
+func EventTypes() []EventType {
+	types := []EventType{EventCreated, EventRescheduled, EventUpdated, EventDeleted}
+	for _, status := range []Status{StatusConfirmed, StatusCheckedIn, StatusCompleted, StatusNoShow, StatusCancelled, StatusDeclined, StatusExpired} {
+		types = append(types, statusEvent(status))
+	}
+	return types
+}
+
+// statusEvent is the event type for an appointment moving to status
+func statusEvent(status Status) EventType {
+	return EventType("appointment." + string(status))
+}
+
+// valid reports whether t is one of the event types
+func (t EventType) valid() bool {
+	for _, eventType := range EventTypes() {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// emit records the event and adds a delivery to the outbox for every webhook that wants it, previous is the appointment
+// before the change. The outbox is saved with the appointments so an event is sent once the change is saved and only then.
+func (a *scheduledAppointments) emit(eventType EventType, previous Appointment, app Appointment, at time.Time) {
+	a.latestEventID++
+	event := Event{ID: a.latestEventID, Type: eventType, At: at, Appointment: app}
+	a.bufferEvent(event)
+	a.unpublished = append(a.unpublished, domainEvent(event, previous))
+	for _, webhook := range a.webhooks {
+		if !webhook.wants(eventType) {
+			continue
+		}
+		a.latestDeliveryID++
+		a.outbox = append(a.outbox, Delivery{ID: a.latestDeliveryID, WebhookID: webhook.ID, Event: event, NextAttemptAt: at})
+	}
+}
+
+// markOutbox returns the end of the outbox to roll back to if a change isn't saved
+func (a *scheduledAppointments) markOutbox() outboxMark {
+	return outboxMark{latestEventID: a.latestEventID, latestDeliveryID: a.latestDeliveryID, size: len(a.outbox)}
+}
+
+// rollbackOutbox removes the events emitted since the mark
+func (a *scheduledAppointments) rollbackOutbox(mark outboxMark) {
+	a.unbufferEvents(mark.latestEventID)
+	for len(a.unpublished) > 0 && a.unpublished[len(a.unpublished)-1].Base().ID > mark.latestEventID {
+		a.unpublished = a.unpublished[:len(a.unpublished)-1]
+	}
+	a.latestEventID, a.latestDeliveryID = mark.latestEventID, mark.latestDeliveryID
+	a.outbox = a.outbox[:mark.size]
+}
+
+// DueDeliveries returns up to limit deliveries that are due at now in the order their events happened.
+// A webhook's deliveries wait behind one of its deliveries that is waiting for a retry so it gets its events in order.
+// Deliveries to webhooks that have been deleted are dropped.
+func (a *scheduledAppointments) DueDeliveries(now time.Time, limit int) ([]Delivery, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	a.expirePendingRequests()
+
+	var (
+		due     []Delivery
+		kept    []Delivery
+		waiting = make(map[int]bool)
+	)
+	for _, delivery := range a.outbox {
+		if _, ok := a.webhookIndex(delivery.WebhookID); !ok {
+			continue
+		}
+		kept = append(kept, delivery)
+		switch {
+		case waiting[delivery.WebhookID]:
+		case delivery.NextAttemptAt.After(now):
+			waiting[delivery.WebhookID] = true
+		case len(due) < limit:
+			due = append(due, delivery)
+		}
+	}
+	a.outbox = kept
+	return due, nil
+}
+
+// DeliveryDone removes a delivery that was sent from the outbox
+func (a *scheduledAppointments) DeliveryDone(id int) error {
+	a.mu.Lock()
+	defer a.unlock()
+
+	i, err := deliveryIndex(a.outbox, id)
+	if err != nil {
+		return err
+	}
+
+	previous := a.outbox
+	a.outbox = append(append([]Delivery{}, previous[:i]...), previous[i+1:]...)
+	if err := a.save(); err != nil {
+		a.outbox = previous
+		return err
+	}
+	return nil
+}
+
+// DeliveryFailed records a failed attempt at a delivery, it is tried again at retryAt.
+// A zero retryAt gives up on the delivery and moves it to the dead letters.
+func (a *scheduledAppointments) DeliveryFailed(id int, reason string, retryAt time.Time) error {
+	a.mu.Lock()
+	defer a.unlock()
+
+	i, err := deliveryIndex(a.outbox, id)
+	if err != nil {
+		return err
+	}
+
+	previous, previousDead := a.outbox, a.deadLetters
+	delivery := a.outbox[i]
+	delivery.Attempts++
+	delivery.LastError = reason
+	delivery.NextAttemptAt = retryAt
+	a.outbox = append([]Delivery{}, previous...)
+	if retryAt.IsZero() {
+		a.outbox = append(a.outbox[:i], a.outbox[i+1:]...)
+		a.deadLetters = append(a.deadLetters, delivery)
+	} else {
+		a.outbox[i] = delivery
+	}
+	if err := a.save(); err != nil {
+		a.outbox, a.deadLetters = previous, previousDead
+		return err
+	}
+	return nil
+}
+
+// GetDeadLetters returns the deliveries that were given up on, oldest first
+func (a *scheduledAppointments) GetDeadLetters() ([]Delivery, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	return append([]Delivery{}, a.deadLetters...), nil
+}
+
+// RetryDeadLetter puts a delivery that was given up on back in the outbox to be sent straight away
+func (a *scheduledAppointments) RetryDeadLetter(id int) error {
+	a.mu.Lock()
+	defer a.unlock()
+
+	i, err := deliveryIndex(a.deadLetters, id)
+	if err != nil {
+		return err
+	}
+	delivery := a.deadLetters[i]
+	if _, ok := a.webhookIndex(delivery.WebhookID); !ok {
+		return newError(ErrWebhookNotFound, "webhook %d does not exist", delivery.WebhookID)
+	}
+
+	previous, previousDead := a.outbox, a.deadLetters
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = a.currentTime()
+	a.deadLetters = append(append([]Delivery{}, previousDead[:i]...), previousDead[i+1:]...)
+	a.outbox = append(append([]Delivery{}, previous...), delivery)
+	if err := a.save(); err != nil {
+		a.outbox, a.deadLetters = previous, previousDead
+		return err
+	}
+	return nil
+}
+
+// deliveryIndex returns the index of the delivery in the list
+func deliveryIndex(deliveries []Delivery, id int) (int, error) {
+	for i, delivery := range deliveries {
+		if delivery.ID == id {
+			return i, nil
+		}
+	}
+	return 0, newError(ErrDeliveryNotFound, "delivery %d does not exist", id)
+}
@@ -0,0 +1,80 @@
+package appointment
+
+import (
+	"sort"
+	"time"
+)
+
+// maxFreeBusyRange is the longest time free/busy can be asked for at once
+const maxFreeBusyRange = 92 * 24 * time.Hour
+
+// Interval is a span of time, free/busy has no details of what fills it
+type Interval struct {
+	StartTime time.Time `json:"starts_at"`
+	EndTime   time.Time `json:"ends_at"`
+}
+
+// GetFreeBusy returns when the trainer is busy between from and to, with the appointments, holds and busy blocks merged.
+// Intervals are cut to from and to and are in the time zone of the trainer's location.
+func (a *scheduledAppointments) GetFreeBusy(trainerID int, from time.Time, to time.Time) ([]Interval, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	a.expirePendingRequests()
+
+	trainer, ok := a.trainers[trainerID]
+	if !ok {
+		return nil, newError(ErrTrainerNotFound, "trainer does not exist")
+	}
+	if !to.After(from) {
+		return nil, newError(ErrValidation, "to must be after from")
+	}
+	if to.Sub(from) > maxFreeBusyRange {
+		return nil, newError(ErrValidation, "free/busy can't be asked for more than %d days at once", maxFreeBusyRange/(24*time.Hour))
+	}
+
+	appointments, err := a.getRelevantAppointments(Appointment{TrainerID: trainerID, StartTime: from, EndTime: to})
+	if err != nil {
+		return nil, err
+	}
+	var busy []Interval
+	for _, app := range appointments {
+		busy = append(busy, Interval{StartTime: app.StartTime, EndTime: app.EndTime})
+	}
+	for _, block := range a.busyBlocks {
+		if block.TrainerID == trainerID && block.StartTime.Before(to) && block.EndTime.After(from) {
+			busy = append(busy, Interval{StartTime: block.StartTime, EndTime: block.EndTime})
+		}
+	}
+
+	location := a.trainerLocation(trainer)
+	merged := mergeIntervals(busy)
+	for i := range merged {
+		if merged[i].StartTime.Before(from) {
+			merged[i].StartTime = from
+		}
+		if merged[i].EndTime.After(to) {
+			merged[i].EndTime = to
+		}
+		merged[i].StartTime, merged[i].EndTime = location.localTime(merged[i].StartTime), location.localTime(merged[i].EndTime)
+	}
+	return merged, nil
+}
+
+// mergeIntervals sorts the intervals and joins the ones that overlap or touch
+func mergeIntervals(intervals []Interval) []Interval {
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].StartTime.Before(intervals[j].StartTime) })
+
+	var merged []Interval
+	for _, interval := range intervals {
+		last := len(merged) - 1
+		if last >= 0 && !interval.StartTime.After(merged[last].EndTime) {
+			if interval.EndTime.After(merged[last].EndTime) {
+				merged[last].EndTime = interval.EndTime
+			}
+			continue
+		}
+		merged = append(merged, interval)
+	}
+	return merged
+}
@@ -0,0 +1,44 @@
+package appointment
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetFreeBusy(t *testing.T) {
+	now := time.Date(2022, 1, 1, 8, 0, 0, 0, time.UTC)
+	start := time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)
+	a := newStatusAppointments(now)
+	book := func(start time.Time, status Status) {
+		_, err := a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute), Status: status})
+		require.NoError(t, err)
+	}
+	// Back to back appointments and a hold are one interval, a cancelled appointment isn't busy
+	book(start, StatusConfirmed)
+	book(start.Add(30*time.Minute), StatusTentative)
+	book(start.Add(3*time.Hour), StatusConfirmed)
+	_, err := a.TransitionAppointment(3, ActionCancel)
+	require.NoError(t, err)
+	// A busy block overlapping an appointment is merged with it
+	require.NoError(t, a.ImportBusyBlocks(1, nil, []BusyBlock{{UID: "gym", StartTime: start.Add(45 * time.Minute), EndTime: start.Add(2 * time.Hour)}}))
+	require.NoError(t, a.ImportBusyBlocks(1, nil, []BusyBlock{{UID: "late", StartTime: start.Add(5 * time.Hour), EndTime: start.Add(7 * time.Hour)}}))
+
+	busy, err := a.GetFreeBusy(1, start.Add(-time.Hour), start.Add(6*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []Interval{
+		{StartTime: start, EndTime: start.Add(2 * time.Hour)},
+		// Cut to the end of the range
+		{StartTime: start.Add(5 * time.Hour), EndTime: start.Add(6 * time.Hour)},
+	}, busy)
+
+	_, err = a.GetFreeBusy(2, start, start.Add(time.Hour))
+	assert.True(t, errors.Is(err, ErrTrainerNotFound))
+	_, err = a.GetFreeBusy(1, start, start)
+	assert.True(t, errors.Is(err, ErrValidation))
+	_, err = a.GetFreeBusy(1, start, start.AddDate(1, 0, 0))
+	assert.True(t, errors.Is(err, ErrValidation))
+}
@@ -0,0 +1,153 @@
+package appointment
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+type (
+	// Location is a gym site that trainers and their appointments belong to
+	Location struct {
+		ID           int          `json:"id"`
+		Name         string       `json:"name"`
+		Address      string       `json:"address"`
+		TimeZone     string       `json:"time_zone"`
+		OpeningHours OpeningHours `json:"opening_hours"`
+
+		timeZone *time.Location
+	}
+
+	// OpeningHours is the window, in whole hours of the location's local time, that appointments can be booked in
+	OpeningHours struct {
+		Open  int `json:"open"`
+		Close int `json:"close"`
+	}
+
+	// Trainer is a trainer that works at a location
+	Trainer struct {
+		ID         int `json:"id"`
+		LocationID int `json:"location_id,omitempty"`
+		// RequiresApproval makes new bookings pending until the trainer accepts them
+		RequiresApproval bool `json:"requires_approval,omitempty"`
+	}
+)
+
+// defaultLocation is used for trainers that have not been assigned to a location.
+// It has no time zone so times are checked in whatever offset they were sent with.
+var defaultLocation = Location{OpeningHours: OpeningHours{Open: 8, Close: 17}}
+
+// init loads the time zone and checks the opening hours of a location read from a file
+func (l *Location) init() error {
+	if l.TimeZone != "" {
+		tz, err := time.LoadLocation(l.TimeZone)
+		if err != nil {
+			return fmt.Errorf("location %d has an invalid time zone: %w", l.ID, err)
+		}
+		l.timeZone = tz
+	}
+
+	if l.OpeningHours.Open < 0 || l.OpeningHours.Close > 24 || l.OpeningHours.Open >= l.OpeningHours.Close {
+		return fmt.Errorf("location %d has invalid opening hours %d-%d", l.ID, l.OpeningHours.Open, l.OpeningHours.Close)
+	}
+	return nil
+}
+
+// localTime converts t to the location's time zone
+func (l Location) localTime(t time.Time) time.Time {
+	if l.timeZone == nil {
+		return t
+	}
+	return t.In(l.timeZone)
+}
+
+// Zone returns the location's time zone, nil when times are checked in the offset they were sent with
+func (l Location) Zone() *time.Location {
+	return l.timeZone
+}
+
+// GetLocations returns every location sorted by ID
+func (a *scheduledAppointments) GetLocations() ([]Location, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	locations := make([]Location, 0, len(a.locations))
+	for _, location := range a.locations {
+		locations = append(locations, location)
+	}
+	sort.Slice(locations, func(i, j int) bool { return locations[i].ID < locations[j].ID })
+	return locations, nil
+}
+
+// GetBookingLocation returns the location whose opening hours apply to a request for the trainer or location
+func (a *scheduledAppointments) GetBookingLocation(trainerID int, locationID int) (Location, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	if trainerID == 0 {
+		if _, err := a.trainersForRequest(0, locationID); err != nil {
+			return Location{}, err
+		}
+		return a.locations[locationID], nil
+	}
+
+	trainers, err := a.trainersForRequest(trainerID, locationID)
+	if err != nil {
+		return Location{}, err
+	}
+	return a.trainerLocation(trainers[0]), nil
+}
+
+// trainerLocation returns the location the trainer works at
+func (a *scheduledAppointments) trainerLocation(trainer Trainer) Location {
+	if location, ok := a.locations[trainer.LocationID]; ok {
+		return location
+	}
+	return defaultLocation
+}
+
+// trainersForRequest returns the trainers a request applies to.
+// A trainer ID selects a single trainer, which must work at the location if one is also given.
+// A location ID on its own selects every trainer at that location.
+func (a *scheduledAppointments) trainersForRequest(trainerID int, locationID int) ([]Trainer, error) {
+	if trainerID != 0 {
+		trainer, ok := a.trainers[trainerID]
+		if !ok {
+			return nil, newError(ErrTrainerNotFound, "trainer does not exist")
+		}
+		if locationID != 0 && trainer.LocationID != locationID {
+			return nil, newError(ErrValidation, "trainer %d does not belong to location %d", trainerID, locationID)
+		}
+		return []Trainer{trainer}, nil
+	}
+
+	if locationID == 0 {
+		return nil, newError(ErrValidation, "trainer or location is required")
+	}
+	if _, ok := a.locations[locationID]; !ok {
+		return nil, newError(ErrLocationNotFound, "location %d does not exist", locationID)
+	}
+
+	var trainers []Trainer
+	for _, trainer := range a.trainers {
+		if trainer.LocationID == locationID {
+			trainers = append(trainers, trainer)
+		}
+	}
+	sort.Slice(trainers, func(i, j int) bool { return trainers[i].ID < trainers[j].ID })
+	return trainers, nil
+}
+
+// formatHour formats a 24 hour clock hour as 8am, 5pm etc.
+func formatHour(hour int) string {
+	switch {
+	case hour == 0 || hour == 24:
+		return "12am"
+	case hour < 12:
+		return fmt.Sprintf("%dam", hour)
+	case hour == 12:
+		return "12pm"
+	default:
+		return fmt.Sprintf("%dpm", hour-12)
+	}
+}
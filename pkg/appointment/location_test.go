@@ -0,0 +1,138 @@
+package appointment
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLocationAppointments(t *testing.T) *scheduledAppointments {
+	downtown := Location{ID: 1, TimeZone: "America/New_York", OpeningHours: OpeningHours{Open: 6, Close: 20}}
+	require.NoError(t, downtown.init())
+	eastside := Location{ID: 2, OpeningHours: OpeningHours{Open: 8, Close: 17}}
+	require.NoError(t, eastside.init())
+
+	return &scheduledAppointments{
+		appointmentsList: []Appointment{
+			{
+				ID:         1,
+				TrainerID:  1,
+				LocationID: 1,
+				StartTime:  time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC),
+				EndTime:    time.Date(2022, 1, 1, 9, 30, 0, 0, time.UTC),
+			},
+			{
+				ID:         2,
+				TrainerID:  3,
+				LocationID: 2,
+				StartTime:  time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC),
+				EndTime:    time.Date(2022, 1, 1, 9, 30, 0, 0, time.UTC),
+			},
+		},
+		trainers: map[int]Trainer{
+			1: {ID: 1, LocationID: 1},
+			2: {ID: 2, LocationID: 1},
+			3: {ID: 3, LocationID: 2},
+		},
+		locations: map[int]Location{1: downtown, 2: eastside},
+	}
+}
+
+func TestLocationInit(t *testing.T) {
+	t.Run("invalid time zone", func(t *testing.T) {
+		location := Location{ID: 1, TimeZone: "Mars/Olympus_Mons", OpeningHours: OpeningHours{Open: 8, Close: 17}}
+		assert.ErrorContains(t, location.init(), "invalid time zone")
+	})
+	t.Run("invalid opening hours", func(t *testing.T) {
+		location := Location{ID: 1, OpeningHours: OpeningHours{Open: 17, Close: 8}}
+		assert.ErrorContains(t, location.init(), "invalid opening hours")
+	})
+}
+
+func TestValidateStartAndEndTime_LocationHours(t *testing.T) {
+	a := newLocationAppointments(t)
+
+	// 12:00 UTC is 7am in New York which is inside the downtown opening hours
+	start := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	err := validateStartAndEndTime(start, start.Add(30*time.Minute), a.locations[1])
+	require.NoError(t, err)
+
+	// 10:00 UTC is 5am in New York
+	start = time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)
+	err = validateStartAndEndTime(start, start.Add(30*time.Minute), a.locations[1])
+	assert.EqualError(t, err, "appointment time must be between 6am and 8pm")
+}
+
+func TestGetAvailableAppointments_Location(t *testing.T) {
+	a := newLocationAppointments(t)
+
+	available, err := a.GetAvailableAppointments(Appointment{
+		StartTime:  time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC),
+		EndTime:    time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC),
+		LocationID: 2,
+	})
+	require.NoError(t, err)
+	require.Len(t, available, 1)
+	assert.Equal(t, 3, available[0].TrainerID)
+	assert.Equal(t, 2, available[0].LocationID)
+	assert.Equal(t, time.Date(2022, 1, 1, 9, 30, 0, 0, time.UTC), available[0].StartTime)
+}
+
+func TestGetAvailableAppointments_TrainerNotAtLocation(t *testing.T) {
+	a := newLocationAppointments(t)
+
+	_, err := a.GetAvailableAppointments(Appointment{
+		StartTime:  time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC),
+		EndTime:    time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC),
+		TrainerID:  1,
+		LocationID: 2,
+	})
+	assert.EqualError(t, err, "trainer 1 does not belong to location 2")
+}
+
+func TestGetScheduledAppointments_Location(t *testing.T) {
+	a := newLocationAppointments(t)
+
+	appointments, err := a.GetScheduledAppointments(Appointment{LocationID: 1})
+	require.NoError(t, err)
+	require.Len(t, appointments, 1)
+	assert.Equal(t, 1, appointments[0].ID)
+
+	_, err = a.GetScheduledAppointments(Appointment{LocationID: 5})
+	assert.EqualError(t, err, "location 5 does not exist")
+}
+
+func TestCreateAppointment_SetsLocation(t *testing.T) {
+	a := newLocationAppointments(t)
+
+	_, err := a.CreateAppointment(Appointment{
+		TrainerID: 2,
+		StartTime: time.Date(2022, 1, 1, 14, 0, 0, 0, time.UTC),
+		EndTime:   time.Date(2022, 1, 1, 14, 30, 0, 0, time.UTC),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, a.appointmentsList[len(a.appointmentsList)-1].LocationID)
+}
+
+func TestGetBookingLocation(t *testing.T) {
+	a := newLocationAppointments(t)
+
+	location, err := a.GetBookingLocation(1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, location.ID)
+	assert.Equal(t, "America/New_York", location.Zone().String())
+
+	location, err = a.GetBookingLocation(0, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, location.ID)
+	assert.Nil(t, location.Zone())
+
+	_, err = a.GetBookingLocation(4, 0)
+	assert.ErrorIs(t, err, ErrTrainerNotFound)
+	_, err = a.GetBookingLocation(0, 3)
+	assert.ErrorIs(t, err, ErrLocationNotFound)
+	_, err = a.GetBookingLocation(3, 1)
+	assert.ErrorIs(t, err, ErrValidation)
+}
@@ -0,0 +1,74 @@
+package appointment
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// MessageTypes are the notification types a gym can write templates for, the same as notification.Types
+var MessageTypes = []string{"booking_confirmation", "reminder"}
+
+type (
+	// MessageTemplate is a gym's own wording of a notification, the parts left empty use the built in wording.
+	// Subject and Text are text/template and HTML is html/template, they are executed with a notification.Data.
+	MessageTemplate struct {
+		Subject string `json:"subject,omitempty"`
+		Text    string `json:"text,omitempty"`
+		HTML    string `json:"html,omitempty"`
+	}
+
+	// MessageTemplates is the gym's wording of each notification type by locale, like templates["es"]["reminder"]
+	MessageTemplates map[string]map[string]MessageTemplate
+)
+
+// init writes the locales like notifications look them up, lower case with a hyphen so es-MX and es_mx are the same,
+// and parses every template so mistakes are found when the server starts rather than when a message is sent.
+// A type that isn't a notification, like a misspelled "remider", is an error rather than wording that is never used.
+func (t *MessageTemplates) init() error {
+	templates := make(MessageTemplates, len(*t))
+	for locale, types := range *t {
+		key := strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+		if _, ok := templates[key]; ok {
+			return fmt.Errorf("templates for locale %s are defined more than once", key)
+		}
+		templates[key] = types
+	}
+	*t = templates
+
+	for locale, types := range *t {
+		for typ, msg := range types {
+			name := locale + "/" + typ
+			if !slices.Contains(MessageTypes, typ) {
+				return fmt.Errorf("unknown notification type %q in the %s templates, it must be one of %s", typ, locale, strings.Join(MessageTypes, ", "))
+			}
+			if _, err := template.New(name).Parse(msg.Subject); err != nil {
+				return fmt.Errorf("invalid %s subject template: %w", name, err)
+			}
+			if _, err := template.New(name).Parse(msg.Text); err != nil {
+				return fmt.Errorf("invalid %s text template: %w", name, err)
+			}
+			if _, err := htmltemplate.New(name).Parse(msg.HTML); err != nil {
+				return fmt.Errorf("invalid %s html template: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// GetMessageTemplates returns the gym's notification wording from templates.json
+func (a *scheduledAppointments) GetMessageTemplates() (MessageTemplates, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	templates := make(MessageTemplates, len(a.messageTemplates))
+	for locale, types := range a.messageTemplates {
+		templates[locale] = make(map[string]MessageTemplate, len(types))
+		for typ, msg := range types {
+			templates[locale][typ] = msg
+		}
+	}
+	return templates, nil
+}
@@ -0,0 +1,52 @@
+package appointment
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageTemplates(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "appointments.json"), `{"version": 2, "appointments": []}`)
+	writeFile(t, filepath.Join(dir, "users.json"), `[{"id": 5, "name": "Sam", "locale": "es-MX"}]`)
+	writeFile(t, filepath.Join(dir, "templates.json"), `{"es": {"reminder": {"subject": "¡Hola {{.User.Name}}!"}}}`)
+
+	a, err := newAppointmentManager(dir)
+	require.NoError(t, err)
+	templates, err := a.GetMessageTemplates()
+	require.NoError(t, err)
+	assert.Equal(t, MessageTemplates{"es": {"reminder": {Subject: "¡Hola {{.User.Name}}!"}}}, templates)
+	user, err := a.GetUser(5)
+	require.NoError(t, err)
+	assert.Equal(t, "es-MX", user.Locale)
+
+	// Changing the copy doesn't change the manager's templates
+	templates["es"]["reminder"] = MessageTemplate{}
+	templates, err = a.GetMessageTemplates()
+	require.NoError(t, err)
+	assert.NotEmpty(t, templates["es"]["reminder"].Subject)
+
+	// Locales are matched without case like the users' locales
+	writeFile(t, filepath.Join(dir, "templates.json"), `{"es_MX": {"reminder": {"subject": "¡Hola!"}}}`)
+	a, err = newAppointmentManager(dir)
+	require.NoError(t, err)
+	templates, err = a.GetMessageTemplates()
+	require.NoError(t, err)
+	assert.Equal(t, MessageTemplates{"es-mx": {"reminder": {Subject: "¡Hola!"}}}, templates)
+
+	writeFile(t, filepath.Join(dir, "templates.json"), `{"es-MX": {"reminder": {}}, "es-mx": {"reminder": {}}}`)
+	_, err = newAppointmentManager(dir)
+	assert.EqualError(t, err, "templates for locale es-mx are defined more than once")
+
+	writeFile(t, filepath.Join(dir, "templates.json"), `{"es": {"remider": {"subject": "¡Hola!"}}}`)
+	_, err = newAppointmentManager(dir)
+	assert.ErrorContains(t, err, `unknown notification type "remider"`)
+
+	// A template that doesn't parse stops the server starting
+	writeFile(t, filepath.Join(dir, "templates.json"), `{"es": {"reminder": {"html": "<p>{{.User.Name</p>"}}}`)
+	_, err = newAppointmentManager(dir)
+	assert.ErrorContains(t, err, "invalid es/reminder html template")
+}
@@ -1,8 +1,21 @@
 package appointment
 
+import "time"
+
 type MockAppointmentManager struct {
 	AppointmentsList []Appointment
+	LocationsList    []Location
+	BusyBlocks       []BusyBlock
+	Webhooks         []Webhook
+	Outbox           []Delivery
+	DeadLetters      []Delivery
+	Events           []Event
+	Users            []User
+	MessageTemplates MessageTemplates
+	APIKeys          []APIKey
 	Err              error
+	// EventBus lets tests publish events to the mock's subscribers
+	EventBus
 }
 
 func NewMockAppointmentManager(AppointmentsList []Appointment, err error) *MockAppointmentManager {
@@ -20,18 +33,297 @@ func (m *MockAppointmentManager) GetAvailableAppointments(appReq Appointment) ([
 	return m.AppointmentsList, nil
 }
 
-func (m *MockAppointmentManager) CreateAppointment(app Appointment) error {
+func (m *MockAppointmentManager) CreateAppointment(app Appointment) (Appointment, error) {
+	if m.Err != nil {
+		return Appointment{}, m.Err
+	}
+
+	return app, nil
+}
+
+func (m *MockAppointmentManager) TransitionAppointment(id int, action Action) (Appointment, error) {
+	if m.Err != nil {
+		return Appointment{}, m.Err
+	}
+
+	return Appointment{ID: id}, nil
+}
+
+func (m *MockAppointmentManager) GetScheduledAppointments(appReq Appointment) ([]Appointment, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	return m.AppointmentsList, nil
+}
+
+func (m *MockAppointmentManager) ListScheduledAppointments(query ScheduleQuery) (SchedulePage, error) {
+	if m.Err != nil {
+		return SchedulePage{}, m.Err
+	}
+
+	return SchedulePage{Appointments: m.AppointmentsList}, nil
+}
+
+func (m *MockAppointmentManager) GetLocations() ([]Location, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	return m.LocationsList, nil
+}
+
+func (m *MockAppointmentManager) GetBookingLocation(trainerID int, locationID int) (Location, error) {
+	if m.Err != nil {
+		return Location{}, m.Err
+	}
+
+	for _, location := range m.LocationsList {
+		if location.ID == locationID {
+			return location, nil
+		}
+	}
+	return defaultLocation, nil
+}
+
+func (m *MockAppointmentManager) GetAttendanceRecord(userID int) (AttendanceRecord, error) {
+	if m.Err != nil {
+		return AttendanceRecord{}, m.Err
+	}
+
+	return AttendanceRecord{UserID: userID}, nil
+}
+
+func (m *MockAppointmentManager) GetAppointment(id int) (Appointment, error) {
+	if m.Err != nil {
+		return Appointment{}, m.Err
+	}
+
+	for _, app := range m.AppointmentsList {
+		if app.ID == id {
+			return app, nil
+		}
+	}
+	return Appointment{ID: id}, nil
+}
+
+func (m *MockAppointmentManager) UpdateAppointment(changes Appointment, version int) (Appointment, error) {
+	if m.Err != nil {
+		return Appointment{}, m.Err
+	}
+
+	return changes, nil
+}
+
+func (m *MockAppointmentManager) DeleteAppointment(id int, version int) error {
+	return m.Err
+}
+
+func (m *MockAppointmentManager) CreateAppointments(apps []Appointment, atomic bool) ([]BatchResult, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	results := make([]BatchResult, len(apps))
+	for i, app := range apps {
+		results[i].Appointment = app
+	}
+	return results, nil
+}
+
+func (m *MockAppointmentManager) CheckAppointments(apps []Appointment) ([]BatchResult, error) {
+	return m.CreateAppointments(apps, false)
+}
+
+func (m *MockAppointmentManager) GetBusyBlocks(trainerID int) ([]BusyBlock, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	return m.BusyBlocks, nil
+}
+
+func (m *MockAppointmentManager) ImportBusyBlocks(trainerID int, uids []string, blocks []BusyBlock) error {
 	if m.Err != nil {
 		return m.Err
 	}
 
+	m.BusyBlocks = blocks
 	return nil
 }
 
-func (m *MockAppointmentManager) GetScheduledAppointments(trainerID int) ([]Appointment, error) {
+func (m *MockAppointmentManager) GetFreeBusy(trainerID int, from time.Time, to time.Time) ([]Interval, error) {
 	if m.Err != nil {
 		return nil, m.Err
 	}
 
-	return m.AppointmentsList, nil
+	var busy []Interval
+	for _, app := range m.AppointmentsList {
+		busy = append(busy, Interval{StartTime: app.StartTime, EndTime: app.EndTime})
+	}
+	return busy, nil
+}
+
+func (m *MockAppointmentManager) CreateWebhook(webhook Webhook) (Webhook, error) {
+	if m.Err != nil {
+		return Webhook{}, m.Err
+	}
+
+	webhook.ID = len(m.Webhooks) + 1
+	m.Webhooks = append(m.Webhooks, webhook)
+	return webhook, nil
+}
+
+func (m *MockAppointmentManager) GetWebhooks() ([]Webhook, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	return m.Webhooks, nil
+}
+
+func (m *MockAppointmentManager) DeleteWebhook(id int) error {
+	if m.Err != nil {
+		return m.Err
+	}
+
+	for i, webhook := range m.Webhooks {
+		if webhook.ID == id {
+			m.Webhooks = append(m.Webhooks[:i], m.Webhooks[i+1:]...)
+			return nil
+		}
+	}
+	return newError(ErrWebhookNotFound, "webhook %d does not exist", id)
+}
+
+func (m *MockAppointmentManager) DueDeliveries(now time.Time, limit int) ([]Delivery, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	var due []Delivery
+	waiting := make(map[int]bool)
+	for _, delivery := range m.Outbox {
+		switch {
+		case waiting[delivery.WebhookID]:
+		case delivery.NextAttemptAt.After(now):
+			waiting[delivery.WebhookID] = true
+		case len(due) < limit:
+			due = append(due, delivery)
+		}
+	}
+	return due, nil
+}
+
+func (m *MockAppointmentManager) DeliveryDone(id int) error {
+	if m.Err != nil {
+		return m.Err
+	}
+
+	i, err := deliveryIndex(m.Outbox, id)
+	if err != nil {
+		return err
+	}
+	m.Outbox = append(m.Outbox[:i], m.Outbox[i+1:]...)
+	return nil
+}
+
+func (m *MockAppointmentManager) DeliveryFailed(id int, reason string, retryAt time.Time) error {
+	if m.Err != nil {
+		return m.Err
+	}
+
+	i, err := deliveryIndex(m.Outbox, id)
+	if err != nil {
+		return err
+	}
+	m.Outbox[i].Attempts++
+	m.Outbox[i].LastError = reason
+	m.Outbox[i].NextAttemptAt = retryAt
+	if retryAt.IsZero() {
+		m.DeadLetters = append(m.DeadLetters, m.Outbox[i])
+		m.Outbox = append(m.Outbox[:i], m.Outbox[i+1:]...)
+	}
+	return nil
+}
+
+func (m *MockAppointmentManager) GetDeadLetters() ([]Delivery, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	return m.DeadLetters, nil
+}
+
+func (m *MockAppointmentManager) RetryDeadLetter(id int) error {
+	if m.Err != nil {
+		return m.Err
+	}
+
+	i, err := deliveryIndex(m.DeadLetters, id)
+	if err != nil {
+		return err
+	}
+	delivery := m.DeadLetters[i]
+	delivery.Attempts = 0
+	m.DeadLetters = append(m.DeadLetters[:i], m.DeadLetters[i+1:]...)
+	m.Outbox = append(m.Outbox, delivery)
+	return nil
+}
+
+func (m *MockAppointmentManager) EventsAfter(id int) (EventFeed, error) {
+	if m.Err != nil {
+		return EventFeed{}, m.Err
+	}
+
+	// The mock's events never change so there is never a next one
+	feed := EventFeed{Next: make(chan struct{})}
+	for _, event := range m.Events {
+		if id >= 0 && event.ID > id {
+			feed.Events = append(feed.Events, event)
+		}
+		feed.LatestID = event.ID
+	}
+	return feed, nil
+}
+
+func (m *MockAppointmentManager) GetUser(id int) (User, error) {
+	if m.Err != nil {
+		return User{}, m.Err
+	}
+
+	for _, user := range m.Users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return User{}, newError(ErrUserNotFound, "user %d does not exist", id)
+}
+
+func (m *MockAppointmentManager) GetUpcomingAppointments(from time.Time) ([]Appointment, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	var upcoming []Appointment
+	for _, app := range m.AppointmentsList {
+		if app.Status.upcoming() && !app.StartTime.Before(from) {
+			upcoming = append(upcoming, app)
+		}
+	}
+	return upcoming, nil
+}
+
+func (m *MockAppointmentManager) GetMessageTemplates() (MessageTemplates, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return m.MessageTemplates, nil
+}
+
+func (m *MockAppointmentManager) GetAPIKeys() ([]APIKey, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return m.APIKeys, nil
 }
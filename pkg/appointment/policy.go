@@ -0,0 +1,131 @@
+package appointment
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DefaultSessionType is used for appointments booked without a session type
+const DefaultSessionType = "standard"
+
+type (
+	// CancellationPolicy decides when cancelling a session is free and what a late cancellation costs
+	CancellationPolicy struct {
+		// FreeCancellationWindow is how long before the start an appointment can still be cancelled without a penalty
+		FreeCancellationWindow Duration `json:"free_cancellation_window"`
+		// LateCancelFee is charged, in cents, for cancelling inside the window
+		LateCancelFee int `json:"late_cancel_fee"`
+		// LateCancelCountsAsNoShow counts late cancellations towards the no-show threshold
+		LateCancelCountsAsNoShow bool `json:"late_cancel_counts_as_no_show"`
+	}
+
+	// Policies holds the cancellation policy for each session type and when users are blocked from booking
+	Policies struct {
+		SessionTypes map[string]CancellationPolicy `json:"session_types"`
+		// NoShowThreshold blocks users with this many no-shows from booking, zero never blocks
+		NoShowThreshold int `json:"no_show_threshold"`
+	}
+
+	// AttendanceRecord is a user's late cancellations and no-shows
+	AttendanceRecord struct {
+		UserID            int  `json:"user_id"`
+		LateCancellations int  `json:"late_cancellations"`
+		NoShows           int  `json:"no_shows"`
+		LateCancelFees    int  `json:"late_cancel_fees"`
+		BookingBlocked    bool `json:"booking_blocked"`
+	}
+
+	// Duration is a time.Duration that is written as a string like 24h in json files
+	Duration struct {
+		time.Duration
+	}
+)
+
+// defaultCancellationPolicy is our 24 hour cancellation policy, used for any session type without its own policy
+var defaultCancellationPolicy = CancellationPolicy{FreeCancellationWindow: Duration{24 * time.Hour}}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like 24h: %w", err)
+	}
+
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+// cancellationPolicy returns the policy for the session type
+func (p Policies) cancellationPolicy(sessionType string) (CancellationPolicy, error) {
+	if sessionType == "" {
+		sessionType = DefaultSessionType
+	}
+	if policy, ok := p.SessionTypes[sessionType]; ok {
+		return policy, nil
+	}
+	if sessionType == DefaultSessionType {
+		return defaultCancellationPolicy, nil
+	}
+	return CancellationPolicy{}, newError(ErrValidation, "unknown session type %s", sessionType)
+}
+
+// GetAttendanceRecord returns the user's late cancellations and no-shows
+func (a *scheduledAppointments) GetAttendanceRecord(userID int) (AttendanceRecord, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	return a.attendanceRecord(userID), nil
+}
+
+// attendanceRecord counts the user's late cancellations and no-shows and works out if they can still book
+func (a *scheduledAppointments) attendanceRecord(userID int) AttendanceRecord {
+	record := AttendanceRecord{UserID: userID}
+	strikes := 0
+	for _, app := range a.appointmentsList {
+		if app.UserID != userID {
+			continue
+		}
+
+		if app.Status == StatusNoShow {
+			record.NoShows++
+			strikes++
+		}
+		if app.LateCancellation {
+			record.LateCancellations++
+			record.LateCancelFees += app.LateCancelFee
+			if policy, err := a.policies.cancellationPolicy(app.SessionType); err == nil && policy.LateCancelCountsAsNoShow {
+				strikes++
+			}
+		}
+	}
+
+	record.BookingBlocked = a.policies.NoShowThreshold > 0 && strikes >= a.policies.NoShowThreshold
+	return record
+}
+
+// applyCancellationPolicy marks the appointment as a late cancellation and charges the fee if it is cancelled inside the free window.
+// Only confirmed appointments can be cancelled late, pending and tentative bookings were never committed to.
+func (a *scheduledAppointments) applyCancellationPolicy(app *Appointment, now time.Time) error {
+	if app.Status != StatusConfirmed {
+		return nil
+	}
+
+	policy, err := a.policies.cancellationPolicy(app.SessionType)
+	if err != nil {
+		return err
+	}
+
+	if now.After(app.StartTime.Add(-policy.FreeCancellationWindow.Duration)) {
+		app.LateCancellation = true
+		app.LateCancelFee = policy.LateCancelFee
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package appointment
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPolicyAppointments(now time.Time) *scheduledAppointments {
+	a := newStatusAppointments(now)
+	a.policies = Policies{
+		SessionTypes: map[string]CancellationPolicy{
+			"assessment": {FreeCancellationWindow: Duration{48 * time.Hour}, LateCancelFee: 5000, LateCancelCountsAsNoShow: true},
+		},
+		NoShowThreshold: 2,
+	}
+	return a
+}
+
+func TestDuration_JSON(t *testing.T) {
+	var policy CancellationPolicy
+	require.NoError(t, json.Unmarshal([]byte(`{"free_cancellation_window": "36h"}`), &policy))
+	assert.Equal(t, 36*time.Hour, policy.FreeCancellationWindow.Duration)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"free_cancellation_window": 36}`), &policy))
+}
+
+func TestCancellationPolicy(t *testing.T) {
+	now := time.Date(2022, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	t.Run("cancelling outside the free window", func(t *testing.T) {
+		a := newPolicyAppointments(now)
+		start := now.Add(25 * time.Hour)
+		app, err := a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+		require.NoError(t, err)
+		assert.Equal(t, DefaultSessionType, app.SessionType)
+
+		app, err = a.TransitionAppointment(app.ID, ActionCancel)
+		require.NoError(t, err)
+		assert.False(t, app.LateCancellation)
+	})
+	t.Run("cancelling inside the free window", func(t *testing.T) {
+		a := newPolicyAppointments(now)
+		start := now.Add(30 * time.Hour)
+		app, err := a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute), SessionType: "assessment"})
+		require.NoError(t, err)
+
+		app, err = a.TransitionAppointment(app.ID, ActionCancel)
+		require.NoError(t, err)
+		assert.True(t, app.LateCancellation)
+		assert.Equal(t, 5000, app.LateCancelFee)
+
+		record, err := a.GetAttendanceRecord(1)
+		require.NoError(t, err)
+		assert.Equal(t, AttendanceRecord{UserID: 1, LateCancellations: 1, LateCancelFees: 5000}, record)
+	})
+	t.Run("unknown session type", func(t *testing.T) {
+		a := newPolicyAppointments(now)
+		start := now.Add(30 * time.Hour)
+		_, err := a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute), SessionType: "yoga"})
+		assert.EqualError(t, err, "unknown session type yoga")
+	})
+}
+
+func TestNoShowThreshold(t *testing.T) {
+	now := time.Date(2022, 1, 1, 8, 0, 0, 0, time.UTC)
+	a := newPolicyAppointments(now)
+
+	// one no-show and one late cancellation that counts as a no-show reaches the threshold of 2
+	start := now.Add(time.Hour)
+	app, err := a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+	require.NoError(t, err)
+	_, err = a.TransitionAppointment(app.ID, ActionNoShow)
+	require.NoError(t, err)
+
+	start = start.Add(time.Hour)
+	app, err = a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute), SessionType: "assessment"})
+	require.NoError(t, err)
+	_, err = a.TransitionAppointment(app.ID, ActionCancel)
+	require.NoError(t, err)
+
+	record, err := a.GetAttendanceRecord(1)
+	require.NoError(t, err)
+	assert.True(t, record.BookingBlocked)
+
+	start = start.Add(time.Hour)
+	_, err = a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+	assert.EqualError(t, err, "user 1 is blocked from booking after too many no-shows")
+
+	// other users can still book
+	_, err = a.CreateAppointment(Appointment{TrainerID: 1, UserID: 2, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+	require.NoError(t, err)
+}
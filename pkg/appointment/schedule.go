@@ -0,0 +1,187 @@
+package appointment
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page sizes for ListScheduledAppointments
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+type (
+	// ScheduleQuery selects a page of scheduled appointments.
+	// At least one of the trainer, location or user is required, the other filters are optional.
+	ScheduleQuery struct {
+		TrainerID  int
+		LocationID int
+		UserID     int
+		// Statuses only returns appointments in one of these statuses
+		Statuses []Status
+		// From and To only return appointments starting in [From, To)
+		From time.Time
+		To   time.Time
+		// Descending returns the latest appointments first
+		Descending bool
+		// Limit is the page size, zero uses DefaultPageSize
+		Limit int
+		// Cursor continues from the end of the page it was returned with
+		Cursor string
+	}
+
+	// SchedulePage is a page of appointments, NextCursor is empty on the last page
+	SchedulePage struct {
+		Appointments []Appointment
+		NextCursor   string
+	}
+
+	// scheduleCursor is the position of the last appointment on a page.
+	// Appointments are ordered by start time then ID so the position is still valid after other appointments are booked.
+	scheduleCursor struct {
+		startTime time.Time
+		id        int
+	}
+)
+
+// ListScheduledAppointments returns a page of the appointments matching the query ordered by start time
+func (a *scheduledAppointments) ListScheduledAppointments(query ScheduleQuery) (SchedulePage, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	a.expirePendingRequests()
+	return a.listScheduledAppointments(query)
+}
+
+// listScheduledAppointments finds the page of appointments for the query, a negative limit returns every appointment
+func (a *scheduledAppointments) listScheduledAppointments(query ScheduleQuery) (SchedulePage, error) {
+	if query.TrainerID != 0 {
+		if _, ok := a.trainers[query.TrainerID]; !ok {
+			return SchedulePage{}, newError(ErrTrainerNotFound, "trainer %d does not exist", query.TrainerID)
+		}
+	}
+	if query.LocationID != 0 {
+		if _, ok := a.locations[query.LocationID]; !ok {
+			return SchedulePage{}, newError(ErrLocationNotFound, "location %d does not exist", query.LocationID)
+		}
+	}
+	if query.TrainerID == 0 && query.LocationID == 0 && query.UserID == 0 {
+		return SchedulePage{}, newError(ErrValidation, "trainer, location or user is required")
+	}
+	for _, status := range query.Statuses {
+		if !status.valid() {
+			return SchedulePage{}, newError(ErrValidation, "unknown status %s", status)
+		}
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		return SchedulePage{}, newError(ErrValidation, "from must be before to")
+	}
+
+	limit := query.Limit
+	switch {
+	case limit == 0:
+		limit = DefaultPageSize
+	case limit > MaxPageSize:
+		return SchedulePage{}, newError(ErrValidation, "limit must be at most %d", MaxPageSize)
+	}
+
+	var after *scheduleCursor
+	if query.Cursor != "" {
+		cursor, err := decodeScheduleCursor(query.Cursor)
+		if err != nil {
+			return SchedulePage{}, err
+		}
+		after = &cursor
+	}
+
+	var appointments []Appointment
+	for _, app := range a.appointmentsList {
+		if query.matches(app) && (after == nil || after.before(app, query.Descending)) {
+			appointments = append(appointments, app)
+		}
+	}
+	sort.Slice(appointments, func(i, j int) bool {
+		return scheduleCursor{appointments[i].StartTime, appointments[i].ID}.before(appointments[j], query.Descending)
+	})
+
+	var page SchedulePage
+	if limit > 0 && len(appointments) > limit {
+		appointments = appointments[:limit]
+		last := appointments[limit-1]
+		page.NextCursor = scheduleCursor{last.StartTime, last.ID}.encode()
+	}
+	page.Appointments = appointments
+	return page, nil
+}
+
+// matches reports whether the appointment passes the query's filters
+func (q ScheduleQuery) matches(app Appointment) bool {
+	if q.TrainerID != 0 && app.TrainerID != q.TrainerID {
+		return false
+	}
+	if q.LocationID != 0 && app.LocationID != q.LocationID {
+		return false
+	}
+	if q.UserID != 0 && app.UserID != q.UserID {
+		return false
+	}
+	if !q.From.IsZero() && app.StartTime.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !app.StartTime.Before(q.To) {
+		return false
+	}
+	if len(q.Statuses) == 0 {
+		return true
+	}
+	for _, status := range q.Statuses {
+		if app.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// before reports whether the cursor position comes before the appointment in the sort order
+func (c scheduleCursor) before(app Appointment, descending bool) bool {
+	if c.id == app.ID && c.startTime.Equal(app.StartTime) {
+		return false
+	}
+	if !c.startTime.Equal(app.StartTime) {
+		return c.startTime.Before(app.StartTime) != descending
+	}
+	return (c.id < app.ID) != descending
+}
+
+// encode returns the cursor as an opaque string for clients to send back
+func (c scheduleCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", c.startTime.UnixNano(), c.id)))
+}
+
+// decodeScheduleCursor reads a cursor made by encode
+func decodeScheduleCursor(s string) (scheduleCursor, error) {
+	invalid := newError(ErrValidation, "invalid cursor")
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return scheduleCursor{}, invalid
+	}
+
+	start, id, ok := strings.Cut(string(b), ":")
+	if !ok {
+		return scheduleCursor{}, invalid
+	}
+	nanos, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return scheduleCursor{}, invalid
+	}
+	appID, err := strconv.Atoi(id)
+	if err != nil {
+		return scheduleCursor{}, invalid
+	}
+	return scheduleCursor{startTime: time.Unix(0, nanos), id: appID}, nil
+}
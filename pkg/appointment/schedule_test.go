@@ -0,0 +1,99 @@
+package appointment
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newScheduleAppointments() *scheduledAppointments {
+	day := time.Date(2022, 1, 3, 9, 0, 0, 0, time.UTC)
+	return &scheduledAppointments{
+		appointmentsList: []Appointment{
+			{ID: 1, TrainerID: 1, UserID: 1, StartTime: day.Add(48 * time.Hour), Status: StatusConfirmed},
+			{ID: 2, TrainerID: 1, UserID: 2, StartTime: day, Status: StatusCancelled},
+			{ID: 3, TrainerID: 1, UserID: 1, StartTime: day.Add(24 * time.Hour), Status: StatusConfirmed},
+			{ID: 4, TrainerID: 2, UserID: 1, StartTime: day, Status: StatusNoShow},
+			{ID: 5, TrainerID: 1, UserID: 3, StartTime: day, Status: StatusPending},
+		},
+		trainers: map[int]Trainer{1: {ID: 1}, 2: {ID: 2}},
+	}
+}
+
+func ids(appointments []Appointment) []int {
+	var ids []int
+	for _, app := range appointments {
+		ids = append(ids, app.ID)
+	}
+	return ids
+}
+
+func TestListScheduledAppointments_Filters(t *testing.T) {
+	a := newScheduleAppointments()
+	day := time.Date(2022, 1, 3, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		query ScheduleQuery
+		ids   []int
+	}{
+		{"trainer in start order", ScheduleQuery{TrainerID: 1}, []int{2, 5, 3, 1}},
+		{"user across trainers", ScheduleQuery{UserID: 1}, []int{4, 3, 1}},
+		{"trainer and user", ScheduleQuery{TrainerID: 1, UserID: 1}, []int{3, 1}},
+		{"statuses", ScheduleQuery{TrainerID: 1, Statuses: []Status{StatusConfirmed, StatusPending}}, []int{5, 3, 1}},
+		{"date range", ScheduleQuery{TrainerID: 1, From: day.Add(24 * time.Hour), To: day.Add(48 * time.Hour)}, []int{3}},
+		{"descending", ScheduleQuery{TrainerID: 1, Descending: true}, []int{1, 3, 5, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := a.ListScheduledAppointments(tt.query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.ids, ids(page.Appointments))
+			assert.Empty(t, page.NextCursor)
+		})
+	}
+}
+
+func TestListScheduledAppointments_Pages(t *testing.T) {
+	for _, descending := range []bool{false, true} {
+		a := newScheduleAppointments()
+		query := ScheduleQuery{TrainerID: 1, Limit: 3, Descending: descending}
+
+		first, err := a.ListScheduledAppointments(query)
+		require.NoError(t, err)
+		require.Len(t, first.Appointments, 3)
+		require.NotEmpty(t, first.NextCursor)
+
+		// an appointment booked before the cursor doesn't move the next page
+		a.appointmentsList = append(a.appointmentsList, Appointment{ID: 6, TrainerID: 1, StartTime: first.Appointments[0].StartTime})
+
+		query.Cursor = first.NextCursor
+		second, err := a.ListScheduledAppointments(query)
+		require.NoError(t, err)
+		assert.Empty(t, second.NextCursor)
+
+		all := append(ids(first.Appointments), ids(second.Appointments)...)
+		if descending {
+			assert.Equal(t, []int{1, 3, 5, 2}, all)
+		} else {
+			assert.Equal(t, []int{2, 5, 3, 1}, all)
+		}
+	}
+}
+
+func TestListScheduledAppointments_Errors(t *testing.T) {
+	a := newScheduleAppointments()
+
+	_, err := a.ListScheduledAppointments(ScheduleQuery{})
+	assert.ErrorIs(t, err, ErrValidation)
+	_, err = a.ListScheduledAppointments(ScheduleQuery{TrainerID: 9})
+	assert.ErrorIs(t, err, ErrTrainerNotFound)
+	_, err = a.ListScheduledAppointments(ScheduleQuery{TrainerID: 1, Statuses: []Status{"booked"}})
+	assert.EqualError(t, err, "unknown status booked")
+	_, err = a.ListScheduledAppointments(ScheduleQuery{TrainerID: 1, Cursor: "not a cursor"})
+	assert.EqualError(t, err, "invalid cursor")
+	_, err = a.ListScheduledAppointments(ScheduleQuery{TrainerID: 1, Limit: MaxPageSize + 1})
+	assert.ErrorIs(t, err, ErrValidation)
+}
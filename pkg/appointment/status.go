@@ -0,0 +1,204 @@
+package appointment
+
+import (
+	"time"
+)
+
+type (
+	// Status is where an appointment is in its lifecycle
+	Status string
+
+	// Action is something that happens to an appointment and moves it to a new status
+	Action string
+
+	// StatusChange records when an appointment moved to a status
+	StatusChange struct {
+		Status Status    `json:"status"`
+		At     time.Time `json:"at"`
+	}
+
+	// transition lists the statuses an action can be taken from and the status it moves the appointment to
+	transition struct {
+		from []Status
+		to   Status
+	}
+)
+
+const (
+	// StatusPending is a booking request holding a slot until the trainer accepts or declines it
+	StatusPending   Status = "pending"
+	StatusTentative Status = "tentative"
+	StatusConfirmed Status = "confirmed"
+	StatusCheckedIn Status = "checked_in"
+	StatusCompleted Status = "completed"
+	StatusNoShow    Status = "no_show"
+	StatusCancelled Status = "cancelled"
+	StatusDeclined  Status = "declined"
+	StatusExpired   Status = "expired"
+)
+
+// approvalTimeout is how long a booking request holds its slot before it expires, requests also expire when the appointment starts
+const approvalTimeout = 24 * time.Hour
+
+const (
+	ActionConfirm  Action = "confirm"
+	ActionCheckIn  Action = "check_in"
+	ActionComplete Action = "complete"
+	ActionNoShow   Action = "no_show"
+	ActionCancel   Action = "cancel"
+	ActionAccept   Action = "accept"
+	ActionDecline  Action = "decline"
+	// actionExpire is taken by the manager when a booking request is not answered in time
+	actionExpire Action = "expire"
+)
+
+// transitions is the appointment state machine
+//
+//	tentative -> confirmed -> checked_in -> completed
+//	pending -> confirmed/declined/expired
+//	pending/tentative/confirmed -> cancelled
+//	confirmed -> no_show
+var transitions = map[Action]transition{
+	ActionConfirm:  {from: []Status{StatusTentative}, to: StatusConfirmed},
+	ActionCheckIn:  {from: []Status{StatusConfirmed}, to: StatusCheckedIn},
+	ActionComplete: {from: []Status{StatusCheckedIn}, to: StatusCompleted},
+	ActionNoShow:   {from: []Status{StatusConfirmed}, to: StatusNoShow},
+	ActionCancel:   {from: []Status{StatusPending, StatusTentative, StatusConfirmed}, to: StatusCancelled},
+	ActionAccept:   {from: []Status{StatusPending}, to: StatusConfirmed},
+	ActionDecline:  {from: []Status{StatusPending}, to: StatusDeclined},
+	actionExpire:   {from: []Status{StatusPending}, to: StatusExpired},
+}
+
+// blocksSlot reports whether an appointment in this status occupies the trainer's time
+func (s Status) blocksSlot() bool {
+	switch s {
+	case StatusCancelled, StatusDeclined, StatusExpired:
+		return false
+	default:
+		return true
+	}
+}
+
+// upcoming reports whether an appointment in this status hasn't happened or been called off yet, only these can be rescheduled
+func (s Status) upcoming() bool {
+	switch s {
+	case StatusPending, StatusTentative, StatusConfirmed:
+		return true
+	default:
+		return false
+	}
+}
+
+// valid reports whether s is one of the statuses above
+func (s Status) valid() bool {
+	switch s {
+	case StatusPending, StatusTentative, StatusConfirmed, StatusCheckedIn, StatusCompleted, StatusNoShow, StatusCancelled, StatusDeclined, StatusExpired:
+		return true
+	default:
+		return false
+	}
+}
+
+// TransitionAppointment applies the action to the appointment and returns the updated appointment
+func (a *scheduledAppointments) TransitionAppointment(id int, action Action) (Appointment, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	a.expirePendingRequests()
+
+	i, err := a.appointmentIndex(id)
+	if err != nil {
+		return Appointment{}, err
+	}
+
+	t, ok := transitions[action]
+	if !ok || action == actionExpire {
+		return Appointment{}, newError(ErrValidation, "unknown action %s", action)
+	}
+
+	app := &a.appointmentsList[i]
+	if !t.allowedFrom(app.Status) {
+		return Appointment{}, newError(ErrInvalidTransition, "cannot %s an appointment that is %s", action, app.Status)
+	}
+
+	previous := *app
+	now := a.currentTime()
+	if action == ActionCancel {
+		if err := a.applyCancellationPolicy(app, now); err != nil {
+			return Appointment{}, err
+		}
+	}
+
+	mark := a.markOutbox()
+	app.setStatus(t.to, now)
+	a.emit(statusEvent(t.to), previous, *app, now)
+	if err := a.save(); err != nil {
+		*app = previous
+		a.rollbackOutbox(mark)
+		return Appointment{}, err
+	}
+	return *app, nil
+}
+
+// expirePendingRequests expires booking requests the trainer didn't answer in time so their slots are released.
+// The expiries are saved before their events are published like any other change,
+// if saving fails the requests are left pending and expired again on the next call.
+func (a *scheduledAppointments) expirePendingRequests() {
+	now := a.currentTime()
+	mark := a.markOutbox()
+	previous := map[int]Appointment{}
+	for i := range a.appointmentsList {
+		app := &a.appointmentsList[i]
+		if app.Status == StatusPending && app.ExpiresAt != nil && !now.Before(*app.ExpiresAt) {
+			previous[i] = *app
+			app.setStatus(transitions[actionExpire].to, *app.ExpiresAt)
+			a.emit(statusEvent(StatusExpired), previous[i], *app, *app.ExpiresAt)
+		}
+	}
+	if len(previous) == 0 {
+		return
+	}
+
+	if err := a.save(); err != nil {
+		for i, app := range previous {
+			a.appointmentsList[i] = app
+		}
+		a.rollbackOutbox(mark)
+	}
+}
+
+// requestExpiry returns when a booking request made now for an appointment starting at start expires
+func requestExpiry(now time.Time, start time.Time) time.Time {
+	expiresAt := now.Add(approvalTimeout)
+	if start.Before(expiresAt) {
+		return start
+	}
+	return expiresAt
+}
+
+// allowedFrom reports whether the transition can be taken from status
+func (t transition) allowedFrom(status Status) bool {
+	for _, from := range t.from {
+		if from == status {
+			return true
+		}
+	}
+	return false
+}
+
+// setStatus moves the appointment to status and records when it happened
+func (app *Appointment) setStatus(status Status, at time.Time) {
+	app.Version++
+	app.Status = status
+	app.StatusHistory = append(app.StatusHistory, StatusChange{Status: status, At: at})
+}
+
+// appointmentIndex returns the index of the appointment in the list
+func (a *scheduledAppointments) appointmentIndex(id int) (int, error) {
+	for i, app := range a.appointmentsList {
+		if app.ID == id {
+			return i, nil
+		}
+	}
+	return 0, newError(ErrAppointmentNotFound, "appointment %d does not exist", id)
+}
@@ -0,0 +1,196 @@
+package appointment
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStatusAppointments(now time.Time) *scheduledAppointments {
+	return &scheduledAppointments{
+		now:      func() time.Time { return now },
+		trainers: map[int]Trainer{1: {ID: 1}},
+	}
+}
+
+func TestTransitionAppointment(t *testing.T) {
+	now := time.Date(2022, 1, 1, 8, 0, 0, 0, time.UTC)
+	start := time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	t.Run("full lifecycle", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		app, err := a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute), Status: StatusTentative})
+		require.NoError(t, err)
+		assert.Equal(t, StatusTentative, app.Status)
+
+		for _, action := range []Action{ActionConfirm, ActionCheckIn, ActionComplete} {
+			app, err = a.TransitionAppointment(app.ID, action)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, StatusCompleted, app.Status)
+		assert.Equal(t, []StatusChange{
+			{Status: StatusTentative, At: now},
+			{Status: StatusConfirmed, At: now},
+			{Status: StatusCheckedIn, At: now},
+			{Status: StatusCompleted, At: now},
+		}, app.StatusHistory)
+	})
+	t.Run("illegal transition", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		app, err := a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+		require.NoError(t, err)
+		assert.Equal(t, StatusConfirmed, app.Status)
+
+		_, err = a.TransitionAppointment(app.ID, ActionComplete)
+		assert.EqualError(t, err, "cannot complete an appointment that is confirmed")
+
+		_, err = a.TransitionAppointment(app.ID, ActionNoShow)
+		require.NoError(t, err)
+		_, err = a.TransitionAppointment(app.ID, ActionCancel)
+		assert.EqualError(t, err, "cannot cancel an appointment that is no_show")
+	})
+	t.Run("unknown appointment", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		_, err := a.TransitionAppointment(5, ActionConfirm)
+		assert.EqualError(t, err, "appointment 5 does not exist")
+	})
+}
+
+func TestCancelledAppointmentReleasesSlot(t *testing.T) {
+	start := time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)
+	a := newStatusAppointments(start)
+
+	app, err := a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+	require.NoError(t, err)
+
+	request := Appointment{TrainerID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)}
+	available, err := a.GetAvailableAppointments(request)
+	require.NoError(t, err)
+	assert.Empty(t, available)
+
+	_, err = a.TransitionAppointment(app.ID, ActionCancel)
+	require.NoError(t, err)
+
+	available, err = a.GetAvailableAppointments(request)
+	require.NoError(t, err)
+	assert.Len(t, available, 1)
+
+	_, err = a.CreateAppointment(Appointment{TrainerID: 1, UserID: 2, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+	require.NoError(t, err)
+}
+
+func TestBookingRequests(t *testing.T) {
+	now := time.Date(2022, 1, 1, 8, 0, 0, 0, time.UTC)
+	start := time.Date(2022, 1, 3, 9, 0, 0, 0, time.UTC)
+	request := Appointment{TrainerID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)}
+
+	newApprovalAppointments := func() *scheduledAppointments {
+		a := newStatusAppointments(now)
+		a.trainers[1] = Trainer{ID: 1, RequiresApproval: true}
+		return a
+	}
+
+	t.Run("pending request holds the slot until accepted", func(t *testing.T) {
+		a := newApprovalAppointments()
+		app, err := a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+		require.NoError(t, err)
+		assert.Equal(t, StatusPending, app.Status)
+		require.NotNil(t, app.ExpiresAt)
+		assert.Equal(t, now.Add(approvalTimeout), *app.ExpiresAt)
+
+		available, err := a.GetAvailableAppointments(request)
+		require.NoError(t, err)
+		assert.Empty(t, available)
+
+		app, err = a.TransitionAppointment(app.ID, ActionAccept)
+		require.NoError(t, err)
+		assert.Equal(t, StatusConfirmed, app.Status)
+	})
+	t.Run("declined request releases the slot", func(t *testing.T) {
+		a := newApprovalAppointments()
+		app, err := a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+		require.NoError(t, err)
+
+		_, err = a.TransitionAppointment(app.ID, ActionDecline)
+		require.NoError(t, err)
+
+		available, err := a.GetAvailableAppointments(request)
+		require.NoError(t, err)
+		assert.Len(t, available, 1)
+	})
+	t.Run("unanswered request expires and releases the slot", func(t *testing.T) {
+		a := newApprovalAppointments()
+		app, err := a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+		require.NoError(t, err)
+
+		later := now.Add(approvalTimeout)
+		a.now = func() time.Time { return later }
+
+		available, err := a.GetAvailableAppointments(request)
+		require.NoError(t, err)
+		assert.Len(t, available, 1)
+
+		_, err = a.TransitionAppointment(app.ID, ActionAccept)
+		assert.EqualError(t, err, "cannot accept an appointment that is expired")
+	})
+	t.Run("only pending requests can be accepted", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		app, err := a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+		require.NoError(t, err)
+
+		_, err = a.TransitionAppointment(app.ID, ActionAccept)
+		assert.EqualError(t, err, "cannot accept an appointment that is confirmed")
+	})
+}
+
+func TestRequestExpiry(t *testing.T) {
+	now := time.Date(2022, 1, 1, 8, 0, 0, 0, time.UTC)
+	assert.Equal(t, now.Add(approvalTimeout), requestExpiry(now, now.Add(48*time.Hour)))
+	assert.Equal(t, now.Add(time.Hour), requestExpiry(now, now.Add(time.Hour)))
+}
+
+func TestExpirePendingRequests_SavedBeforePublished(t *testing.T) {
+	now := time.Date(2022, 1, 1, 8, 0, 0, 0, time.UTC)
+	start := time.Date(2022, 1, 3, 9, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "appointments.json"), `{"version": 2, "appointments": []}`)
+	a, err := newAppointmentManager(dir)
+	require.NoError(t, err)
+	a.now = func() time.Time { return now }
+	a.trainers[1] = Trainer{ID: 1, RequiresApproval: true}
+	app, err := a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+	require.NoError(t, err)
+
+	var events []DomainEvent
+	record := func(event DomainEvent) { events = append(events, event) }
+	a.Subscribe(record)
+	now = now.Add(approvalTimeout)
+
+	// An expiry that isn't saved isn't published, the request stays pending until it is
+	path := a.path
+	a.path = filepath.Join(dir, "missing", "appointments.json")
+	got, err := a.GetAppointment(app.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusPending, got.Status)
+	assert.Empty(t, events)
+
+	a.path = path
+	got, err = a.GetAppointment(app.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusExpired, got.Status)
+	require.Len(t, events, 1)
+	assert.Equal(t, statusEvent(StatusExpired), events[0].Base().Type)
+
+	// After a restart the expiry is read back rather than published again
+	reloaded, err := newAppointmentManager(dir)
+	require.NoError(t, err)
+	reloaded.now = a.now
+	reloaded.Subscribe(record)
+	got, err = reloaded.GetAppointment(app.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusExpired, got.Status)
+	assert.Len(t, events, 1)
+}
@@ -0,0 +1,143 @@
+package appointment
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// appointmentsFileVersion is the current format of appointments.json
+//
+//	1 a json array of appointments with started_at and ended_at
+//	2 an object with the version and the appointments, which use starts_at and ends_at like the requests
+const appointmentsFileVersion = 2
+
+type (
+	// appointmentsFile is what appointments.json holds
+	appointmentsFile struct {
+		Version      int           `json:"version"`
+		Appointments []Appointment `json:"appointments"`
+		// LatestID is kept so the ID of a deleted appointment isn't given to a new one, files without it use the highest ID
+		LatestID int `json:"latest_id,omitempty"`
+		// The outbox is kept with the appointments so an event is saved with the change that caused it
+		LatestEventID    int        `json:"latest_event_id,omitempty"`
+		LatestDeliveryID int        `json:"latest_delivery_id,omitempty"`
+		Outbox           []Delivery `json:"outbox,omitempty"`
+		DeadLetters      []Delivery `json:"dead_letters,omitempty"`
+	}
+
+	// legacyAppointment reads an appointment from a version 1 file
+	legacyAppointment struct {
+		Appointment
+		StartedAt time.Time `json:"started_at"`
+		EndedAt   time.Time `json:"ended_at"`
+	}
+)
+
+// loadAppointments reads the appointments file at path, migrated is true when the file is in an older format
+func loadAppointments(path string) (file appointmentsFile, migrated bool, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return file, false, err
+	}
+
+	// Version 1 files are just the list of appointments
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		var legacy []legacyAppointment
+		if err := json.Unmarshal(b, &legacy); err != nil {
+			return file, false, fmt.Errorf("error decoding %s: %w", path, err)
+		}
+
+		file.Appointments = make([]Appointment, 0, len(legacy))
+		for _, l := range legacy {
+			app := l.Appointment
+			app.StartTime, app.EndTime = l.StartedAt, l.EndedAt
+			file.Appointments = append(file.Appointments, app)
+		}
+		return file, true, nil
+	}
+
+	if err := json.Unmarshal(b, &file); err != nil {
+		return appointmentsFile{}, false, fmt.Errorf("error decoding %s: %w", path, err)
+	}
+	if file.Version != appointmentsFileVersion {
+		return appointmentsFile{}, false, fmt.Errorf("%s has unsupported version %d", path, file.Version)
+	}
+	return file, false, nil
+}
+
+// save writes the appointments to the file they were read from, managers that weren't read from a file aren't saved
+func (a *scheduledAppointments) save() error {
+	if a.path == "" {
+		return nil
+	}
+	file := appointmentsFile{
+		Version:          appointmentsFileVersion,
+		Appointments:     a.appointmentsList,
+		LatestID:         a.latestID,
+		LatestEventID:    a.latestEventID,
+		LatestDeliveryID: a.latestDeliveryID,
+		Outbox:           a.outbox,
+		DeadLetters:      a.deadLetters,
+	}
+	if err := writeJSONFile(a.path, file); err != nil {
+		return fmt.Errorf("error saving appointments: %w", err)
+	}
+	return nil
+}
+
+// saveBusyBlocks writes the busy blocks next to the appointments, managers that weren't read from a file aren't saved
+func (a *scheduledAppointments) saveBusyBlocks() error {
+	if a.busyPath == "" {
+		return nil
+	}
+	if err := writeJSONFile(a.busyPath, a.busyBlocks); err != nil {
+		return fmt.Errorf("error saving busy blocks: %w", err)
+	}
+	return nil
+}
+
+// saveWebhooks writes the webhooks next to the appointments, managers that weren't read from a file aren't saved
+func (a *scheduledAppointments) saveWebhooks() error {
+	if a.webhooksPath == "" {
+		return nil
+	}
+	if err := writeJSONFile(a.webhooksPath, webhooksFile{LatestID: a.latestWebhookID, Webhooks: a.webhooks}); err != nil {
+		return fmt.Errorf("error saving webhooks: %w", err)
+	}
+	return nil
+}
+
+// writeJSONFile writes v to path as indented json.
+// The file is written to a temporary file first and renamed over the old one so a failed write doesn't lose what was in it.
+func writeJSONFile(path string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	// Keep the permissions of the file being replaced, temporary files are only readable by us
+	if info, err := os.Stat(path); err == nil {
+		if err := tmp.Chmod(info.Mode()); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,103 @@
+package appointment
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAppointmentManager_MigratesLegacyFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "appointments.json"), `[
+		{"id": 1, "user_id": 1, "trainer_id": 1, "started_at": "2019-01-24T09:00:00-08:00", "ended_at": "2019-01-24T09:30:00-08:00"}
+	]`)
+
+	a, err := newAppointmentManager(dir)
+	require.NoError(t, err)
+	require.Len(t, a.appointmentsList, 1)
+	assert.True(t, a.appointmentsList[0].StartTime.Equal(time.Date(2019, 1, 24, 17, 0, 0, 0, time.UTC)))
+	assert.True(t, a.appointmentsList[0].EndTime.Equal(time.Date(2019, 1, 24, 17, 30, 0, 0, time.UTC)))
+	assert.Equal(t, 1, a.appointmentsList[0].Version)
+
+	file, migrated, err := loadAppointments(filepath.Join(dir, "appointments.json"))
+	require.NoError(t, err)
+	assert.False(t, migrated)
+	assert.Equal(t, a.appointmentsList, file.Appointments)
+}
+
+func TestLoadAppointments_UnsupportedVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appointments.json")
+	writeFile(t, path, `{"version": 3, "appointments": []}`)
+
+	_, _, err := loadAppointments(path)
+	assert.EqualError(t, err, path+" has unsupported version 3")
+}
+
+func TestCreateAppointment_Saves(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "appointments.json"), `{"version": 2, "appointments": []}`)
+	a, err := newAppointmentManager(dir)
+	require.NoError(t, err)
+	a.trainers[1] = Trainer{ID: 1}
+
+	start := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	app, err := a.CreateAppointment(Appointment{StartTime: start, EndTime: start.Add(30 * time.Minute), TrainerID: 1, UserID: 2})
+	require.NoError(t, err)
+	_, err = a.TransitionAppointment(app.ID, ActionCancel)
+	require.NoError(t, err)
+
+	reloaded, err := newAppointmentManager(dir)
+	require.NoError(t, err)
+	require.Len(t, reloaded.appointmentsList, 1)
+	assert.Equal(t, app.ID, reloaded.appointmentsList[0].ID)
+	assert.Equal(t, StatusCancelled, reloaded.appointmentsList[0].Status)
+	assert.Equal(t, 2, reloaded.appointmentsList[0].Version)
+	assert.Equal(t, app.ID, reloaded.latestID)
+}
+
+func TestDeleteAppointment_KeepsLatestID(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "appointments.json"), `{"version": 2, "appointments": []}`)
+	a, err := newAppointmentManager(dir)
+	require.NoError(t, err)
+	a.trainers[1] = Trainer{ID: 1}
+
+	start := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	first, err := a.CreateAppointment(Appointment{StartTime: start, EndTime: start.Add(30 * time.Minute), TrainerID: 1, UserID: 2})
+	require.NoError(t, err)
+	deleted, err := a.CreateAppointment(Appointment{StartTime: start.Add(time.Hour), EndTime: start.Add(90 * time.Minute), TrainerID: 1, UserID: 2})
+	require.NoError(t, err)
+	require.NoError(t, a.DeleteAppointment(deleted.ID, AnyVersion))
+
+	// The deleted appointment's ID isn't used again after a restart
+	reloaded, err := newAppointmentManager(dir)
+	require.NoError(t, err)
+	reloaded.trainers[1] = Trainer{ID: 1}
+	app, err := reloaded.CreateAppointment(Appointment{StartTime: start.Add(2 * time.Hour), EndTime: start.Add(150 * time.Minute), TrainerID: 1, UserID: 2})
+	require.NoError(t, err)
+	assert.Equal(t, deleted.ID+1, app.ID)
+	assert.Greater(t, deleted.ID, first.ID)
+}
+
+func TestCreateAppointment_SaveFailure(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "appointments.json"), `{"version": 2, "appointments": []}`)
+	a, err := newAppointmentManager(dir)
+	require.NoError(t, err)
+	a.trainers[1] = Trainer{ID: 1}
+
+	// Saving fails once the directory the file is written to is gone
+	a.path = filepath.Join(dir, "missing", "appointments.json")
+	start := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	_, err = a.CreateAppointment(Appointment{StartTime: start, EndTime: start.Add(30 * time.Minute), TrainerID: 1, UserID: 2})
+	require.Error(t, err)
+	assert.Empty(t, a.appointmentsList)
+	assert.Zero(t, a.latestID)
+
+	_, err = os.Stat(a.path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
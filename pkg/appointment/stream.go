@@ -0,0 +1,62 @@
+package appointment
+
+// eventBufferSize is how many recent events each manager keeps for streams to catch up from
+const eventBufferSize = 1000
+
+// EventFeed is the recent events after an ID for following the schedule as it changes
+type EventFeed struct {
+	Events []Event
+	// LatestID is the ID of the latest event, ask for the events after it to carry on
+	LatestID int
+	// Missed is set when events after the ID have left the buffer or were from before a restart, the follower has to start over
+	Missed bool
+	// Next is closed when there might be events after LatestID
+	Next <-chan struct{}
+}
+
+// EventsAfter returns the events after id that are still in the buffer.
+// A negative id returns no events, only the latest ID to follow on from.
+func (a *scheduledAppointments) EventsAfter(id int) (EventFeed, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	a.expirePendingRequests()
+
+	if a.changed == nil {
+		a.changed = make(chan struct{})
+	}
+	feed := EventFeed{LatestID: a.latestEventID, Next: a.changed}
+	if id < 0 || id >= a.latestEventID {
+		return feed, nil
+	}
+
+	// The buffer is in ID order so the events after id are at the end
+	i := len(a.recent)
+	for i > 0 && a.recent[i-1].ID > id {
+		i--
+	}
+	feed.Events = append([]Event{}, a.recent[i:]...)
+	feed.Missed = len(feed.Events) == 0 || feed.Events[0].ID > id+1
+	return feed, nil
+}
+
+// bufferEvent adds the event to the recent events and wakes anything waiting for it
+func (a *scheduledAppointments) bufferEvent(event Event) {
+	a.recent = append(a.recent, event)
+	if len(a.recent) > eventBufferSize {
+		a.recent = append([]Event{}, a.recent[len(a.recent)-eventBufferSize:]...)
+	}
+	if a.changed != nil {
+		close(a.changed)
+		a.changed = nil
+	}
+}
+
+// unbufferEvents removes the events after id from the recent events when the change that made them is rolled back
+func (a *scheduledAppointments) unbufferEvents(id int) {
+	i := len(a.recent)
+	for i > 0 && a.recent[i-1].ID > id {
+		i--
+	}
+	a.recent = a.recent[:i]
+}
@@ -0,0 +1,52 @@
+package appointment
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsAfter(t *testing.T) {
+	now := time.Date(2022, 1, 1, 8, 0, 0, 0, time.UTC)
+	start := time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)
+	a := newStatusAppointments(now)
+
+	feed, err := a.EventsAfter(-1)
+	require.NoError(t, err)
+	assert.Empty(t, feed.Events)
+	assert.Zero(t, feed.LatestID)
+
+	app, err := a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+	require.NoError(t, err)
+	select {
+	case <-feed.Next:
+	default:
+		t.Fatal("next was not closed by the new event")
+	}
+
+	_, err = a.TransitionAppointment(app.ID, ActionCancel)
+	require.NoError(t, err)
+	// A check doesn't book anything so its events are taken back
+	_, err = a.CheckAppointments([]Appointment{{TrainerID: 1, UserID: 2, StartTime: start, EndTime: start.Add(30 * time.Minute)}})
+	require.NoError(t, err)
+
+	feed, err = a.EventsAfter(1)
+	require.NoError(t, err)
+	require.Len(t, feed.Events, 1)
+	assert.Equal(t, EventType("appointment.cancelled"), feed.Events[0].Type)
+	assert.Equal(t, 2, feed.LatestID)
+	assert.False(t, feed.Missed)
+
+	feed, err = a.EventsAfter(2)
+	require.NoError(t, err)
+	assert.Empty(t, feed.Events)
+	assert.False(t, feed.Missed)
+
+	// Events from before the buffer, like before a restart, can't be caught up on
+	a.recent = a.recent[1:]
+	feed, err = a.EventsAfter(0)
+	require.NoError(t, err)
+	assert.True(t, feed.Missed)
+}
@@ -0,0 +1,229 @@
+package appointment
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultTenantID is the tenant used when tenants.json does not exist and the deployment only hosts one business
+const DefaultTenantID = "default"
+
+type (
+	// Tenant is an independent business hosted on the deployment.
+	// Requests are matched to a tenant by one of its API keys, hosts or its ID in a header.
+	Tenant struct {
+		ID    string   `json:"id"`
+		Hosts []string `json:"hosts"`
+		// APIKeys are admin keys for the tenant, keys with other roles are hashed in the tenant's api_keys.json
+		APIKeys []string `json:"api_keys"`
+		DataDir string   `json:"data_dir"`
+	}
+
+	tenantKey struct {
+		tenantID string
+		key      APIKey
+	}
+
+	// Tenants holds a separate Manager for every tenant.
+	// Each manager loads its own data directory and keeps its own ID sequence so one tenant can never see
+	// or conflict with another tenant's trainers and appointments.
+	Tenants struct {
+		managers map[string]Manager
+		hosts    map[string]string
+		apiKeys  map[string]string
+		// keys are the keys in each tenant's api_keys.json by hash
+		keys map[string]tenantKey
+		// secured are the tenants that have keys in tenants.json or api_keys.json
+		secured map[string]bool
+		// defaultID is only set when there is a single tenant so requests that don't identify a tenant can still be served
+		defaultID string
+	}
+)
+
+// NewTenants reads tenants.json and creates a manager for each tenant from its data directory.
+// Without a tenants.json the deployment is single tenant and the data is read from the working directory.
+func NewTenants() (*Tenants, error) {
+	return newTenants(".")
+}
+
+// newTenants reads tenants.json in dir, relative tenant data directories are relative to dir
+func newTenants(dir string) (*Tenants, error) {
+	var tenantList []Tenant
+	err := decodeJSONFile(filepath.Join(dir, "tenants.json"), &tenantList)
+	if errors.Is(err, os.ErrNotExist) {
+		manager, err := newAppointmentManager(dir)
+		if err != nil {
+			return nil, err
+		}
+		return NewSingleTenant(manager), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tenants := &Tenants{
+		managers: make(map[string]Manager),
+		hosts:    make(map[string]string),
+		apiKeys:  make(map[string]string),
+		keys:     make(map[string]tenantKey),
+		secured:  make(map[string]bool),
+	}
+	for _, tenant := range tenantList {
+		if tenant.ID == "" {
+			return nil, fmt.Errorf("tenant is missing an id")
+		}
+		if _, ok := tenants.managers[tenant.ID]; ok {
+			return nil, fmt.Errorf("tenant %s is defined more than once", tenant.ID)
+		}
+
+		dataDir := tenant.DataDir
+		if dataDir == "" {
+			dataDir = filepath.Join("tenants", tenant.ID)
+		}
+		if !filepath.IsAbs(dataDir) {
+			dataDir = filepath.Join(dir, dataDir)
+		}
+		manager, err := newAppointmentManager(dataDir)
+		if err != nil {
+			return nil, fmt.Errorf("error loading tenant %s: %w", tenant.ID, err)
+		}
+		tenants.managers[tenant.ID] = manager
+		if err := tenants.addKeys(tenant.ID, manager); err != nil {
+			return nil, err
+		}
+
+		for _, host := range tenant.Hosts {
+			if other, ok := tenants.hosts[strings.ToLower(host)]; ok {
+				return nil, fmt.Errorf("host %s is used by tenants %s and %s", host, other, tenant.ID)
+			}
+			tenants.hosts[strings.ToLower(host)] = tenant.ID
+		}
+		for _, key := range tenant.APIKeys {
+			if _, ok := tenants.apiKeys[key]; ok {
+				return nil, fmt.Errorf("tenant %s reuses an api key that belongs to another tenant", tenant.ID)
+			}
+			tenants.apiKeys[key] = tenant.ID
+			tenants.secured[tenant.ID] = true
+		}
+	}
+
+	if len(tenantList) == 1 {
+		tenants.defaultID = tenantList[0].ID
+	}
+	return tenants, nil
+}
+
+// NewSingleTenant wraps a single manager as the default tenant
+func NewSingleTenant(manager Manager) *Tenants {
+	tenants := &Tenants{
+		managers:  map[string]Manager{DefaultTenantID: manager},
+		hosts:     map[string]string{},
+		apiKeys:   map[string]string{},
+		keys:      map[string]tenantKey{},
+		secured:   map[string]bool{},
+		defaultID: DefaultTenantID,
+	}
+	// A single tenant has nothing to share keys with, the stored manager never fails to list them
+	// and a mock that is set up to fail is left open
+	_ = tenants.addKeys(DefaultTenantID, manager)
+	return tenants
+}
+
+// NewMultiTenant wraps managers as tenants by ID without hosts or tenants.json keys,
+// requests find their tenant by the tenant header or a key from the tenant's api_keys.json
+func NewMultiTenant(managers map[string]Manager) (*Tenants, error) {
+	tenants := &Tenants{
+		managers: make(map[string]Manager, len(managers)),
+		hosts:    map[string]string{},
+		apiKeys:  map[string]string{},
+		keys:     map[string]tenantKey{},
+		secured:  map[string]bool{},
+	}
+	for tenantID, manager := range managers {
+		tenants.managers[tenantID] = manager
+		if err := tenants.addKeys(tenantID, manager); err != nil {
+			return nil, err
+		}
+	}
+	if len(managers) == 1 {
+		for tenantID := range managers {
+			tenants.defaultID = tenantID
+		}
+	}
+	return tenants, nil
+}
+
+// addKeys indexes the tenant's api keys by hash so a request's key finds its tenant
+func (t *Tenants) addKeys(tenantID string, manager Manager) error {
+	keys, err := manager.GetAPIKeys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if other, ok := t.keys[key.Hash]; ok {
+			return fmt.Errorf("api key %s of tenant %s has the same key as %s of tenant %s", key.ID, tenantID, other.key.ID, other.tenantID)
+		}
+		t.keys[key.Hash] = tenantKey{tenantID: tenantID, key: key}
+		t.secured[tenantID] = true
+	}
+	return nil
+}
+
+// Manager returns the manager for the tenant
+func (t *Tenants) Manager(tenantID string) (Manager, error) {
+	manager, ok := t.managers[tenantID]
+	if !ok {
+		return nil, newError(ErrTenantNotFound, "tenant %s does not exist", tenantID)
+	}
+	return manager, nil
+}
+
+// IDs returns the IDs of every tenant in order
+func (t *Tenants) IDs() []string {
+	ids := make([]string, 0, len(t.managers))
+	for id := range t.managers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// TenantForHost returns the tenant that owns the host, the port is ignored
+func (t *Tenants) TenantForHost(host string) (string, bool) {
+	if i := strings.LastIndex(host, ":"); i != -1 && !strings.HasSuffix(host, "]") {
+		host = host[:i]
+	}
+	tenantID, ok := t.hosts[strings.ToLower(host)]
+	return tenantID, ok
+}
+
+// TenantForAPIKey returns the tenant that owns the api key
+func (t *Tenants) TenantForAPIKey(key string) (string, bool) {
+	tenantID, ok := t.apiKeys[key]
+	return tenantID, ok
+}
+
+// Authenticate returns the tenant and the key for an api key. Keys in tenants.json are admin keys.
+func (t *Tenants) Authenticate(key string) (string, APIKey, bool) {
+	if found, ok := t.keys[HashAPIKey(key)]; ok {
+		return found.tenantID, found.key, true
+	}
+	if tenantID, ok := t.apiKeys[key]; ok {
+		return tenantID, APIKey{ID: "tenant:" + tenantID, Role: RoleAdmin}, true
+	}
+	return "", APIKey{}, false
+}
+
+// HasAPIKeys reports whether the tenant has any keys, in tenants.json or its api_keys.json
+func (t *Tenants) HasAPIKeys(tenantID string) bool {
+	return t.secured[tenantID]
+}
+
+// DefaultTenant returns the tenant to use when a request doesn't identify one, this is only set for single tenant deployments
+func (t *Tenants) DefaultTenant() (string, bool) {
+	return t.defaultID, t.defaultID != ""
+}
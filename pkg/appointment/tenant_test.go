@@ -0,0 +1,114 @@
+package appointment
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path string, contents string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+}
+
+func newTestTenants(t *testing.T) *Tenants {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "tenants.json"), `[
+		{"id": "acme", "hosts": ["acme.example.com"], "api_keys": ["acme-key"]},
+		{"id": "globex", "hosts": ["globex.example.com"], "api_keys": ["globex-key"]}
+	]`)
+	writeFile(t, filepath.Join(dir, "tenants", "acme", "appointments.json"), `[
+		{"id": 1, "user_id": 1, "trainer_id": 1, "started_at": "2019-01-24T09:00:00-08:00", "ended_at": "2019-01-24T09:30:00-08:00"}
+	]`)
+	writeFile(t, filepath.Join(dir, "tenants", "globex", "appointments.json"), `[
+		{"id": 7, "user_id": 2, "trainer_id": 2, "started_at": "2019-01-24T09:00:00-08:00", "ended_at": "2019-01-24T09:30:00-08:00"}
+	]`)
+
+	tenants, err := newTenants(dir)
+	require.NoError(t, err)
+	return tenants
+}
+
+func TestNewTenants_SingleTenant(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "appointments.json"), `[]`)
+
+	tenants, err := newTenants(dir)
+	require.NoError(t, err)
+
+	tenantID, ok := tenants.DefaultTenant()
+	require.True(t, ok)
+	assert.Equal(t, DefaultTenantID, tenantID)
+
+	_, err = tenants.Manager(DefaultTenantID)
+	require.NoError(t, err)
+}
+
+func TestTenants_Resolve(t *testing.T) {
+	tenants := newTestTenants(t)
+
+	tenantID, ok := tenants.TenantForHost("globex.example.com:8000")
+	require.True(t, ok)
+	assert.Equal(t, "globex", tenantID)
+
+	tenantID, ok = tenants.TenantForAPIKey("acme-key")
+	require.True(t, ok)
+	assert.Equal(t, "acme", tenantID)
+
+	_, ok = tenants.TenantForAPIKey("unknown")
+	assert.False(t, ok)
+
+	_, ok = tenants.DefaultTenant()
+	assert.False(t, ok)
+
+	_, err := tenants.Manager("initech")
+	assert.Error(t, err)
+}
+
+func TestTenants_Isolation(t *testing.T) {
+	tenants := newTestTenants(t)
+
+	acme, err := tenants.Manager("acme")
+	require.NoError(t, err)
+	globex, err := tenants.Manager("globex")
+	require.NoError(t, err)
+
+	// globex's trainer is unknown to acme
+	_, err = acme.GetScheduledAppointments(Appointment{TrainerID: 2})
+	assert.EqualError(t, err, "trainer 2 does not exist")
+
+	// both tenants can book the same time and each has its own ID sequence
+	start := time.Date(2019, 1, 24, 11, 0, 0, 0, time.UTC)
+	_, err = acme.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+	require.NoError(t, err)
+	_, err = globex.CreateAppointment(Appointment{TrainerID: 2, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+	require.NoError(t, err)
+
+	acmeAppointments, err := acme.GetScheduledAppointments(Appointment{TrainerID: 1})
+	require.NoError(t, err)
+	require.Len(t, acmeAppointments, 2)
+	// the new booking starts before the one from the file
+	assert.Equal(t, 2, acmeAppointments[0].ID)
+
+	globexAppointments, err := globex.GetScheduledAppointments(Appointment{TrainerID: 2})
+	require.NoError(t, err)
+	require.Len(t, globexAppointments, 2)
+	assert.Equal(t, 8, globexAppointments[0].ID)
+}
+
+func TestNewTenants_DuplicateAPIKey(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "tenants.json"), `[
+		{"id": "acme", "api_keys": ["shared"]},
+		{"id": "globex", "api_keys": ["shared"]}
+	]`)
+	writeFile(t, filepath.Join(dir, "tenants", "acme", "appointments.json"), `[]`)
+	writeFile(t, filepath.Join(dir, "tenants", "globex", "appointments.json"), `[]`)
+
+	_, err := newTenants(dir)
+	assert.ErrorContains(t, err, "reuses an api key")
+}
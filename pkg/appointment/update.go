@@ -0,0 +1,112 @@
+package appointment
+
+// AnyVersion skips the version check when updating or deleting an appointment
+const AnyVersion = 0
+
+// GetAppointment returns the appointment with the ID
+func (a *scheduledAppointments) GetAppointment(id int) (Appointment, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	a.expirePendingRequests()
+
+	i, err := a.appointmentIndex(id)
+	if err != nil {
+		return Appointment{}, err
+	}
+	return a.appointmentsList[i], nil
+}
+
+// UpdateAppointment reschedules the appointment with the ID in changes or changes its session type, zero fields are left as they are.
+// The change is refused with ErrVersionMismatch if the appointment isn't at version any more, AnyVersion skips the check.
+func (a *scheduledAppointments) UpdateAppointment(changes Appointment, version int) (Appointment, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	a.expirePendingRequests()
+
+	i, err := a.appointmentIndex(changes.ID)
+	if err != nil {
+		return Appointment{}, err
+	}
+
+	app := &a.appointmentsList[i]
+	if err := app.checkVersion(version); err != nil {
+		return Appointment{}, err
+	}
+	if !app.Status.upcoming() {
+		return Appointment{}, newError(ErrInvalidTransition, "cannot change an appointment that is %s", app.Status)
+	}
+
+	updated := *app
+	if changes.StartTime.IsZero() != changes.EndTime.IsZero() {
+		return Appointment{}, newError(ErrValidation, "start and end time must be changed together")
+	}
+	if !changes.StartTime.IsZero() {
+		updated.StartTime, updated.EndTime = changes.StartTime, changes.EndTime
+		if err := a.checkSlot(updated, a.trainers[updated.TrainerID]); err != nil {
+			return Appointment{}, err
+		}
+		// A booking request still can't be answered after the appointment starts
+		if updated.ExpiresAt != nil && updated.StartTime.Before(*updated.ExpiresAt) {
+			expiresAt := updated.StartTime
+			updated.ExpiresAt = &expiresAt
+		}
+	}
+	if changes.SessionType != "" {
+		if _, err := a.policies.cancellationPolicy(changes.SessionType); err != nil {
+			return Appointment{}, err
+		}
+		updated.SessionType = changes.SessionType
+	}
+
+	updated.Version++
+	previous, mark := *app, a.markOutbox()
+	*app = updated
+	eventType := EventUpdated
+	if !updated.StartTime.Equal(previous.StartTime) || !updated.EndTime.Equal(previous.EndTime) {
+		eventType = EventRescheduled
+	}
+	a.emit(eventType, previous, updated, a.currentTime())
+	if err := a.save(); err != nil {
+		*app = previous
+		a.rollbackOutbox(mark)
+		return Appointment{}, err
+	}
+	return updated, nil
+}
+
+// DeleteAppointment removes the appointment from the schedule, it is for bookings made in error and skips the cancellation policy.
+// The appointment isn't deleted if it isn't at version any more, AnyVersion skips the check.
+func (a *scheduledAppointments) DeleteAppointment(id int, version int) error {
+	a.mu.Lock()
+	defer a.unlock()
+
+	a.expirePendingRequests()
+
+	i, err := a.appointmentIndex(id)
+	if err != nil {
+		return err
+	}
+	if err := a.appointmentsList[i].checkVersion(version); err != nil {
+		return err
+	}
+
+	previous, mark := a.appointmentsList, a.markOutbox()
+	a.appointmentsList = append(append([]Appointment{}, previous[:i]...), previous[i+1:]...)
+	a.emit(EventDeleted, previous[i], previous[i], a.currentTime())
+	if err := a.save(); err != nil {
+		a.appointmentsList = previous
+		a.rollbackOutbox(mark)
+		return err
+	}
+	return nil
+}
+
+// checkVersion returns ErrVersionMismatch if the appointment has changed since version
+func (app Appointment) checkVersion(version int) error {
+	if version != AnyVersion && version != app.Version {
+		return newError(ErrVersionMismatch, "appointment %d is at version %d, not %d", app.ID, app.Version, version)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package appointment
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppointmentVersion(t *testing.T) {
+	now := time.Date(2022, 1, 1, 8, 0, 0, 0, time.UTC)
+	start := time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)
+	a := newStatusAppointments(now)
+
+	app, err := a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute), Status: StatusTentative, Version: 7})
+	require.NoError(t, err)
+	assert.Equal(t, 1, app.Version)
+
+	app, err = a.TransitionAppointment(app.ID, ActionConfirm)
+	require.NoError(t, err)
+	assert.Equal(t, 2, app.Version)
+
+	got, err := a.GetAppointment(app.ID)
+	require.NoError(t, err)
+	assert.Equal(t, app, got)
+
+	_, err = a.GetAppointment(9)
+	assert.True(t, errors.Is(err, ErrAppointmentNotFound))
+}
+
+func TestUpdateAppointment(t *testing.T) {
+	now := time.Date(2022, 1, 1, 8, 0, 0, 0, time.UTC)
+	start := time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)
+	book := func(a *scheduledAppointments, start time.Time) Appointment {
+		app, err := a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+		require.NoError(t, err)
+		return app
+	}
+
+	t.Run("reschedule", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		app := book(a, start)
+
+		later := start.Add(time.Hour)
+		updated, err := a.UpdateAppointment(Appointment{ID: app.ID, StartTime: later, EndTime: later.Add(30 * time.Minute)}, app.Version)
+		require.NoError(t, err)
+		assert.Equal(t, later, updated.StartTime)
+		assert.Equal(t, DefaultSessionType, updated.SessionType)
+		assert.Equal(t, 2, updated.Version)
+
+		// The old slot is free again
+		available, err := a.GetAvailableAppointments(Appointment{TrainerID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+		require.NoError(t, err)
+		assert.Len(t, available, 1)
+	})
+	t.Run("same slot doesn't conflict with itself", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		app := book(a, start)
+
+		updated, err := a.UpdateAppointment(Appointment{ID: app.ID, StartTime: start, EndTime: start.Add(30 * time.Minute)}, AnyVersion)
+		require.NoError(t, err)
+		assert.Equal(t, 2, updated.Version)
+	})
+	t.Run("stale version", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		app := book(a, start)
+		_, err := a.UpdateAppointment(Appointment{ID: app.ID, SessionType: DefaultSessionType}, app.Version)
+		require.NoError(t, err)
+
+		_, err = a.UpdateAppointment(Appointment{ID: app.ID, SessionType: DefaultSessionType}, app.Version)
+		assert.True(t, errors.Is(err, ErrVersionMismatch))
+		assert.EqualError(t, err, "appointment 1 is at version 2, not 1")
+	})
+	t.Run("slot taken", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		app := book(a, start)
+		book(a, start.Add(time.Hour))
+
+		_, err := a.UpdateAppointment(Appointment{ID: app.ID, StartTime: start.Add(time.Hour), EndTime: start.Add(90 * time.Minute)}, app.Version)
+		assert.True(t, errors.Is(err, ErrSlotConflict))
+	})
+	t.Run("invalid changes", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		app := book(a, start)
+
+		_, err := a.UpdateAppointment(Appointment{ID: app.ID, StartTime: start.Add(time.Hour)}, app.Version)
+		assert.EqualError(t, err, "start and end time must be changed together")
+
+		_, err = a.UpdateAppointment(Appointment{ID: app.ID, StartTime: start, EndTime: start.Add(time.Hour)}, app.Version)
+		assert.EqualError(t, err, "appointment duration must be exactly 30 minutes")
+
+		_, err = a.UpdateAppointment(Appointment{ID: app.ID, SessionType: "yoga"}, app.Version)
+		assert.True(t, errors.Is(err, ErrValidation))
+
+		got, err := a.GetAppointment(app.ID)
+		require.NoError(t, err)
+		assert.Equal(t, app, got)
+	})
+	t.Run("finished appointment", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		app := book(a, start)
+		app, err := a.TransitionAppointment(app.ID, ActionCancel)
+		require.NoError(t, err)
+
+		_, err = a.UpdateAppointment(Appointment{ID: app.ID, StartTime: start.Add(time.Hour), EndTime: start.Add(90 * time.Minute)}, app.Version)
+		assert.True(t, errors.Is(err, ErrInvalidTransition))
+	})
+}
+
+func TestDeleteAppointment(t *testing.T) {
+	now := time.Date(2022, 1, 1, 8, 0, 0, 0, time.UTC)
+	start := time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)
+	a := newStatusAppointments(now)
+	app, err := a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+	require.NoError(t, err)
+
+	err = a.DeleteAppointment(app.ID, app.Version+1)
+	assert.True(t, errors.Is(err, ErrVersionMismatch))
+
+	require.NoError(t, a.DeleteAppointment(app.ID, app.Version))
+	_, err = a.GetAppointment(app.ID)
+	assert.True(t, errors.Is(err, ErrAppointmentNotFound))
+
+	err = a.DeleteAppointment(app.ID, AnyVersion)
+	assert.True(t, errors.Is(err, ErrAppointmentNotFound))
+}
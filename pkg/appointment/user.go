@@ -0,0 +1,46 @@
+package appointment
+
+import (
+	"sort"
+	"time"
+)
+
+// User is a client of the business, users.json has the ones that can be sent notifications
+type User struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+	// Locale is the language notifications are sent in, like es or es-MX, English when it is empty
+	Locale string `json:"locale,omitempty"`
+}
+
+// GetUser returns the user from users.json
+func (a *scheduledAppointments) GetUser(id int) (User, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	user, ok := a.users[id]
+	if !ok {
+		return User{}, newError(ErrUserNotFound, "user %d does not exist", id)
+	}
+	return user, nil
+}
+
+// GetUpcomingAppointments returns every appointment starting at or after from that hasn't been called off, ordered by start time
+func (a *scheduledAppointments) GetUpcomingAppointments(from time.Time) ([]Appointment, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	a.expirePendingRequests()
+
+	var upcoming []Appointment
+	for _, app := range a.appointmentsList {
+		if app.Status.upcoming() && !app.StartTime.Before(from) {
+			upcoming = append(upcoming, app)
+		}
+	}
+	sort.Slice(upcoming, func(i, j int) bool {
+		return scheduleCursor{upcoming[i].StartTime, upcoming[i].ID}.before(upcoming[j], false)
+	})
+	return upcoming, nil
+}
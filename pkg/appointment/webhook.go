@@ -0,0 +1,105 @@
+package appointment
+
+import (
+	"net/url"
+	"time"
+)
+
+type (
+	// Webhook is a URL the tenant's events are sent to
+	Webhook struct {
+		ID  int    `json:"id"`
+		URL string `json:"url"`
+		// Events are the event types the webhook is sent, every type when it is empty
+		Events []EventType `json:"events,omitempty"`
+		// Secret signs what is sent so the receiver can check it came from us
+		Secret    string    `json:"secret"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	// webhooksFile is what webhooks.json holds, the latest ID is kept so a deleted webhook's ID isn't used again
+	webhooksFile struct {
+		LatestID int       `json:"latest_id"`
+		Webhooks []Webhook `json:"webhooks"`
+	}
+)
+
+// CreateWebhook adds a webhook that is sent the events that happen from now on
+func (a *scheduledAppointments) CreateWebhook(webhook Webhook) (Webhook, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Webhook{}, newError(ErrValidation, "webhook url must be an http or https url")
+	}
+	for _, eventType := range webhook.Events {
+		if !eventType.valid() {
+			return Webhook{}, newError(ErrValidation, "unknown event type %s", eventType)
+		}
+	}
+	if webhook.Secret == "" {
+		return Webhook{}, newError(ErrValidation, "webhook secret is required")
+	}
+
+	previous, latestID := a.webhooks, a.latestWebhookID
+	a.latestWebhookID++
+	webhook.ID = a.latestWebhookID
+	webhook.CreatedAt = a.currentTime()
+	a.webhooks = append(append([]Webhook{}, previous...), webhook)
+	if err := a.saveWebhooks(); err != nil {
+		a.webhooks, a.latestWebhookID = previous, latestID
+		return Webhook{}, err
+	}
+	return webhook, nil
+}
+
+// GetWebhooks returns the webhooks in the order they were added
+func (a *scheduledAppointments) GetWebhooks() ([]Webhook, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	return append([]Webhook{}, a.webhooks...), nil
+}
+
+// DeleteWebhook stops sending events to the webhook, deliveries it hasn't been sent yet are dropped
+func (a *scheduledAppointments) DeleteWebhook(id int) error {
+	a.mu.Lock()
+	defer a.unlock()
+
+	i, ok := a.webhookIndex(id)
+	if !ok {
+		return newError(ErrWebhookNotFound, "webhook %d does not exist", id)
+	}
+
+	previous := a.webhooks
+	a.webhooks = append(append([]Webhook{}, previous[:i]...), previous[i+1:]...)
+	if err := a.saveWebhooks(); err != nil {
+		a.webhooks = previous
+		return err
+	}
+	return nil
+}
+
+// webhookIndex returns the index of the webhook in the list
+func (a *scheduledAppointments) webhookIndex(id int) (int, bool) {
+	for i, webhook := range a.webhooks {
+		if webhook.ID == id {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// wants reports whether the webhook is sent events of the type
+func (w Webhook) wants(eventType EventType) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, t := range w.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
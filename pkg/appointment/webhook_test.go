@@ -0,0 +1,170 @@
+package appointment
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookEvents(t *testing.T) {
+	now := time.Date(2022, 1, 1, 8, 0, 0, 0, time.UTC)
+	start := time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)
+	eventTypes := func(deliveries []Delivery) []EventType {
+		var types []EventType
+		for _, delivery := range deliveries {
+			types = append(types, delivery.Event.Type)
+		}
+		return types
+	}
+
+	t.Run("lifecycle", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		all, err := a.CreateWebhook(Webhook{URL: "https://example.com/all", Secret: "s"})
+		require.NoError(t, err)
+		cancelled, err := a.CreateWebhook(Webhook{URL: "https://example.com/cancelled", Secret: "s", Events: []EventType{"appointment.cancelled"}})
+		require.NoError(t, err)
+
+		app, err := a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+		require.NoError(t, err)
+		_, err = a.UpdateAppointment(Appointment{ID: app.ID, StartTime: start.Add(time.Hour), EndTime: start.Add(90 * time.Minute)}, AnyVersion)
+		require.NoError(t, err)
+		_, err = a.UpdateAppointment(Appointment{ID: app.ID, SessionType: DefaultSessionType}, AnyVersion)
+		require.NoError(t, err)
+		_, err = a.TransitionAppointment(app.ID, ActionCancel)
+		require.NoError(t, err)
+		require.NoError(t, a.DeleteAppointment(app.ID, AnyVersion))
+
+		due, err := a.DueDeliveries(now, 10)
+		require.NoError(t, err)
+		assert.Equal(t, []EventType{EventCreated, EventRescheduled, EventUpdated, "appointment.cancelled", "appointment.cancelled", EventDeleted}, eventTypes(due))
+		assert.Equal(t, cancelled.ID, due[4].WebhookID)
+		assert.Equal(t, all.ID, due[5].WebhookID)
+		// Both deliveries of the cancellation are the same event
+		assert.Equal(t, due[3].Event, due[4].Event)
+		assert.Equal(t, 4, due[4].Event.ID)
+		assert.True(t, due[1].Event.Appointment.StartTime.Equal(start.Add(time.Hour)))
+	})
+	t.Run("failed changes have no events", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		_, err := a.CreateWebhook(Webhook{URL: "https://example.com", Secret: "s"})
+		require.NoError(t, err)
+
+		_, err = a.CreateAppointments([]Appointment{
+			{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)},
+			{TrainerID: 1, UserID: 2, StartTime: start, EndTime: start.Add(30 * time.Minute)},
+		}, true)
+		require.Error(t, err)
+		_, err = a.CheckAppointments([]Appointment{{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)}})
+		require.NoError(t, err)
+
+		assert.Empty(t, a.outbox)
+		assert.Zero(t, a.latestEventID)
+	})
+	t.Run("deleted webhooks are dropped", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		webhook, err := a.CreateWebhook(Webhook{URL: "https://example.com", Secret: "s"})
+		require.NoError(t, err)
+		_, err = a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+		require.NoError(t, err)
+		require.NoError(t, a.DeleteWebhook(webhook.ID))
+
+		due, err := a.DueDeliveries(now, 10)
+		require.NoError(t, err)
+		assert.Empty(t, due)
+		assert.Empty(t, a.outbox)
+		assert.True(t, errors.Is(a.DeleteWebhook(webhook.ID), ErrWebhookNotFound))
+	})
+	t.Run("deliveries wait behind a retry", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		first, err := a.CreateWebhook(Webhook{URL: "https://example.com/first", Secret: "s"})
+		require.NoError(t, err)
+		_, err = a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+		require.NoError(t, err)
+		due, err := a.DueDeliveries(now, 10)
+		require.NoError(t, err)
+		require.Len(t, due, 1)
+		require.NoError(t, a.DeliveryFailed(due[0].ID, "500 Internal Server Error", now.Add(time.Minute)))
+
+		// Another webhook's deliveries don't wait
+		second, err := a.CreateWebhook(Webhook{URL: "https://example.com/second", Secret: "s"})
+		require.NoError(t, err)
+		_, err = a.TransitionAppointment(1, ActionCancel)
+		require.NoError(t, err)
+		due, err = a.DueDeliveries(now, 10)
+		require.NoError(t, err)
+		require.Len(t, due, 1)
+		assert.Equal(t, second.ID, due[0].WebhookID)
+
+		due, err = a.DueDeliveries(now.Add(time.Minute), 10)
+		require.NoError(t, err)
+		assert.Equal(t, []EventType{EventCreated, "appointment.cancelled", "appointment.cancelled"}, eventTypes(due))
+		assert.Equal(t, first.ID, due[0].WebhookID)
+	})
+	t.Run("invalid webhooks", func(t *testing.T) {
+		a := newStatusAppointments(now)
+		_, err := a.CreateWebhook(Webhook{URL: "ftp://example.com", Secret: "s"})
+		assert.True(t, errors.Is(err, ErrValidation))
+		_, err = a.CreateWebhook(Webhook{URL: "https://example.com", Secret: "s", Events: []EventType{"appointment.lost"}})
+		assert.EqualError(t, err, "unknown event type appointment.lost")
+	})
+}
+
+func TestDeliveries(t *testing.T) {
+	now := time.Date(2022, 1, 1, 8, 0, 0, 0, time.UTC)
+	start := time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "appointments.json"), `{"version": 2, "appointments": []}`)
+	a, err := newAppointmentManager(dir)
+	require.NoError(t, err)
+	a.now = func() time.Time { return now }
+	a.trainers[1] = Trainer{ID: 1}
+
+	_, err = a.CreateWebhook(Webhook{URL: "https://example.com", Secret: "s"})
+	require.NoError(t, err)
+	_, err = a.CreateAppointment(Appointment{TrainerID: 1, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+	require.NoError(t, err)
+
+	// The outbox and webhooks are read back after a restart
+	a, err = newAppointmentManager(dir)
+	require.NoError(t, err)
+	a.now = func() time.Time { return now }
+	due, err := a.DueDeliveries(now, 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, EventCreated, due[0].Event.Type)
+
+	// A delivery isn't due again until its retry
+	require.NoError(t, a.DeliveryFailed(due[0].ID, "500 Internal Server Error", now.Add(time.Minute)))
+	due, err = a.DueDeliveries(now, 10)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+	due, err = a.DueDeliveries(now.Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, 1, due[0].Attempts)
+
+	// Giving up moves it to the dead letters, retrying puts it back
+	require.NoError(t, a.DeliveryFailed(due[0].ID, "500 Internal Server Error", time.Time{}))
+	dead, err := a.GetDeadLetters()
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, 2, dead[0].Attempts)
+	assert.Equal(t, "500 Internal Server Error", dead[0].LastError)
+
+	require.NoError(t, a.RetryDeadLetter(dead[0].ID))
+	assert.True(t, errors.Is(a.RetryDeadLetter(dead[0].ID), ErrDeliveryNotFound))
+	due, err = a.DueDeliveries(now, 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	require.NoError(t, a.DeliveryDone(due[0].ID))
+
+	a, err = newAppointmentManager(dir)
+	require.NoError(t, err)
+	assert.Empty(t, a.outbox)
+	assert.Empty(t, a.deadLetters)
+	assert.Equal(t, 1, a.latestEventID)
+}
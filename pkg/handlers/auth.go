@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+)
+
+// publicRoutes don't need an api key. Calendar apps can't send headers so calendar feeds are checked with the token in their URL instead.
+var publicRoutes = map[string]bool{
+	"GET /trainers/:id/calendar.ics": true,
+	"GET /users/:id/calendar.ics":    true,
+}
+
+// anonymousKey is used for requests to tenants without any keys when Config.AllowAnonymous opens them to anyone
+var anonymousKey = appointment.APIKey{ID: "anonymous", Role: appointment.RoleAdmin}
+
+// MiddlewareAuthenticate requires an api key, it runs after MiddlewareTenant has checked the key.
+// A tenant without any keys refuses every request unless allowAnonymous is set, then anyone can do anything like before keys were added.
+func MiddlewareAuthenticate(tenants *appointment.Tenants, allowAnonymous bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if _, ok := c.Get(keyAPIKey).(appointment.APIKey); ok {
+				return next(c)
+			}
+			if allowAnonymous && !tenants.HasAPIKeys(GetTenantID(c)) {
+				SetAPIKey(c, anonymousKey)
+				return next(c)
+			}
+			if publicRoutes[versionRoute(c.Request().Method, c.Path())] {
+				return next(c)
+			}
+			return newProblem(http.StatusUnauthorized, CodeAPIKeyRequired, fmt.Sprintf("the %s header is required", headerAPIKey))
+		}
+	}
+}
+
+// MiddlewareRole only lets keys with one of the roles through, it goes before the route's own middleware so nothing is read first
+func MiddlewareRole(roles ...appointment.Role) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := GetAPIKey(c)
+			for _, role := range roles {
+				if key.Role == role {
+					return next(c)
+				}
+			}
+			return forbidden("%s keys can't use this route", key.Role)
+		}
+	}
+}
+
+// MiddlewareAuthorizeSchedule narrows the schedule query to the trainer's or client's own appointments
+func MiddlewareAuthorizeSchedule(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		query, ok := GetAPIKey(c).Scope(GetScheduleQuery(c))
+		if !ok {
+			return forbidden("the key can only see its own schedule")
+		}
+
+		SetScheduleQuery(c, query)
+		return next(c)
+	}
+}
+
+// MiddlewareAuthorizeBooking checks a new appointment is for the trainer or client the key belongs to
+func MiddlewareAuthorizeBooking(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !GetAPIKey(c).Allows(GetAppointment(c)) {
+			return forbidden("the key can only book its own appointments")
+		}
+		return next(c)
+	}
+}
+
+// MiddlewareAuthorizeBatch checks every appointment in a batch is for the trainer or client the key belongs to
+func MiddlewareAuthorizeBatch(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		batch := GetBatch(c)
+		for i, app := range batch.Appointments {
+			if !GetAPIKey(c).Allows(app) {
+				return forbidden("the key can only book its own appointments, appointment %d isn't", batch.Indexes[i])
+			}
+		}
+		return next(c)
+	}
+}
+
+// MiddlewareAuthorizeAppointment checks the appointment in the path belongs to the trainer or client the key belongs to
+func MiddlewareAuthorizeAppointment(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := GetAPIKey(c)
+		if key.Role == appointment.RoleAdmin {
+			return next(c)
+		}
+
+		app, err := GetManager(c).GetAppointment(GetAppointment(c).ID)
+		if err != nil {
+			return managerProblem(err, "error getting appointment")
+		}
+		if !key.Allows(app) {
+			return forbidden("the key can only use its own appointments")
+		}
+		return next(c)
+	}
+}
+
+// MiddlewareAuthorizeTrainer checks a trainer key is for the trainer in the path
+func MiddlewareAuthorizeTrainer(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := GetAPIKey(c)
+		if key.Role == appointment.RoleTrainer && key.TrainerID != GetAppointment(c).TrainerID {
+			return forbidden("the key can only use its own trainer")
+		}
+		return next(c)
+	}
+}
+
+// MiddlewareAuthorizeUser checks a client key is for the user in the path
+func MiddlewareAuthorizeUser(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := GetAPIKey(c)
+		if key.Role == appointment.RoleClient && key.UserID != GetAppointment(c).UserID {
+			return forbidden("the key can only use its own user")
+		}
+		return next(c)
+	}
+}
+
+func forbidden(format string, args ...interface{}) error {
+	return newProblem(http.StatusForbidden, CodeForbidden, fmt.Sprintf(format, args...))
+}
+
+func SetAPIKey(c echo.Context, key appointment.APIKey) {
+	c.Set(keyAPIKey, key)
+}
+
+// GetAPIKey returns the request's key, requests to public routes of tenants with keys have none so nothing is allowed
+func GetAPIKey(c echo.Context) appointment.APIKey {
+	key, _ := c.Get(keyAPIKey).(appointment.APIKey)
+	return key
+}
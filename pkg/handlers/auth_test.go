@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorization(t *testing.T) {
+	start := time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC)
+	appManager := appointment.NewMockAppointmentManager([]appointment.Appointment{
+		{ID: 1, TrainerID: 1, UserID: 5, StartTime: start, EndTime: start.Add(30 * time.Minute), Status: appointment.StatusConfirmed, Version: 1},
+		{ID: 2, TrainerID: 2, UserID: 6, StartTime: start, EndTime: start.Add(30 * time.Minute), Status: appointment.StatusConfirmed, Version: 1},
+	}, nil)
+	appManager.APIKeys = []appointment.APIKey{
+		{ID: "front-desk", Hash: appointment.HashAPIKey("admin-key"), Role: appointment.RoleAdmin},
+		{ID: "coach", Hash: appointment.HashAPIKey("trainer-key"), Role: appointment.RoleTrainer, TrainerID: 1},
+		{ID: "sam", Hash: appointment.HashAPIKey("client-key"), Role: appointment.RoleClient, UserID: 5},
+	}
+	e := echo.New()
+	BuildRouter(e, appointment.NewSingleTenant(appManager), Config{})
+	serve := func(key string, method string, target string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(headerIfMatch, `"1"`)
+		if key != "" {
+			req.Header.Set(headerAPIKey, key)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	booking := func(trainerID int, userID int) string {
+		return `{"starts_at": "2030-01-08T09:00:00Z", "ends_at": "2030-01-08T09:30:00Z", "trainer_id": ` + strconv.Itoa(trainerID) + `, "user_id": ` + strconv.Itoa(userID) + `}`
+	}
+
+	tests := []struct {
+		name   string
+		key    string
+		method string
+		target string
+		body   string
+		status int
+		code   string
+	}{
+		{"no key", "", http.MethodGet, "/v1/locations", "", http.StatusUnauthorized, CodeAPIKeyRequired},
+		{"wrong key", "guess", http.MethodGet, "/v1/locations", "", http.StatusUnauthorized, CodeInvalidAPIKey},
+		{"calendar feeds use their token", "", http.MethodGet, "/v1/users/5/calendar.ics?token=bad", "", http.StatusForbidden, CodeInvalidCalendarToken},
+
+		{"admins book for anyone", "admin-key", http.MethodPost, "/v1/schedule", booking(2, 6), http.StatusCreated, ""},
+		{"admins manage webhooks", "admin-key", http.MethodGet, "/v1/webhooks", "", http.StatusOK, ""},
+
+		{"clients book for themselves", "client-key", http.MethodPost, "/v1/schedule", booking(2, 5), http.StatusCreated, ""},
+		{"clients can't book for others", "client-key", http.MethodPost, "/v1/schedule", booking(2, 6), http.StatusForbidden, CodeForbidden},
+		{"clients can't batch book for others", "client-key", http.MethodPost, "/v1/schedule/batch", `{"appointments": [` + booking(1, 5) + `,` + booking(2, 6) + `]}`, http.StatusForbidden, CodeForbidden},
+		{"clients cancel their own", "client-key", http.MethodPost, "/v1/schedule/1/cancel", "", http.StatusOK, ""},
+		{"clients can't cancel others", "client-key", http.MethodPost, "/v1/schedule/2/cancel", "", http.StatusForbidden, CodeForbidden},
+		{"clients can't check in", "client-key", http.MethodPost, "/v1/schedule/1/check-in", "", http.StatusForbidden, CodeForbidden},
+		{"clients see their own schedule", "client-key", http.MethodGet, "/v1/schedule?trainer_id=2", "", http.StatusOK, ""},
+		{"clients can't see other users' schedules", "client-key", http.MethodGet, "/v1/schedule?user_id=6", "", http.StatusForbidden, CodeForbidden},
+		{"clients can't see others' attendance", "client-key", http.MethodGet, "/v1/users/6/attendance", "", http.StatusForbidden, CodeForbidden},
+		{"clients can't manage webhooks", "client-key", http.MethodGet, "/v1/webhooks", "", http.StatusForbidden, CodeForbidden},
+
+		{"trainers see their own schedule", "trainer-key", http.MethodGet, "/v1/schedule?trainer_id=1", "", http.StatusOK, ""},
+		{"trainers can't see other trainers' schedules", "trainer-key", http.MethodGet, "/v1/schedule?trainer_id=2", "", http.StatusForbidden, CodeForbidden},
+		{"trainers can't get other trainers' appointments", "trainer-key", http.MethodGet, "/v1/schedule/2", "", http.StatusForbidden, CodeForbidden},
+		{"trainers can't follow other trainers' streams", "trainer-key", http.MethodGet, "/v1/schedule/stream?trainer_id=2", "", http.StatusForbidden, CodeForbidden},
+		{"trainers can't book for other trainers", "trainer-key", http.MethodPost, "/v1/schedule", booking(2, 6), http.StatusForbidden, CodeForbidden},
+		{"trainers can't import", "trainer-key", http.MethodPost, "/v1/schedule/import", "", http.StatusForbidden, CodeForbidden},
+		{"trainers can't see other trainers' busy time", "trainer-key", http.MethodGet, "/v1/trainers/2/busy", "", http.StatusForbidden, CodeForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(tt.key, tt.method, tt.target, tt.body)
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+			if tt.code != "" {
+				assert.Contains(t, rec.Body.String(), `"code":"`+tt.code+`"`)
+			}
+		})
+	}
+
+}
+
+func TestAuthorization_TenantWithoutKeys(t *testing.T) {
+	serve := func(config Config) *httptest.ResponseRecorder {
+		e := echo.New()
+		BuildRouter(e, appointment.NewSingleTenant(appointment.NewMockAppointmentManager(nil, nil)), config)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/webhooks", nil))
+		return rec
+	}
+
+	// A tenant without keys isn't open to anyone by default
+	rec := serve(Config{})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"`+CodeAPIKeyRequired+`"`)
+
+	// Development servers can open it
+	rec = serve(Config{AllowAnonymous: true})
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
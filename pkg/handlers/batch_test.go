@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// conflictManager books every appointment in a batch except ones starting at conflict
+type conflictManager struct {
+	*appointment.MockAppointmentManager
+	conflict string
+	batches  int
+}
+
+func (m *conflictManager) CreateAppointments(apps []appointment.Appointment, atomic bool) ([]appointment.BatchResult, error) {
+	m.batches++
+	results := make([]appointment.BatchResult, len(apps))
+	failed := -1
+	for i, app := range apps {
+		if app.StartTime.Format("15:04") == m.conflict {
+			results[i].Err = fmt.Errorf("taken: %w", appointment.ErrSlotConflict)
+			failed = i
+			continue
+		}
+		app.ID = i + 1
+		results[i].Appointment = app
+	}
+	if atomic && failed >= 0 {
+		return results, results[failed].Err
+	}
+	return results, nil
+}
+
+func batchBody(atomic bool, starts ...string) string {
+	var apps []string
+	for _, start := range starts {
+		apps = append(apps, fmt.Sprintf(`{"starts_at": "2030-01-01T%s:00Z", "ends_at": "2030-01-01T%s:30:00Z", "trainer_id": 1, "user_id": 1}`, start, start[:2]))
+	}
+	return fmt.Sprintf(`{"atomic": %t, "appointments": [%s]}`, atomic, strings.Join(apps, ","))
+}
+
+func postBatch(e *echo.Echo, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/schedule/batch", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderAccept, "application/json; version=2")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlePostBatch(t *testing.T) {
+	newRouter := func() (*echo.Echo, *conflictManager) {
+		appManager := &conflictManager{MockAppointmentManager: appointment.NewMockAppointmentManager(nil, nil), conflict: "10:00"}
+		e := echo.New()
+		BuildRouter(e, appointment.NewSingleTenant(appManager), Config{AllowAnonymous: true})
+		return e, appManager
+	}
+
+	t.Run("best effort", func(t *testing.T) {
+		e, _ := newRouter()
+		// 09:15 isn't on the half-hour and 10:00 is taken
+		rec := postBatch(e, batchBody(false, "09:00", "09:15", "10:00"))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var body struct {
+			Items []struct {
+				Status      int                  `json:"status"`
+				Appointment *AppointmentResponse `json:"appointment"`
+				Problem     *Problem             `json:"problem"`
+			} `json:"items"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		require.Len(t, body.Items, 3)
+		assert.Equal(t, http.StatusCreated, body.Items[0].Status)
+		assert.Equal(t, 1, body.Items[0].Appointment.ID)
+		assert.Equal(t, http.StatusUnprocessableEntity, body.Items[1].Status)
+		assert.Equal(t, CodeValidationFailed, body.Items[1].Problem.Code)
+		assert.Equal(t, http.StatusConflict, body.Items[2].Status)
+		assert.Equal(t, CodeSlotConflict, body.Items[2].Problem.Code)
+	})
+	t.Run("atomic", func(t *testing.T) {
+		e, _ := newRouter()
+		rec := postBatch(e, batchBody(true, "09:00", "10:00"))
+		assert.Equal(t, http.StatusConflict, rec.Code)
+
+		var problem Problem
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+		assert.Equal(t, CodeBatchFailed, problem.Code)
+		require.Len(t, problem.Items, 2)
+		assert.Equal(t, CodeSlotConflict, problem.Items[1].Problem.Code)
+	})
+	t.Run("atomic with an invalid appointment isn't booked", func(t *testing.T) {
+		e, appManager := newRouter()
+		rec := postBatch(e, batchBody(true, "09:00", "09:15"))
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		var problem Problem
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+		assert.Equal(t, CodeBatchFailed, problem.Code)
+		require.Len(t, problem.Items, 2)
+		assert.Equal(t, http.StatusFailedDependency, problem.Items[0].Status)
+		assert.Equal(t, CodeBatchAborted, problem.Items[0].Problem.Code)
+		assert.Equal(t, CodeValidationFailed, problem.Items[1].Problem.Code)
+		assert.Zero(t, appManager.batches)
+	})
+	t.Run("empty batch", func(t *testing.T) {
+		e, _ := newRouter()
+		rec := postBatch(e, `{"appointments": []}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+}
+
+func TestMiddlewareBodyLimit(t *testing.T) {
+	// A batch of 20 appointments is well over the default limit
+	starts := make([]string, 20)
+	for i := range starts {
+		starts[i] = "09:00"
+	}
+	body := batchBody(false, starts...)
+	require.Greater(t, len(body), 1024)
+
+	t.Run("batch has its own limit", func(t *testing.T) {
+		rec := postBatch(newTestRouter(), body)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+	t.Run("other routes use the default", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/schedule", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		newTestRouter().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+	t.Run("configured", func(t *testing.T) {
+		e := echo.New()
+		BuildRouter(e, appointment.NewSingleTenant(appointment.NewMockAppointmentManager(nil, nil)), Config{RouteBodyLimits: map[string]string{"POST /schedule/batch": "1KB"}, AllowAnonymous: true})
+		rec := postBatch(e, body)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+}
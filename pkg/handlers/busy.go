@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/justinthompson/appointment/pkg/ical"
+)
+
+const (
+	// busyImportHorizon is how far ahead recurring events are expanded into busy blocks
+	busyImportHorizon = 365 * 24 * time.Hour
+	// maxBusyBlocks is the most busy blocks one import can make, a calendar with more is refused rather than cut short
+	maxBusyBlocks = 10000
+)
+
+// BusyImportResponse says what an import of a trainer's calendar found
+type BusyImportResponse struct {
+	// Events is how many events were in the calendar, including the ones that don't make the trainer busy
+	Events int                     `json:"events"`
+	Blocks []appointment.BusyBlock `json:"blocks"`
+}
+
+// MiddlewareBusyImport takes the trainer ID from the path of a calendar upload.
+// Only the path is bound because the body is the calendar, echo's binder refuses bodies that aren't json, xml or a form.
+func MiddlewareBusyImport(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req TrainerIDRequest
+		if err := (&echo.DefaultBinder{}).BindPathParams(c, &req); err != nil {
+			return newProblem(http.StatusBadRequest, CodeBadRequest, bindErrorDetail(err))
+		}
+		if err := validateRequest(c, &req); err != nil {
+			return validationProblem(c, err)
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+		if mediaType != ical.MIMEType {
+			return newProblem(http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "the body must be a "+ical.MIMEType+" file")
+		}
+
+		SetAppointment(c, appointment.Appointment{TrainerID: req.ID})
+		return next(c)
+	}
+}
+
+// handlePostBusyBlocks imports the trainer's calendar as busy blocks, replacing the blocks of the events it has.
+// Times without a time zone are in the time zone of the trainer's location.
+func handlePostBusyBlocks(c echo.Context, appManager appointment.Manager) error {
+	trainerID := GetAppointment(c).TrainerID
+	location, err := appManager.GetBookingLocation(trainerID, 0)
+	if err != nil {
+		return managerProblem(err, "error importing busy blocks")
+	}
+
+	events, err := ical.Parse(c.Request().Body, location.Zone())
+	if err != nil {
+		return newProblem(http.StatusUnprocessableEntity, CodeInvalidCalendar, err.Error())
+	}
+
+	uids, blocks, err := busyBlocks(events, time.Now())
+	if err != nil {
+		return newProblem(http.StatusUnprocessableEntity, CodeInvalidCalendar, err.Error())
+	}
+	if err := appManager.ImportBusyBlocks(trainerID, uids, blocks); err != nil {
+		return managerProblem(err, "error importing busy blocks")
+	}
+
+	imported, err := appManager.GetBusyBlocks(trainerID)
+	if err != nil {
+		return managerProblem(err, "error importing busy blocks")
+	}
+	return c.JSON(http.StatusOK, BusyImportResponse{Events: len(events), Blocks: imported})
+}
+
+// handleGetBusyBlocks lists the trainer's busy blocks that haven't ended
+func handleGetBusyBlocks(c echo.Context, appManager appointment.Manager) error {
+	blocks, err := appManager.GetBusyBlocks(GetAppointment(c).TrainerID)
+	if err != nil {
+		return managerProblem(err, "error getting busy blocks")
+	}
+	return c.JSON(http.StatusOK, blocks)
+}
+
+// busyBlocks expands the events into the blocks of time they make the trainer busy from now until the horizon.
+// Every event's UID is returned so cancelled and free events remove the blocks they had before.
+func busyBlocks(events []ical.Event, now time.Time) ([]string, []appointment.BusyBlock, error) {
+	var (
+		uids   []string
+		blocks []appointment.BusyBlock
+	)
+	for _, event := range events {
+		if event.UID == "" {
+			return nil, nil, fmt.Errorf("event at %s has no UID", event.Start.Format(time.RFC3339))
+		}
+		uids = append(uids, event.UID)
+		if event.Status == ical.StatusCancelled || event.Transparent || !event.End.After(event.Start) {
+			continue
+		}
+
+		// One more than is allowed is asked for so a calendar with too many is refused
+		for _, period := range event.Occurrences(now, now.Add(busyImportHorizon), maxBusyBlocks+1-len(blocks)) {
+			blocks = append(blocks, appointment.BusyBlock{UID: event.UID, StartTime: period.Start, EndTime: period.End})
+			if len(blocks) > maxBusyBlocks {
+				return nil, nil, fmt.Errorf("the calendar has more than %d busy blocks", maxBusyBlocks)
+			}
+		}
+	}
+	return uids, blocks, nil
+}
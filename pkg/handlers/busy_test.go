@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/justinthompson/appointment/pkg/ical"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostBusyBlocks(t *testing.T) {
+	// The events are from now so they are inside the import horizon
+	day := time.Now().UTC().AddDate(0, 0, 1).Format("20060102")
+	calendar := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:weekly@example.com",
+		"DTSTART:" + day + "T170000Z",
+		"DTEND:" + day + "T180000Z",
+		"RRULE:FREQ=WEEKLY;COUNT=3",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:cancelled@example.com",
+		"DTSTART:" + day + "T200000Z",
+		"DTEND:" + day + "T210000Z",
+		"STATUS:CANCELLED",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+	post := func(e *echo.Echo, contentType string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/trainers/1/busy", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("import", func(t *testing.T) {
+		appManager := appointment.NewMockAppointmentManager(nil, nil)
+		e := echo.New()
+		BuildRouter(e, appointment.NewSingleTenant(appManager), Config{AllowAnonymous: true})
+
+		rec := post(e, ical.MIMEType+"; charset=utf-8", calendar)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var res BusyImportResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, 2, res.Events)
+		require.Len(t, res.Blocks, 3)
+		assert.Equal(t, "weekly@example.com", res.Blocks[0].UID)
+		assert.Equal(t, 7*24*time.Hour, res.Blocks[1].StartTime.Sub(res.Blocks[0].StartTime))
+
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/trainers/1/busy", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var blocks []appointment.BusyBlock
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &blocks))
+		assert.Len(t, blocks, 3)
+	})
+	t.Run("invalid calendar", func(t *testing.T) {
+		rec := post(newTestRouter(), ical.MIMEType, "BEGIN:VEVENT\r\nUID:1\r\nEND:VEVENT")
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Contains(t, rec.Body.String(), CodeInvalidCalendar)
+	})
+	t.Run("not a calendar", func(t *testing.T) {
+		rec := post(newTestRouter(), echo.MIMEApplicationJSON, "{}")
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+		assert.Contains(t, rec.Body.String(), CodeUnsupportedMediaType)
+	})
+}
+
+func TestBusyBlocks(t *testing.T) {
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	events := []ical.Event{
+		{UID: "past", Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour)},
+		{UID: "free", Start: now, End: now.Add(time.Hour), Transparent: true},
+		{UID: "daily", Start: now.Add(-time.Hour), End: now.Add(time.Hour), Recurrence: &ical.Recurrence{Freq: ical.FreqDaily, Interval: 1}},
+	}
+
+	uids, blocks, err := busyBlocks(events, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"past", "free", "daily"}, uids)
+	// A daily event without an end is expanded up to the horizon, the occurrence that started before now hasn't ended
+	assert.Len(t, blocks, 366)
+	assert.Equal(t, now.Add(-time.Hour), blocks[0].StartTime)
+
+	_, _, err = busyBlocks([]ical.Event{{Start: now, End: now.Add(time.Hour)}}, now)
+	assert.Error(t, err)
+}
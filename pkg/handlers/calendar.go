@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/justinthompson/appointment/pkg/ical"
+)
+
+// calendarFeed is whose appointments a calendar has, it is the first part of the calendar's path
+type calendarFeed string
+
+const (
+	calendarTrainer calendarFeed = "trainers"
+	calendarUser    calendarFeed = "users"
+
+	calendarProdID = "-//justinthompson//appointment//EN"
+)
+
+// CalendarLinkResponse is the URL a calendar app subscribes to
+type CalendarLinkResponse struct {
+	URL string `json:"url"`
+}
+
+// MiddlewareCalendarToken checks the token of a calendar URL and converts the request to an appointment for the feed.
+// Calendar apps can't send headers so the token in the URL is the only credential, it is only valid for one feed of one tenant.
+func MiddlewareCalendarToken(feed calendarFeed, secret []byte) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var req CalendarRequest
+			if err := bindRequest(c, &req); err != nil {
+				return err
+			}
+
+			want := calendarToken(secret, GetTenantID(c), feed, req.ID)
+			if !hmac.Equal([]byte(req.Token), []byte(want)) {
+				return newProblem(http.StatusForbidden, CodeInvalidCalendarToken, "the calendar token is not valid for this calendar")
+			}
+
+			SetAppointment(c, feed.appointment(req.ID))
+			return next(c)
+		}
+	}
+}
+
+// calendarToken signs the tenant, feed and ID so a calendar URL can't be changed to another calendar.
+// Changing the secret revokes every calendar URL.
+func calendarToken(secret []byte, tenantID string, feed calendarFeed, id int) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\x00%s\x00%d", tenantID, feed, id)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// appointment returns the request for the feed's appointments
+func (f calendarFeed) appointment(id int) appointment.Appointment {
+	if f == calendarUser {
+		return appointment.Appointment{UserID: id}
+	}
+	return appointment.Appointment{TrainerID: id}
+}
+
+// id returns the ID of the trainer or user in the request for the feed
+func (f calendarFeed) id(app appointment.Appointment) int {
+	if f == calendarUser {
+		return app.UserID
+	}
+	return app.TrainerID
+}
+
+// handleGetCalendarLink returns the URL of the calendar for the trainer or user in the path.
+// The URL names the tenant so it works on deployments where the host doesn't say which tenant it is.
+func handleGetCalendarLink(c echo.Context, feed calendarFeed, secret []byte) error {
+	id, tenantID := feed.id(GetAppointment(c)), GetTenantID(c)
+	query := url.Values{"token": {calendarToken(secret, tenantID, feed, id)}, queryTenant: {tenantID}}
+	u := fmt.Sprintf("%s://%s%s.ics?%s", c.Scheme(), c.Request().Host, c.Request().URL.Path, query.Encode())
+	return c.JSON(http.StatusOK, CalendarLinkResponse{URL: u})
+}
+
+// handleGetCalendar writes every appointment of the trainer or user in the path as an iCalendar file
+func handleGetCalendar(c echo.Context, appManager appointment.Manager, feed calendarFeed) error {
+	appRequest := GetAppointment(c)
+	apps, err := appManager.GetScheduledAppointments(appRequest)
+	if err != nil {
+		return managerProblem(err, "error getting calendar")
+	}
+	locations, err := appManager.GetLocations()
+	if err != nil {
+		return managerProblem(err, "error getting calendar")
+	}
+	locationsByID := make(map[int]appointment.Location, len(locations))
+	for _, location := range locations {
+		locationsByID[location.ID] = location
+	}
+
+	calendar := ical.Calendar{ProdID: calendarProdID}
+	if feed == calendarUser {
+		calendar.Name = fmt.Sprintf("User %d appointments", appRequest.UserID)
+	} else {
+		calendar.Name = fmt.Sprintf("Trainer %d appointments", appRequest.TrainerID)
+	}
+	for _, app := range apps {
+		calendar.Events = append(calendar.Events, appointmentEvent(GetTenantID(c), feed, app, locationsByID[app.LocationID]))
+	}
+
+	var b bytes.Buffer
+	if err := calendar.Encode(&b); err != nil {
+		return err
+	}
+	// Calendar apps poll the feed so they get a 304 until an appointment changes
+	etag := bodyETag(b.Bytes())
+	c.Response().Header().Set(headerETag, etag)
+	if notModified(c.Request(), etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.Blob(http.StatusOK, ical.MIMEType+"; charset=utf-8", b.Bytes())
+}
+
+// appointmentEvent converts an appointment to an event in the time zone of its location.
+// The UID has the tenant because appointment IDs are only unique within a tenant.
+func appointmentEvent(tenantID string, feed calendarFeed, app appointment.Appointment, location appointment.Location) ical.Event {
+	start, end := app.StartTime, app.EndTime
+	if zone := location.Zone(); zone != nil {
+		start, end = start.In(zone), end.In(zone)
+	}
+
+	sessionType := app.SessionType
+	if sessionType == "" {
+		sessionType = appointment.DefaultSessionType
+	}
+	event := ical.Event{
+		UID:      fmt.Sprintf("appointment-%d.%s@appointment", app.ID, tenantID),
+		Start:    start,
+		End:      end,
+		Stamp:    app.StartTime,
+		Sequence: app.Version,
+		Summary:  fmt.Sprintf("%s session with trainer %d", sessionType, app.TrainerID),
+		Location: location.Name,
+		Status:   eventStatus(app.Status),
+	}
+	if feed == calendarTrainer {
+		event.Summary = fmt.Sprintf("%s session with user %d", sessionType, app.UserID)
+	}
+	if n := len(app.StatusHistory); n > 0 {
+		event.Stamp = app.StatusHistory[n-1].At
+	}
+	return event
+}
+
+// eventStatus is the event status for an appointment status, appointments that aren't happening any more are cancelled
+func eventStatus(status appointment.Status) string {
+	switch status {
+	case appointment.StatusPending, appointment.StatusTentative:
+		return ical.StatusTentative
+	case appointment.StatusCancelled, appointment.StatusDeclined, appointment.StatusExpired:
+		return ical.StatusCancelled
+	default:
+		return ical.StatusConfirmed
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/justinthompson/appointment/pkg/ical"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalendar(t *testing.T) {
+	start := time.Date(2030, 1, 7, 17, 0, 0, 0, time.UTC)
+	appManager := appointment.NewMockAppointmentManager([]appointment.Appointment{
+		{ID: 4, TrainerID: 1, UserID: 5, StartTime: start, EndTime: start.Add(30 * time.Minute), Status: appointment.StatusConfirmed, Version: 1},
+		{ID: 6, TrainerID: 1, UserID: 7, StartTime: start.Add(time.Hour), EndTime: start.Add(90 * time.Minute), Status: appointment.StatusCancelled, Version: 2},
+	}, nil)
+	e := echo.New()
+	BuildRouter(e, appointment.NewSingleTenant(appManager), Config{CalendarSecret: []byte("secret"), AllowAnonymous: true})
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+	link := func(target string) *url.URL {
+		rec := get(target)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var res CalendarLinkResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		u, err := url.Parse(res.URL)
+		require.NoError(t, err)
+		return u
+	}
+
+	t.Run("trainer calendar", func(t *testing.T) {
+		u := link("/v1/trainers/1/calendar")
+		assert.Equal(t, "/v1/trainers/1/calendar.ics", u.Path)
+
+		rec := get(u.RequestURI())
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/calendar; charset=utf-8", rec.Header().Get(echo.HeaderContentType))
+		body := rec.Body.String()
+		assert.Equal(t, 2, strings.Count(body, "BEGIN:VEVENT"))
+		assert.Contains(t, body, "UID:appointment-4.default@appointment\r\n")
+		assert.Contains(t, body, "SUMMARY:standard session with user 5\r\n")
+		assert.Contains(t, body, "STATUS:CANCELLED\r\n")
+	})
+	t.Run("token is only for its calendar", func(t *testing.T) {
+		u := link("/v1/trainers/1/calendar")
+		token := u.Query().Get("token")
+
+		assert.Equal(t, http.StatusForbidden, get("/v1/trainers/2/calendar.ics?token="+token).Code)
+		assert.Equal(t, http.StatusForbidden, get("/v1/users/1/calendar.ics?token="+token).Code)
+		assert.Equal(t, http.StatusForbidden, get("/v1/trainers/1/calendar.ics?token=wrong").Code)
+		assert.Equal(t, http.StatusUnprocessableEntity, get("/v1/trainers/1/calendar.ics").Code)
+	})
+	t.Run("user calendar", func(t *testing.T) {
+		u := link("/v1/users/5/calendar")
+		rec := get(u.RequestURI())
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "SUMMARY:standard session with trainer 1\r\n")
+	})
+}
+
+func TestCalendar_MultiTenant(t *testing.T) {
+	start := time.Date(2030, 1, 7, 17, 0, 0, 0, time.UTC)
+	acme := appointment.NewMockAppointmentManager([]appointment.Appointment{
+		{ID: 4, TrainerID: 1, UserID: 5, StartTime: start, EndTime: start.Add(30 * time.Minute), Status: appointment.StatusConfirmed, Version: 1},
+	}, nil)
+	acme.APIKeys = []appointment.APIKey{{ID: "front-desk", Hash: appointment.HashAPIKey("acme-key"), Role: appointment.RoleAdmin}}
+	globex := appointment.NewMockAppointmentManager(nil, nil)
+	globex.APIKeys = []appointment.APIKey{{ID: "front-desk", Hash: appointment.HashAPIKey("globex-key"), Role: appointment.RoleAdmin}}
+	tenants, err := appointment.NewMultiTenant(map[string]appointment.Manager{"acme": acme, "globex": globex})
+	require.NoError(t, err)
+	e := echo.New()
+	BuildRouter(e, tenants, Config{CalendarSecret: []byte("secret")})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/trainers/1/calendar", nil)
+	req.Header.Set(headerAPIKey, "acme-key")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var res CalendarLinkResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	u, err := url.Parse(res.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "acme", u.Query().Get("tenant"))
+
+	// Calendar apps fetch the link without any headers
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, u.RequestURI(), nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), "UID:appointment-4.acme@appointment\r\n")
+
+	// The token is only valid for the tenant it was made for
+	query := u.Query()
+	query.Set("tenant", "globex")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, u.Path+"?"+query.Encode(), nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// Other routes can't name their tenant in the query
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/locations?tenant=acme", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), CodeTenantRequired)
+}
+
+func TestAppointmentEvent(t *testing.T) {
+	start := time.Date(2030, 1, 7, 17, 0, 0, 0, time.UTC)
+	changed := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	app := appointment.Appointment{
+		ID: 4, TrainerID: 1, UserID: 5, StartTime: start, EndTime: start.Add(30 * time.Minute), SessionType: "assessment",
+		Status: appointment.StatusPending, StatusHistory: []appointment.StatusChange{{Status: appointment.StatusPending, At: changed}}, Version: 3,
+	}
+
+	event := appointmentEvent("acme", calendarUser, app, appointment.Location{Name: "Downtown"})
+	assert.Equal(t, "appointment-4.acme@appointment", event.UID)
+	assert.Equal(t, start, event.Start)
+	assert.Equal(t, changed, event.Stamp)
+	assert.Equal(t, 3, event.Sequence)
+	assert.Equal(t, "assessment session with trainer 1", event.Summary)
+	assert.Equal(t, "Downtown", event.Location)
+	assert.Equal(t, ical.StatusTentative, event.Status)
+}
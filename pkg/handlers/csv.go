@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+)
+
+const (
+	mimeCSV = "text/csv"
+
+	// maxImportRows is the most appointments one import can have
+	maxImportRows = 1000
+)
+
+// Import results
+const (
+	importCreated = "created"
+	importValid   = "valid"
+	importFailed  = "failed"
+)
+
+// exportColumns are the columns of an export, the import reads the ones it needs by name so an export can be edited and imported
+var exportColumns = []string{"id", "status", "starts_at", "ends_at", "trainer_id", "user_id", "location_id", "session_type", "version"}
+
+// importColumns are the columns an import must have, session_type and tentative are optional
+var importColumns = []string{"starts_at", "ends_at", "trainer_id", "user_id"}
+
+// ExportScheduleRequest filters the appointments to export like GetScheduledRequest without the paging
+type ExportScheduleRequest struct {
+	TrainerID  int       `query:"trainer_id" validate:"required_without_all=LocationID UserID"`
+	LocationID int       `query:"location_id"`
+	UserID     int       `query:"user_id"`
+	From       time.Time `query:"from"`
+	To         time.Time `query:"to" validate:"omitempty,gtfield=From"`
+	// Status can be repeated or comma separated
+	Status []string `query:"status"`
+}
+
+// ImportScheduleRequest is an upload of appointments to book, a dry run checks every row without booking any
+type ImportScheduleRequest struct {
+	DryRun bool `query:"dry_run"`
+}
+
+// Import is a csv upload of appointments with the rows that passed validation and the errors of the ones that didn't
+type Import struct {
+	DryRun       bool
+	Appointments []appointment.Appointment
+	// Rows is the line each appointment was on in the file
+	Rows []int
+	// Invalid has the error of each row that failed validation by its line
+	Invalid map[int]string
+	Size    int
+}
+
+// MiddlewareExport is a middleware that takes the filters of an export and converts them to a schedule query for every appointment
+func MiddlewareExport(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req ExportScheduleRequest
+		if err := bindRequest(c, &req); err != nil {
+			return err
+		}
+
+		SetScheduleQuery(c, appointment.ScheduleQuery{
+			TrainerID:  req.TrainerID,
+			LocationID: req.LocationID,
+			UserID:     req.UserID,
+			From:       req.From,
+			To:         req.To,
+			Statuses:   splitStatuses(req.Status),
+			Limit:      -1,
+		})
+		return next(c)
+	}
+}
+
+// MiddlewareImport is a middleware that reads a csv upload and validates each row like a single booking.
+// Only the query is bound because echo's binder refuses bodies that aren't json, xml or a form.
+func MiddlewareImport(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req ImportScheduleRequest
+		if err := (&echo.DefaultBinder{}).BindQueryParams(c, &req); err != nil {
+			return newProblem(http.StatusBadRequest, CodeBadRequest, bindErrorDetail(err))
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+		if mediaType != mimeCSV {
+			return newProblem(http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "the body must be a "+mimeCSV+" file")
+		}
+
+		imp, err := readImport(c, c.Request().Body)
+		if err != nil {
+			return newProblem(http.StatusUnprocessableEntity, CodeInvalidCSV, err.Error())
+		}
+		imp.DryRun = req.DryRun
+
+		SetImport(c, imp)
+		return next(c)
+	}
+}
+
+func SetImport(c echo.Context, imp Import) {
+	c.Set(keyImport, imp)
+}
+
+func GetImport(c echo.Context) Import {
+	return c.Get(keyImport).(Import)
+}
+
+// readImport reads the rows of a csv upload, the first row is the header.
+// Errors in a row are kept for the result file, only a file that can't be read at all is an error.
+func readImport(c echo.Context, r io.Reader) (Import, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	// Rows with missing trailing cells are reported as invalid rather than failing the file
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return Import{}, err
+	}
+	if len(records) == 0 {
+		return Import{}, fmt.Errorf("the file is empty")
+	}
+	if len(records)-1 > maxImportRows {
+		return Import{}, fmt.Errorf("the file has more than %d appointments", maxImportRows)
+	}
+
+	// Spreadsheets can start the file with a byte order mark
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, name := range importColumns {
+		if _, ok := columns[name]; !ok {
+			return Import{}, fmt.Errorf("the %s column is missing", name)
+		}
+	}
+
+	imp := Import{Invalid: map[int]string{}, Size: len(records) - 1}
+	for i, record := range records[1:] {
+		// Rows are numbered like a spreadsheet, the header is row 1
+		row := i + 2
+		req, err := importRow(record, columns)
+		if err == nil {
+			err = validateRequest(c, &req)
+		}
+		if err != nil {
+			imp.Invalid[row] = importError(c, err)
+			continue
+		}
+		imp.Appointments = append(imp.Appointments, postRequestToAppointment(&req))
+		imp.Rows = append(imp.Rows, row)
+	}
+	return imp, nil
+}
+
+// importRow converts a row to the request for booking it
+func importRow(record []string, columns map[string]int) (PostAppointmentRequest, error) {
+	value := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var (
+		req PostAppointmentRequest
+		err error
+	)
+	parseTime := func(name string) time.Time {
+		t, parseErr := time.Parse(time.RFC3339, value(name))
+		if parseErr != nil && value(name) != "" && err == nil {
+			err = fmt.Errorf("%s must be an RFC 3339 time", name)
+		}
+		return t
+	}
+	parseInt := func(name string) int {
+		n, parseErr := strconv.Atoi(value(name))
+		if parseErr != nil && value(name) != "" && err == nil {
+			err = fmt.Errorf("%s must be a number", name)
+		}
+		return n
+	}
+
+	req.StartTime = parseTime("starts_at")
+	req.EndTime = parseTime("ends_at")
+	req.TrainerID = parseInt("trainer_id")
+	req.UserID = parseInt("user_id")
+	req.SessionType = value("session_type")
+	if tentative := value("tentative"); tentative != "" {
+		var parseErr error
+		req.Tentative, parseErr = strconv.ParseBool(tentative)
+		if parseErr != nil && err == nil {
+			err = fmt.Errorf("tentative must be true or false")
+		}
+	}
+	return req, err
+}
+
+// importError is the message for a row that failed validation, each invalid field is listed in the client's language
+func importError(c echo.Context, err error) string {
+	problem := validationProblemFor(c, err)
+	if len(problem.Errors) == 0 {
+		return problem.Detail
+	}
+	messages := make([]string, 0, len(problem.Errors))
+	for _, field := range problem.Errors {
+		messages = append(messages, field.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// handleGetScheduleExport writes the appointments matching the filters as a csv file
+func handleGetScheduleExport(c echo.Context, appManager appointment.Manager) error {
+	page, err := appManager.ListScheduledAppointments(GetScheduleQuery(c))
+	if err != nil {
+		return managerProblem(err, "error exporting appointments")
+	}
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write(exportColumns)
+	for _, app := range page.Appointments {
+		w.Write([]string{
+			strconv.Itoa(app.ID),
+			string(app.Status),
+			app.StartTime.Format(time.RFC3339),
+			app.EndTime.Format(time.RFC3339),
+			strconv.Itoa(app.TrainerID),
+			strconv.Itoa(app.UserID),
+			strconv.Itoa(app.LocationID),
+			app.SessionType,
+			strconv.Itoa(app.Version),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="appointments.csv"`)
+	return c.Blob(http.StatusOK, mimeCSV+"; charset=utf-8", b.Bytes())
+}
+
+// handlePostScheduleImport books the valid rows of an import, or only checks them in a dry run,
+// and writes a result file with what happened to each row
+func handlePostScheduleImport(c echo.Context, appManager appointment.Manager) error {
+	imp := GetImport(c)
+
+	var (
+		results []appointment.BatchResult
+		err     error
+	)
+	switch {
+	case len(imp.Appointments) == 0:
+	case imp.DryRun:
+		results, err = appManager.CheckAppointments(imp.Appointments)
+	default:
+		results, err = appManager.CreateAppointments(imp.Appointments, false)
+	}
+	if err != nil {
+		return managerProblem(err, "error importing appointments")
+	}
+
+	lines := make([][]string, imp.Size)
+	for row, message := range imp.Invalid {
+		lines[row-2] = []string{strconv.Itoa(row), importFailed, "", "", message}
+	}
+	for j, result := range results {
+		row := imp.Rows[j]
+		switch {
+		case result.Err != nil:
+			lines[row-2] = []string{strconv.Itoa(row), importFailed, "", "", managerProblemFor(result.Err, "error booking appointment").Detail}
+		case imp.DryRun:
+			lines[row-2] = []string{strconv.Itoa(row), importValid, "", string(result.Appointment.Status), ""}
+		default:
+			lines[row-2] = []string{strconv.Itoa(row), importCreated, strconv.Itoa(result.Appointment.ID), string(result.Appointment.Status), ""}
+		}
+	}
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write([]string{"row", "result", "id", "status", "error"})
+	w.WriteAll(lines)
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="import-result.csv"`)
+	return c.Blob(http.StatusOK, mimeCSV+"; charset=utf-8", b.Bytes())
+}
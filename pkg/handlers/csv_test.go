@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// importManager books every appointment except the ones for user 9, which conflict
+type importManager struct {
+	*appointment.MockAppointmentManager
+	created int
+	checked int
+}
+
+func (m *importManager) results(apps []appointment.Appointment) []appointment.BatchResult {
+	results := make([]appointment.BatchResult, len(apps))
+	for i, app := range apps {
+		if app.UserID == 9 {
+			results[i].Err = fmt.Errorf("%w: appointment already exists at this time", appointment.ErrSlotConflict)
+			continue
+		}
+		app.ID = 100 + i
+		app.Status = appointment.StatusConfirmed
+		results[i].Appointment = app
+	}
+	return results
+}
+
+func (m *importManager) CreateAppointments(apps []appointment.Appointment, atomic bool) ([]appointment.BatchResult, error) {
+	m.created += len(apps)
+	return m.results(apps), nil
+}
+
+func (m *importManager) CheckAppointments(apps []appointment.Appointment) ([]appointment.BatchResult, error) {
+	m.checked += len(apps)
+	results := m.results(apps)
+	for i := range results {
+		results[i].Appointment.ID = 0
+	}
+	return results, nil
+}
+
+func readCSV(t *testing.T, rec *httptest.ResponseRecorder) [][]string {
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	require.NoError(t, err)
+	return records
+}
+
+func TestPostScheduleImport(t *testing.T) {
+	body := strings.Join([]string{
+		"\ufefftrainer_id,user_id,starts_at,ends_at,tentative",
+		"1,1,2030-01-07T09:00:00-08:00,2030-01-07T09:30:00-08:00,",
+		"1,9,2030-01-07T10:00:00-08:00,2030-01-07T10:30:00-08:00,",
+		"1,1,2030-01-07T09:15:00-08:00,2030-01-07T09:45:00-08:00,",
+		"1,1,tomorrow,2030-01-07T09:45:00-08:00,",
+		"1,2,2030-01-07T11:00:00-08:00,2030-01-07T11:30:00-08:00,yes please",
+	}, "\n")
+	post := func(target string, contentType string, body string) (*httptest.ResponseRecorder, *importManager) {
+		appManager := &importManager{MockAppointmentManager: appointment.NewMockAppointmentManager(nil, nil)}
+		e := echo.New()
+		BuildRouter(e, appointment.NewSingleTenant(appManager), Config{AllowAnonymous: true})
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec, appManager
+	}
+
+	t.Run("import", func(t *testing.T) {
+		rec, appManager := post("/v1/schedule/import", "text/csv; charset=utf-8", body)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Equal(t, `attachment; filename="import-result.csv"`, rec.Header().Get(echo.HeaderContentDisposition))
+		assert.Equal(t, 2, appManager.created)
+
+		records := readCSV(t, rec)
+		require.Len(t, records, 6)
+		assert.Equal(t, []string{"row", "result", "id", "status", "error"}, records[0])
+		assert.Equal(t, []string{"2", "created", "100", "confirmed", ""}, records[1])
+		assert.Equal(t, []string{"3", "failed", "", ""}, records[2][:4])
+		assert.Contains(t, records[2][4], "appointment already exists at this time")
+		assert.Equal(t, []string{"4", "failed", "", "", "starts_at must be on the hour or half-hour; ends_at must be on the hour or half-hour"}, records[3])
+		assert.Equal(t, []string{"5", "failed", "", "", "starts_at must be an RFC 3339 time"}, records[4])
+		assert.Equal(t, []string{"6", "failed", "", "", "tentative must be true or false"}, records[5])
+	})
+	t.Run("dry run", func(t *testing.T) {
+		rec, appManager := post("/v1/schedule/import?dry_run=true", "text/csv", body)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Zero(t, appManager.created)
+		assert.Equal(t, 2, appManager.checked)
+
+		records := readCSV(t, rec)
+		assert.Equal(t, []string{"2", "valid", "", "confirmed", ""}, records[1])
+		assert.Equal(t, "failed", records[2][1])
+	})
+	t.Run("invalid file", func(t *testing.T) {
+		rec, _ := post("/v1/schedule/import", "text/csv", "trainer_id,user_id\n1,1")
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Contains(t, rec.Body.String(), CodeInvalidCSV)
+		assert.Contains(t, rec.Body.String(), "the starts_at column is missing")
+
+		rec, _ = post("/v1/schedule/import", echo.MIMEApplicationJSON, "{}")
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	})
+	t.Run("largest import", func(t *testing.T) {
+		// An edited export with every column, well over the default body limit
+		rows := []string{strings.Join(exportColumns, ",")}
+		for i := 0; i < maxImportRows; i++ {
+			// Every half hour slot of the business day, day after day
+			at := time.Date(2030, 1, 7+i/18, 8, 30*(i%18), 0, 0, time.UTC)
+			rows = append(rows, fmt.Sprintf("%d,confirmed,%s,%s,1,1,1,personal_training,1", i+1, at.Format(time.RFC3339), at.Add(30*time.Minute).Format(time.RFC3339)))
+		}
+		rec, appManager := post("/v1/schedule/import", "text/csv", strings.Join(rows, "\n"))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Equal(t, maxImportRows, appManager.created)
+
+		rows = append(rows, rows[1])
+		rec, _ = post("/v1/schedule/import", "text/csv", strings.Join(rows, "\n"))
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Contains(t, rec.Body.String(), "the file has more than 1000 appointments")
+	})
+}
+
+func TestGetScheduleExport(t *testing.T) {
+	start := time.Date(2030, 1, 7, 17, 0, 0, 0, time.UTC)
+	appManager := appointment.NewMockAppointmentManager([]appointment.Appointment{
+		{ID: 4, TrainerID: 1, UserID: 5, LocationID: 2, StartTime: start, EndTime: start.Add(30 * time.Minute), Status: appointment.StatusConfirmed, SessionType: "standard", Version: 3},
+	}, nil)
+	e := echo.New()
+	BuildRouter(e, appointment.NewSingleTenant(appManager), Config{AllowAnonymous: true})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/schedule/export?trainer_id=1&from=2030-01-01T00:00:00Z", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, [][]string{
+		exportColumns,
+		{"4", "confirmed", "2030-01-07T17:00:00Z", "2030-01-07T17:30:00Z", "1", "5", "2", "standard", "3"},
+	}, readCSV(t, rec))
+
+	// A filter is required like for the schedule
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/schedule/export", nil))
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+)
+
+const (
+	headerETag        = "ETag"
+	headerIfMatch     = "If-Match"
+	headerIfNoneMatch = "If-None-Match"
+)
+
+// appointmentETag is the appointment's version, clients send it back in If-Match to change the appointment
+func appointmentETag(app appointment.Appointment) string {
+	return fmt.Sprintf(`"%d"`, app.Version)
+}
+
+// bodyETag is a weak ETag for a response made of many appointments, it changes when any of them do
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf(`W/"%s"`, hex.EncodeToString(sum[:16]))
+}
+
+// notModified reports whether the request's If-None-Match has the ETag, weak and strong ETags with the same value match
+func notModified(req *http.Request, etag string) bool {
+	header := req.Header.Get(headerIfNoneMatch)
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchVersion returns the appointment version in the If-Match header, * matches any version.
+// Changes without If-Match are refused so a client can't overwrite a change it hasn't seen.
+func ifMatchVersion(c echo.Context) (int, error) {
+	header := strings.TrimSpace(c.Request().Header.Get(headerIfMatch))
+	if header == "" {
+		return 0, newProblem(http.StatusPreconditionRequired, CodePreconditionRequired, "If-Match is required, send the ETag of the appointment")
+	}
+	if header == "*" {
+		return appointment.AnyVersion, nil
+	}
+
+	// If-Match uses strong comparison so a weak ETag or a list can never match an appointment
+	version, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(header, `"`), `"`))
+	if err != nil || !strings.HasPrefix(header, `"`) || version <= 0 {
+		return 0, newProblem(http.StatusPreconditionFailed, CodeVersionMismatch, fmt.Sprintf("If-Match %s is not the ETag of an appointment", header))
+	}
+	return version, nil
+}
+
+// requiresIfMatch reports whether requests to the route within its version must send If-Match,
+// these change an existing appointment outside its lifecycle
+func requiresIfMatch(route string) bool {
+	method, path, _ := strings.Cut(route, " ")
+	return (method == http.MethodPatch || method == http.MethodDelete) && strings.HasPrefix(path, "/schedule/")
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIfMatchVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifMatch string
+		version int
+		status  int
+		code    string
+	}{
+		{name: "etag", ifMatch: `"3"`, version: 3},
+		{name: "any version", ifMatch: "*", version: appointment.AnyVersion},
+		{name: "missing", status: http.StatusPreconditionRequired, code: CodePreconditionRequired},
+		{name: "weak etag", ifMatch: `W/"3"`, status: http.StatusPreconditionFailed, code: CodeVersionMismatch},
+		{name: "list", ifMatch: `"3", "4"`, status: http.StatusPreconditionFailed, code: CodeVersionMismatch},
+		{name: "not an appointment etag", ifMatch: `"abc"`, status: http.StatusPreconditionFailed, code: CodeVersionMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newContext()
+			if tt.ifMatch != "" {
+				c.Request().Header.Set(headerIfMatch, tt.ifMatch)
+			}
+			version, err := ifMatchVersion(c)
+			if tt.status != 0 {
+				assertProblem(t, err, tt.status, tt.code)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.version, version)
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.False(t, notModified(req, `"1"`))
+
+	req.Header.Set(headerIfNoneMatch, `"2", W/"1"`)
+	assert.True(t, notModified(req, `"1"`))
+	assert.False(t, notModified(req, `"3"`))
+
+	req.Header.Set(headerIfNoneMatch, "*")
+	assert.True(t, notModified(req, `"3"`))
+}
+
+func TestAppointmentETags(t *testing.T) {
+	appManager := appointment.NewMockAppointmentManager([]appointment.Appointment{{ID: 1, TrainerID: 1, Version: 4}}, nil)
+	e := echo.New()
+	BuildRouter(e, appointment.NewSingleTenant(appManager), Config{AllowAnonymous: true})
+	serve := func(method string, path string, header http.Header, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("get returns the version as the etag", func(t *testing.T) {
+		rec := serve(http.MethodGet, "/v1/schedule/1", nil, "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `"4"`, rec.Header().Get(headerETag))
+
+		rec = serve(http.MethodGet, "/v1/schedule/1", http.Header{headerIfNoneMatch: {`"4"`}}, "")
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+		assert.Empty(t, rec.Body.String())
+	})
+	t.Run("schedule reads are not modified until the body changes", func(t *testing.T) {
+		rec := serve(http.MethodGet, "/v1/schedule?trainer_id=1", nil, "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		etag := rec.Header().Get(headerETag)
+		assert.True(t, strings.HasPrefix(etag, `W/"`))
+
+		rec = serve(http.MethodGet, "/v1/schedule?trainer_id=1", http.Header{headerIfNoneMatch: {etag}}, "")
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+
+		// The other version of the response is a different body
+		rec = serve(http.MethodGet, "/v1/schedule?trainer_id=1", http.Header{headerIfNoneMatch: {etag}, echo.HeaderAccept: {"application/json; version=2"}}, "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+	t.Run("changes need if-match", func(t *testing.T) {
+		rec := serve(http.MethodPatch, "/v1/schedule/1", nil, `{"session_type": "standard"}`)
+		assert.Equal(t, http.StatusPreconditionRequired, rec.Code)
+		rec = serve(http.MethodDelete, "/v1/schedule/1", nil, "")
+		assert.Equal(t, http.StatusPreconditionRequired, rec.Code)
+
+		rec = serve(http.MethodDelete, "/v1/schedule/1", http.Header{headerIfMatch: {`"4"`}}, "")
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+	t.Run("stale version", func(t *testing.T) {
+		appManager.Err = appointment.ErrVersionMismatch
+		defer func() { appManager.Err = nil }()
+
+		rec := serve(http.MethodPatch, "/v1/schedule/1", http.Header{headerIfMatch: {`"3"`}}, `{"session_type": "standard"}`)
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+		assert.Contains(t, rec.Body.String(), CodeVersionMismatch)
+	})
+}
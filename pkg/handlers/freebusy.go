@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/justinthompson/appointment/pkg/ical"
+)
+
+// FreeBusyResponse is when a trainer is busy, it doesn't say who with so it can be shared with partners
+type FreeBusyResponse struct {
+	TrainerID int                    `json:"trainer_id"`
+	From      time.Time              `json:"from"`
+	To        time.Time              `json:"to"`
+	Busy      []appointment.Interval `json:"busy"`
+}
+
+// handleGetFreeBusy writes when the trainer is busy as json, or as an iCalendar VFREEBUSY when the client accepts text/calendar
+func handleGetFreeBusy(c echo.Context, appManager appointment.Manager) error {
+	appRequest := GetAppointment(c)
+	busy, err := appManager.GetFreeBusy(appRequest.TrainerID, appRequest.StartTime, appRequest.EndTime)
+	if err != nil {
+		return managerProblem(err, "error getting free/busy")
+	}
+	if busy == nil {
+		busy = []appointment.Interval{}
+	}
+
+	if !acceptsCalendar(c) {
+		return c.JSON(http.StatusOK, FreeBusyResponse{TrainerID: appRequest.TrainerID, From: appRequest.StartTime, To: appRequest.EndTime, Busy: busy})
+	}
+
+	fb := ical.FreeBusy{
+		UID:   fmt.Sprintf("freebusy-trainer-%d.%s@appointment", appRequest.TrainerID, GetTenantID(c)),
+		Stamp: time.Now(),
+		Start: appRequest.StartTime,
+		End:   appRequest.EndTime,
+	}
+	for _, interval := range busy {
+		fb.Busy = append(fb.Busy, ical.Period{Start: interval.StartTime, End: interval.EndTime})
+	}
+	var b bytes.Buffer
+	if err := (ical.Calendar{ProdID: calendarProdID, FreeBusy: []ical.FreeBusy{fb}}).Encode(&b); err != nil {
+		return err
+	}
+	return c.Blob(http.StatusOK, ical.MIMEType+"; charset=utf-8", b.Bytes())
+}
+
+// acceptsCalendar reports whether the client asked for text/calendar, anything else gets json
+func acceptsCalendar(c echo.Context) bool {
+	c.Response().Header().Add(echo.HeaderVary, "Accept")
+	for _, accept := range strings.Split(c.Request().Header.Get(echo.HeaderAccept), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediaType == ical.MIMEType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/justinthompson/appointment/pkg/ical"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetFreeBusy(t *testing.T) {
+	start := time.Date(2030, 1, 7, 17, 0, 0, 0, time.UTC)
+	appManager := appointment.NewMockAppointmentManager([]appointment.Appointment{
+		{ID: 4, TrainerID: 1, UserID: 5, StartTime: start, EndTime: start.Add(30 * time.Minute)},
+	}, nil)
+	e := echo.New()
+	BuildRouter(e, appointment.NewSingleTenant(appManager), Config{AllowAnonymous: true})
+	get := func(target string, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set(echo.HeaderAccept, accept)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	target := "/v1/trainers/1/freebusy?from=2030-01-07T00:00:00Z&to=2030-01-08T00:00:00Z"
+
+	t.Run("json", func(t *testing.T) {
+		rec := get(target, "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Header().Values(echo.HeaderVary), "Accept")
+		var res FreeBusyResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, 1, res.TrainerID)
+		assert.Equal(t, []appointment.Interval{{StartTime: start, EndTime: start.Add(30 * time.Minute)}}, res.Busy)
+		// Nothing about who the appointment is with
+		assert.NotContains(t, rec.Body.String(), "user_id")
+	})
+	t.Run("icalendar", func(t *testing.T) {
+		rec := get(target, "text/calendar, application/json;q=0.5")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/calendar; charset=utf-8", rec.Header().Get(echo.HeaderContentType))
+		body := rec.Body.String()
+		assert.Contains(t, body, "BEGIN:VFREEBUSY\r\nUID:freebusy-trainer-1.default@appointment\r\n")
+		assert.Contains(t, body, "FREEBUSY;FBTYPE=BUSY:20300107T170000Z/20300107T173000Z\r\n")
+		assert.Equal(t, 0, strings.Count(body, "BEGIN:VEVENT"))
+	})
+	t.Run("range is required", func(t *testing.T) {
+		rec := get("/v1/trainers/1/freebusy?from=2030-01-08T00:00:00Z&to=2030-01-07T00:00:00Z", "")
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Equal(t, http.StatusUnprocessableEntity, get("/v1/trainers/1/freebusy", "").Code)
+	})
+}
+
+func TestOpenAPISpec_FreeBusyFormats(t *testing.T) {
+	spec, err := openAPISpec(newTestRouter().Routes())
+	require.NoError(t, err)
+	content := spec.Paths["/v1/trainers/{id}/freebusy"]["get"].Responses["200"].Content
+	assert.Contains(t, content, echo.MIMEApplicationJSON)
+	assert.Contains(t, content, ical.MIMEType)
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/justinthompson/appointment/pkg/appointment"
 	"github.com/labstack/echo/v4"
@@ -11,29 +12,197 @@ import (
 // handleGetAvailableTimes
 func handleGetAvailableTimes(c echo.Context, appManager appointment.Manager) error {
 	appRequest := GetAppointment(c)
+	version, err := responseVersion(c)
+	if err != nil {
+		return err
+	}
 
 	availableAppointments, err := appManager.GetAvailableAppointments(appRequest)
 	if err != nil {
-		return c.String(http.StatusBadRequest, fmt.Errorf("error getting available appointments: %w", err).Error())
+		return managerProblem(err, "error getting available appointments")
 	}
-	return c.JSON(http.StatusOK, availableAppointments)
+	return writeAppointments(c, http.StatusOK, version, availableAppointments)
 }
 
+// handleGetScheduledAppointments returns a page of the schedule with a Link to the next page if there is one
 func handleGetScheduledAppointments(c echo.Context, appManager appointment.Manager) error {
-	appRequest := GetAppointment(c)
+	query := GetScheduleQuery(c)
+	version, err := responseVersion(c)
+	if err != nil {
+		return err
+	}
 
-	appointments, err := appManager.GetScheduledAppointments(appRequest.TrainerID)
+	page, err := appManager.ListScheduledAppointments(query)
 	if err != nil {
-		return c.String(http.StatusBadRequest, fmt.Errorf("error getting scheduled appointments: %w", err).Error())
+		return managerProblem(err, "error getting scheduled appointments")
 	}
-	return c.JSON(http.StatusOK, appointments)
+	if page.NextCursor != "" {
+		c.Response().Header().Add(headerLink, nextPageLink(c.Request().URL, page.NextCursor))
+	}
+	return writeAppointments(c, http.StatusOK, version, page.Appointments)
+}
+
+// nextPageLink links to the same request with the cursor for the next page
+func nextPageLink(u *url.URL, cursor string) string {
+	values := u.Query()
+	values.Set("cursor", cursor)
+	next := url.URL{Path: u.Path, RawQuery: values.Encode()}
+	return fmt.Sprintf(`<%s>; rel="next"`, next.String())
 }
 
 func handlePostAppointment(c echo.Context, appManager appointment.Manager) error {
 	appRequest := GetAppointment(c)
-	err := appManager.CreateAppointment(appRequest)
+	// The version is checked before booking so a response the client can't read doesn't leave a booking behind
+	version, err := responseVersion(c)
+	if err != nil {
+		return err
+	}
+
+	app, err := appManager.CreateAppointment(appRequest)
+	if err != nil {
+		return managerProblem(err, "error creating appointment")
+	}
+	return writeAppointment(c, http.StatusCreated, version, app)
+}
+
+// handlePostBatch books the appointments in the batch and says what happened to each one.
+// An atomic batch that isn't booked is a problem with the items, its status is the status of the first appointment that failed.
+func handlePostBatch(c echo.Context, appManager appointment.Manager) error {
+	batch := GetBatch(c)
+	version, err := responseVersion(c)
+	if err != nil {
+		return err
+	}
+
+	items := make([]BatchItemResponse, batch.Size)
+	first := batch.Size
+	for i, problem := range batch.Invalid {
+		items[i] = problemItem(problem)
+		if i < first {
+			first = i
+		}
+	}
+	// An atomic batch with an invalid appointment isn't sent to the manager at all
+	if batch.Atomic && len(batch.Invalid) > 0 {
+		for _, i := range batch.Indexes {
+			items[i] = problemItem(problemFor(http.StatusFailedDependency, CodeBatchAborted, fmt.Sprintf("not booked because appointment %d failed", first)))
+		}
+		return batchProblem(problemFor(http.StatusUnprocessableEntity, CodeBatchFailed, fmt.Sprintf("appointment %d has invalid fields", first)), items)
+	}
+
+	results, err := appManager.CreateAppointments(batch.Appointments, batch.Atomic)
+	if err != nil && results == nil {
+		return managerProblem(err, "error booking appointments")
+	}
+	for j, result := range results {
+		i := batch.Indexes[j]
+		if result.Err != nil {
+			items[i] = problemItem(managerProblemFor(result.Err, "error booking appointment"))
+			continue
+		}
+		items[i] = BatchItemResponse{Status: http.StatusCreated, Appointment: appointmentResponse(version, result.Appointment)}
+	}
+	if err != nil {
+		problem := managerProblemFor(err, "error booking appointments")
+		problem.Code = CodeBatchFailed
+		return batchProblem(problem, items)
+	}
+
+	setVersionContentType(c, version)
+	return c.JSON(http.StatusOK, BatchResponse{Items: items})
+}
+
+// problemItem is a batch item for an appointment that wasn't booked
+func problemItem(problem Problem) BatchItemResponse {
+	return BatchItemResponse{Status: problem.Status, Problem: &problem}
+}
+
+// batchProblem is the problem for a failed batch with what happened to each appointment
+func batchProblem(problem Problem, items []BatchItemResponse) *echo.HTTPError {
+	problem.Items = items
+	return echo.NewHTTPError(problem.Status, problem)
+}
+
+// handleGetAppointment returns the appointment in the path with its version as the ETag
+func handleGetAppointment(c echo.Context, appManager appointment.Manager) error {
+	appRequest := GetAppointment(c)
+	version, err := responseVersion(c)
+	if err != nil {
+		return err
+	}
+
+	app, err := appManager.GetAppointment(appRequest.ID)
+	if err != nil {
+		return managerProblem(err, "error getting appointment")
+	}
+	if etag := appointmentETag(app); notModified(c.Request(), etag) {
+		c.Response().Header().Set(headerETag, etag)
+		return c.NoContent(http.StatusNotModified)
+	}
+	return writeAppointment(c, http.StatusOK, version, app)
+}
+
+// handlePatchAppointment changes the appointment in the path if it is still at the version in If-Match
+func handlePatchAppointment(c echo.Context, appManager appointment.Manager) error {
+	changes := GetAppointment(c)
+	expected, err := ifMatchVersion(c)
+	if err != nil {
+		return err
+	}
+	version, err := responseVersion(c)
+	if err != nil {
+		return err
+	}
+
+	app, err := appManager.UpdateAppointment(changes, expected)
+	if err != nil {
+		return managerProblem(err, "error updating appointment")
+	}
+	return writeAppointment(c, http.StatusOK, version, app)
+}
+
+// handleDeleteAppointment removes the appointment in the path if it is still at the version in If-Match
+func handleDeleteAppointment(c echo.Context, appManager appointment.Manager) error {
+	appRequest := GetAppointment(c)
+	expected, err := ifMatchVersion(c)
+	if err != nil {
+		return err
+	}
+
+	if err := appManager.DeleteAppointment(appRequest.ID, expected); err != nil {
+		return managerProblem(err, "error deleting appointment")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// handleTransitionAppointment moves the appointment in the path through its lifecycle
+func handleTransitionAppointment(c echo.Context, appManager appointment.Manager, action appointment.Action) error {
+	appRequest := GetAppointment(c)
+	version, err := responseVersion(c)
+	if err != nil {
+		return err
+	}
+
+	app, err := appManager.TransitionAppointment(appRequest.ID, action)
+	if err != nil {
+		return managerProblem(err, "error updating appointment")
+	}
+	return writeAppointment(c, http.StatusOK, version, app)
+}
+
+func handleGetLocations(c echo.Context, appManager appointment.Manager) error {
+	locations, err := appManager.GetLocations()
+	if err != nil {
+		return managerProblem(err, "error getting locations")
+	}
+	return c.JSON(http.StatusOK, locations)
+}
+
+func handleGetAttendanceRecord(c echo.Context, appManager appointment.Manager) error {
+	appRequest := GetAppointment(c)
+	record, err := appManager.GetAttendanceRecord(appRequest.UserID)
 	if err != nil {
-		return c.String(http.StatusBadRequest, fmt.Errorf("error creating appointment: %w", err).Error())
+		return managerProblem(err, "error getting attendance record")
 	}
-	return c.NoContent(http.StatusCreated)
+	return c.JSON(http.StatusOK, record)
 }
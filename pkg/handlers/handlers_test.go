@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"testing"
 
 	"github.com/justinthompson/appointment/pkg/appointment"
@@ -18,6 +19,14 @@ func assertHTTPError(t *testing.T, err error, code int) {
 	assert.Equal(t, code, httpError.Code)
 }
 
+func assertProblem(t *testing.T, err error, code int, problemCode string) {
+	assertHTTPError(t, err, code)
+	problem, ok := err.(*echo.HTTPError).Message.(Problem)
+	require.True(t, ok)
+	assert.Equal(t, code, problem.Status)
+	assert.Equal(t, problemCode, problem.Code)
+}
+
 func TestHandleGetAvailableTimes(t *testing.T) {
 	t.Run("successful retrieval of available appointments", func(t *testing.T) {
 		appManager := appointment.NewMockAppointmentManager([]appointment.Appointment{{TrainerID: 1}}, nil)
@@ -27,7 +36,7 @@ func TestHandleGetAvailableTimes(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, http.StatusOK, rec.Code)
 
-		var availableAppointments []appointment.Appointment
+		var availableAppointments []LegacyAppointmentResponse
 		err = json.Unmarshal(rec.Body.Bytes(), &availableAppointments)
 		require.NoError(t, err)
 		require.NotEmpty(t, availableAppointments)
@@ -35,11 +44,11 @@ func TestHandleGetAvailableTimes(t *testing.T) {
 
 	})
 	t.Run("error handling when GetAvailableAppointments returns an error", func(t *testing.T) {
-		appManager := appointment.NewMockAppointmentManager([]appointment.Appointment{}, fmt.Errorf("error getting available appointments"))
+		appManager := appointment.NewMockAppointmentManager([]appointment.Appointment{}, appointment.ErrTrainerNotFound)
 		c, _ := newContext()
 		SetAppointment(c, appointment.Appointment{TrainerID: 1})
 		err := handleGetAvailableTimes(c, appManager)
-		assertHTTPError(t, err, http.StatusBadRequest)
+		assertProblem(t, err, http.StatusNotFound, CodeTrainerNotFound)
 	})
 }
 
@@ -47,27 +56,44 @@ func TestHandleGetScheduledAppointments(t *testing.T) {
 	t.Run("successful retrieval of scheduled appointments", func(t *testing.T) {
 		appManager := appointment.NewMockAppointmentManager([]appointment.Appointment{{TrainerID: 1}}, nil)
 		c, rec := newContext()
-		SetAppointment(c, appointment.Appointment{TrainerID: 1})
+		SetScheduleQuery(c, appointment.ScheduleQuery{TrainerID: 1})
 		err := handleGetScheduledAppointments(c, appManager)
 		require.NoError(t, err)
 		assert.Equal(t, http.StatusOK, rec.Code)
 
-		var availableAppointments []appointment.Appointment
+		var availableAppointments []LegacyAppointmentResponse
 		err = json.Unmarshal(rec.Body.Bytes(), &availableAppointments)
 		require.NoError(t, err)
 		require.NotEmpty(t, availableAppointments)
 		assert.Equal(t, 1, availableAppointments[0].TrainerID)
 
 	})
+	t.Run("link to the next page", func(t *testing.T) {
+		appManager := &nextPageManager{MockAppointmentManager: appointment.NewMockAppointmentManager(nil, nil)}
+		c, rec := newContext()
+		c.Request().URL, _ = url.Parse("/v1/schedule?trainer_id=1&limit=2&cursor=abc")
+		SetScheduleQuery(c, appointment.ScheduleQuery{TrainerID: 1, Limit: 2})
+		require.NoError(t, handleGetScheduledAppointments(c, appManager))
+		assert.Equal(t, `</v1/schedule?cursor=next&limit=2&trainer_id=1>; rel="next"`, rec.Header().Get(headerLink))
+	})
 	t.Run("error handling when GetScheduledAppointments returns an error", func(t *testing.T) {
-		appManager := appointment.NewMockAppointmentManager([]appointment.Appointment{}, fmt.Errorf("error getting scheduled appointments"))
+		appManager := appointment.NewMockAppointmentManager([]appointment.Appointment{}, appointment.ErrLocationNotFound)
 		c, _ := newContext()
-		SetAppointment(c, appointment.Appointment{TrainerID: 1})
+		SetScheduleQuery(c, appointment.ScheduleQuery{TrainerID: 1})
 		err := handleGetScheduledAppointments(c, appManager)
-		assertHTTPError(t, err, http.StatusBadRequest)
+		assertProblem(t, err, http.StatusNotFound, CodeLocationNotFound)
 	})
 }
 
+// nextPageManager returns a page with a next cursor
+type nextPageManager struct {
+	*appointment.MockAppointmentManager
+}
+
+func (m *nextPageManager) ListScheduledAppointments(query appointment.ScheduleQuery) (appointment.SchedulePage, error) {
+	return appointment.SchedulePage{NextCursor: "next"}, nil
+}
+
 func TestHandlePostAppointment(t *testing.T) {
 	t.Run("successful creation of an appointment", func(t *testing.T) {
 		appManager := appointment.NewMockAppointmentManager([]appointment.Appointment{{TrainerID: 1}}, nil)
@@ -78,10 +104,59 @@ func TestHandlePostAppointment(t *testing.T) {
 		assert.Equal(t, http.StatusCreated, c.Response().Status)
 	})
 	t.Run("error handling when CreateAppointment returns an error", func(t *testing.T) {
+		appManager := appointment.NewMockAppointmentManager([]appointment.Appointment{}, appointment.ErrSlotConflict)
+		c, _ := newContext()
+		SetAppointment(c, appointment.Appointment{TrainerID: 1})
+		err := handlePostAppointment(c, appManager)
+		assertProblem(t, err, http.StatusConflict, CodeSlotConflict)
+	})
+	t.Run("validation error from CreateAppointment", func(t *testing.T) {
+		appManager := appointment.NewMockAppointmentManager([]appointment.Appointment{}, fmt.Errorf("bad duration: %w", appointment.ErrValidation))
+		c, _ := newContext()
+		SetAppointment(c, appointment.Appointment{TrainerID: 1})
+		err := handlePostAppointment(c, appManager)
+		assertProblem(t, err, http.StatusUnprocessableEntity, CodeValidationFailed)
+	})
+	t.Run("unexpected error from CreateAppointment", func(t *testing.T) {
 		appManager := appointment.NewMockAppointmentManager([]appointment.Appointment{}, fmt.Errorf("error creating appointment"))
 		c, _ := newContext()
 		SetAppointment(c, appointment.Appointment{TrainerID: 1})
 		err := handlePostAppointment(c, appManager)
-		assertHTTPError(t, err, http.StatusBadRequest)
+		assertProblem(t, err, http.StatusInternalServerError, CodeInternal)
 	})
 }
+
+func TestHandleTransitionAppointment(t *testing.T) {
+	t.Run("successful transition", func(t *testing.T) {
+		appManager := appointment.NewMockAppointmentManager(nil, nil)
+		c, rec := newContext()
+		SetAppointment(c, appointment.Appointment{ID: 3})
+		err := handleTransitionAppointment(c, appManager, appointment.ActionConfirm)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var app LegacyAppointmentResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &app))
+		assert.Equal(t, 3, app.ID)
+	})
+	t.Run("error handling when TransitionAppointment returns an error", func(t *testing.T) {
+		appManager := appointment.NewMockAppointmentManager(nil, appointment.ErrInvalidTransition)
+		c, _ := newContext()
+		SetAppointment(c, appointment.Appointment{ID: 3})
+		err := handleTransitionAppointment(c, appManager, appointment.ActionConfirm)
+		assertProblem(t, err, http.StatusConflict, CodeInvalidTransition)
+	})
+}
+
+func TestHandleGetAttendanceRecord(t *testing.T) {
+	appManager := appointment.NewMockAppointmentManager(nil, nil)
+	c, rec := newContext()
+	SetAppointment(c, appointment.Appointment{UserID: 4})
+	err := handleGetAttendanceRecord(c, appManager)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var record appointment.AttendanceRecord
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &record))
+	assert.Equal(t, 4, record.UserID)
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	headerIdempotencyKey     = "Idempotency-Key"
+	headerIdempotentReplayed = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	defaultIdempotencyWindow = 24 * time.Hour
+)
+
+type (
+	// idempotencyStore keeps the first response to each Idempotency-Key so a retry gets the same response instead of repeating the change
+	idempotencyStore struct {
+		mu        sync.Mutex
+		now       func() time.Time
+		window    time.Duration
+		responses map[string]*idempotentResponse
+	}
+
+	// idempotentResponse is the response to the first request with a key, it isn't done until that request finishes
+	idempotentResponse struct {
+		fingerprint [sha256.Size]byte
+		createdAt   time.Time
+		done        bool
+		status      int
+		header      http.Header
+		body        []byte
+	}
+
+	// responseRecorder copies everything written to the response so it can be replayed
+	responseRecorder struct {
+		http.ResponseWriter
+		status int
+		body   bytes.Buffer
+	}
+)
+
+func newIdempotencyStore(window time.Duration) *idempotencyStore {
+	if window <= 0 {
+		window = defaultIdempotencyWindow
+	}
+	return &idempotencyStore{
+		now:       time.Now,
+		window:    window,
+		responses: make(map[string]*idempotentResponse),
+	}
+}
+
+// MiddlewareIdempotency replays the stored response when a mutating request is retried with the same Idempotency-Key.
+// Keys are per tenant and api key, and a key can only be used again with the same method, path, If-Match and body.
+// Server errors aren't stored so the request can be retried.
+func MiddlewareIdempotency(store *idempotencyStore) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(headerIdempotencyKey)
+			if key == "" || !isMutating(c.Request().Method) {
+				return next(c)
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				return newProblem(http.StatusBadRequest, CodeBadRequest, fmt.Sprintf("%s must be at most %d characters", headerIdempotencyKey, maxIdempotencyKeyLength))
+			}
+
+			fingerprint, err := requestFingerprint(c.Request())
+			if err != nil {
+				return newProblem(http.StatusBadRequest, CodeBadRequest, "error reading request body")
+			}
+
+			key = GetTenantID(c) + "\x00" + GetAPIKey(c).ID + "\x00" + key
+			stored, err := store.begin(key, fingerprint)
+			if err != nil {
+				return err
+			}
+			if stored != nil {
+				return replay(c, stored)
+			}
+
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+			defer func() {
+				c.Response().Writer = recorder.ResponseWriter
+				// A panic leaves the key reserved, release it so the request can be retried
+				if !recorder.written() {
+					store.release(key)
+				}
+			}()
+
+			// The error is written here rather than by echo so the problem is recorded and replayed like any other response
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+			if recorder.status >= http.StatusInternalServerError {
+				store.release(key)
+				return nil
+			}
+			store.finish(key, recorder.status, c.Response().Header(), recorder.body.Bytes())
+			return nil
+		}
+	}
+}
+
+// begin reserves the key for a request, a stored response is returned if the key was already used by the same request
+func (s *idempotencyStore) begin(key string, fingerprint [sha256.Size]byte) (*idempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for k, response := range s.responses {
+		if response.done && now.Sub(response.createdAt) >= s.window {
+			delete(s.responses, k)
+		}
+	}
+
+	response, ok := s.responses[key]
+	if !ok {
+		s.responses[key] = &idempotentResponse{fingerprint: fingerprint, createdAt: now}
+		return nil, nil
+	}
+	if response.fingerprint != fingerprint {
+		return nil, newProblem(http.StatusUnprocessableEntity, CodeIdempotencyKeyReused, "the idempotency key was already used for a different request")
+	}
+	if !response.done {
+		return nil, newProblem(http.StatusConflict, CodeIdempotencyKeyInProgress, "a request with this idempotency key is still being processed")
+	}
+	return response, nil
+}
+
+// finish stores the response for the key
+func (s *idempotencyStore) finish(key string, status int, header http.Header, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if response, ok := s.responses[key]; ok {
+		response.done = true
+		response.status = status
+		response.header = header.Clone()
+		response.body = append([]byte(nil), body...)
+	}
+}
+
+// release forgets the key so the request can be tried again
+func (s *idempotencyStore) release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if response, ok := s.responses[key]; ok && !response.done {
+		delete(s.responses, key)
+	}
+}
+
+// replay writes a stored response
+func replay(c echo.Context, stored *idempotentResponse) error {
+	header := c.Response().Header()
+	for name, values := range stored.header {
+		header[name] = values
+	}
+	header.Set(headerIdempotentReplayed, "true")
+	return c.Blob(stored.status, stored.header.Get(echo.HeaderContentType), stored.body)
+}
+
+// requestFingerprint hashes what makes two requests the same, the body is put back for the handler to bind.
+// The path is hashed without its version so a retry of a legacy route on /v1 is the same request,
+// and If-Match is hashed so a retry with a different precondition isn't answered with the old response.
+func requestFingerprint(req *http.Request) ([sha256.Size]byte, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s?%s\n%s\n", versionRoute(req.Method, req.URL.Path), req.URL.RawQuery, req.Header.Get(headerIfMatch))
+	h.Write(body)
+
+	var fingerprint [sha256.Size]byte
+	copy(fingerprint[:], h.Sum(nil))
+	return fingerprint, nil
+}
+
+// isMutating reports whether requests with the method change anything
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// written reports whether a response was written
+func (r *responseRecorder) written() bool {
+	return r.status != 0
+}
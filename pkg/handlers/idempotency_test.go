@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingManager counts the appointments it is asked to create
+type countingManager struct {
+	*appointment.MockAppointmentManager
+	created int
+}
+
+func (m *countingManager) CreateAppointment(app appointment.Appointment) (appointment.Appointment, error) {
+	m.created++
+	app.ID = m.created
+	return m.MockAppointmentManager.CreateAppointment(app)
+}
+
+const idempotentBody = `{"starts_at": "2030-01-01T09:00:00Z", "ends_at": "2030-01-01T09:30:00Z", "trainer_id": 1, "user_id": 1}`
+
+func postWithKey(e *echo.Echo, key string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/schedule", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(headerIdempotencyKey, key)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func newIdempotentRouter(err error) (*echo.Echo, *countingManager) {
+	appManager := &countingManager{MockAppointmentManager: appointment.NewMockAppointmentManager(nil, err)}
+	e := echo.New()
+	BuildRouter(e, appointment.NewSingleTenant(appManager), Config{AllowAnonymous: true})
+	return e, appManager
+}
+
+func TestMiddlewareIdempotency(t *testing.T) {
+	t.Run("retry is replayed", func(t *testing.T) {
+		e, appManager := newIdempotentRouter(nil)
+		first := postWithKey(e, "booking-1", idempotentBody)
+		require.Equal(t, http.StatusCreated, first.Code)
+
+		retry := postWithKey(e, "booking-1", idempotentBody)
+		assert.Equal(t, http.StatusCreated, retry.Code)
+		assert.Equal(t, first.Body.String(), retry.Body.String())
+		assert.Equal(t, first.Header().Get(echo.HeaderContentType), retry.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, "true", retry.Header().Get(headerIdempotentReplayed))
+		assert.Equal(t, 1, appManager.created)
+	})
+	t.Run("new key books again", func(t *testing.T) {
+		e, appManager := newIdempotentRouter(nil)
+		postWithKey(e, "booking-1", idempotentBody)
+		rec := postWithKey(e, "booking-2", idempotentBody)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Empty(t, rec.Header().Get(headerIdempotentReplayed))
+		assert.Equal(t, 2, appManager.created)
+	})
+	t.Run("key reused with a different body", func(t *testing.T) {
+		e, appManager := newIdempotentRouter(nil)
+		postWithKey(e, "booking-1", idempotentBody)
+		rec := postWithKey(e, "booking-1", strings.Replace(idempotentBody, `"user_id": 1`, `"user_id": 2`, 1))
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Contains(t, rec.Body.String(), CodeIdempotencyKeyReused)
+		assert.Equal(t, 1, appManager.created)
+	})
+	t.Run("client errors are replayed", func(t *testing.T) {
+		e, appManager := newIdempotentRouter(appointment.ErrSlotConflict)
+		first := postWithKey(e, "booking-1", idempotentBody)
+		require.Equal(t, http.StatusConflict, first.Code)
+		assert.Equal(t, mimeProblemJSON, first.Header().Get(echo.HeaderContentType))
+
+		retry := postWithKey(e, "booking-1", idempotentBody)
+		assert.Equal(t, http.StatusConflict, retry.Code)
+		assert.Equal(t, first.Body.String(), retry.Body.String())
+		assert.Equal(t, mimeProblemJSON, retry.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, 1, appManager.created)
+	})
+	t.Run("server errors can be retried", func(t *testing.T) {
+		e, appManager := newIdempotentRouter(errors.New("disk full"))
+		assert.Equal(t, http.StatusInternalServerError, postWithKey(e, "booking-1", idempotentBody).Code)
+		assert.Equal(t, http.StatusInternalServerError, postWithKey(e, "booking-1", idempotentBody).Code)
+		assert.Equal(t, 2, appManager.created)
+	})
+	t.Run("legacy and versioned routes are the same request", func(t *testing.T) {
+		e, appManager := newIdempotentRouter(nil)
+		first := postWithKey(e, "booking-1", idempotentBody)
+		require.Equal(t, http.StatusCreated, first.Code)
+
+		req := httptest.NewRequest(http.MethodPost, "/schedule", strings.NewReader(idempotentBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(headerIdempotencyKey, "booking-1")
+		retry := httptest.NewRecorder()
+		e.ServeHTTP(retry, req)
+		assert.Equal(t, http.StatusCreated, retry.Code)
+		assert.Equal(t, "true", retry.Header().Get(headerIdempotentReplayed))
+		assert.Equal(t, 1, appManager.created)
+	})
+	t.Run("key reused with a different precondition", func(t *testing.T) {
+		e, _ := newIdempotentRouter(nil)
+		patch := func(ifMatch string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPatch, "/v1/schedule/1", strings.NewReader(`{"session_type": "standard"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set(headerIdempotencyKey, "change-1")
+			req.Header.Set(headerIfMatch, ifMatch)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec
+		}
+		first := patch(`"1"`)
+		require.Less(t, first.Code, http.StatusInternalServerError)
+		assert.Equal(t, first.Code, patch(`"1"`).Code)
+
+		rec := patch(`"2"`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Contains(t, rec.Body.String(), CodeIdempotencyKeyReused)
+	})
+	t.Run("key too long", func(t *testing.T) {
+		e, appManager := newIdempotentRouter(nil)
+		rec := postWithKey(e, strings.Repeat("k", maxIdempotencyKeyLength+1), idempotentBody)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, 0, appManager.created)
+	})
+}
+
+func TestIdempotencyStore(t *testing.T) {
+	now := time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)
+	store := newIdempotencyStore(time.Hour)
+	store.now = func() time.Time { return now }
+	fingerprint := sha256.Sum256([]byte("request"))
+
+	stored, err := store.begin("key", fingerprint)
+	require.NoError(t, err)
+	require.Nil(t, stored)
+
+	// a retry while the first request is still running
+	_, err = store.begin("key", fingerprint)
+	assertProblem(t, err, http.StatusConflict, CodeIdempotencyKeyInProgress)
+
+	store.finish("key", http.StatusCreated, http.Header{}, []byte("{}"))
+	stored, err = store.begin("key", fingerprint)
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, http.StatusCreated, stored.status)
+
+	// the key can be used for a new request once the window has passed
+	now = now.Add(time.Hour)
+	stored, err = store.begin("key", sha256.Sum256([]byte("another request")))
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+}
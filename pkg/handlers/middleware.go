@@ -1,31 +1,126 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/justinthompson/appointment/pkg/validator"
 	"github.com/labstack/echo/v4"
 )
 
-const keyAppointmentRequest = "appointment"
+const (
+	keyAppointmentRequest = "appointment"
+	keyScheduleQuery      = "schedule_query"
+	keyBatch              = "batch"
+	keyImport             = "import"
+	keyWebhook            = "webhook"
+	keyDelivery           = "delivery"
+	keyPreview            = "preview"
+	keyAPIKey             = "api_key"
+	keyManager            = "manager"
+	keyTenantID           = "tenant_id"
+
+	headerTenantID = "X-Tenant-ID"
+	queryTenant    = "tenant"
+	headerAPIKey   = "X-API-Key"
+
+	headerDeprecation = "Deprecation"
+	headerSunset      = "Sunset"
+	headerLink        = "Link"
+)
+
+// When the unversioned routes were deprecated and when they will be removed
+var (
+	legacyDeprecatedAt = time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC)
+	legacySunsetAt     = time.Date(2027, time.May, 1, 0, 0, 0, 0, time.UTC)
+)
 
 // I could just have one appointment struct that they all share but I wanted to test out the different ways of binding and using middleware
 type GetAppointmentRequest struct {
-	StartTime time.Time `query:"starts_at" validate:"required"`
-	EndTime   time.Time `query:"ends_at" validate:"required"`
-	TrainerID int       `query:"trainer_id" validate:"required"`
+	StartTime  time.Time `query:"starts_at" validate:"required,halfhour,business_hours"`
+	EndTime    time.Time `query:"ends_at" validate:"required,halfhour,business_hours=end,gtfield=StartTime"`
+	TrainerID  int       `query:"trainer_id" validate:"required_without=LocationID"`
+	LocationID int       `query:"location_id"`
 }
 
+// GetScheduledRequest filters the schedule by trainer, location or user and pages through it with the cursor from the Link header
 type GetScheduledRequest struct {
-	TrainerID int `query:"trainer_id" validate:"required"`
+	TrainerID  int       `query:"trainer_id" validate:"required_without_all=LocationID UserID"`
+	LocationID int       `query:"location_id"`
+	UserID     int       `query:"user_id"`
+	From       time.Time `query:"from"`
+	To         time.Time `query:"to" validate:"omitempty,gtfield=From"`
+	// Status can be repeated or comma separated
+	Status []string `query:"status"`
+	Sort   string   `query:"sort" validate:"omitempty,oneof=starts_at -starts_at"`
+	Limit  int      `query:"limit" validate:"omitempty,min=1,max=200"`
+	Cursor string   `query:"cursor"`
 }
 
 type PostAppointmentRequest struct {
-	StartTime time.Time `json:"starts_at" validate:"required"`
-	EndTime   time.Time `json:"ends_at" validate:"required"`
+	StartTime time.Time `json:"starts_at" validate:"required,halfhour,business_hours"`
+	EndTime   time.Time `json:"ends_at" validate:"required,halfhour,business_hours=end,gtfield=StartTime,duration=StartTime:30m"`
 	TrainerID int       `json:"trainer_id" validate:"required"`
 	UserID    int       `json:"user_id" validate:"required"`
+	// Tentative holds the slot without confirming it
+	Tentative   bool   `json:"tentative"`
+	SessionType string `json:"session_type"`
+}
+
+// PostBatchRequest books many appointments at once, atomic books all of them or none.
+// Each appointment is validated on its own so one bad appointment only fails the whole batch when it is atomic.
+type PostBatchRequest struct {
+	Atomic       bool                     `json:"atomic"`
+	Appointments []PostAppointmentRequest `json:"appointments" validate:"required,min=1,max=100"`
+}
+
+// Batch is a bulk booking request with the appointments that passed validation and the problems of the ones that didn't
+type Batch struct {
+	Atomic       bool
+	Appointments []appointment.Appointment
+	// Indexes is where each appointment was in the request
+	Indexes []int
+	// Invalid has the validation problem of each appointment that failed by where it was in the request
+	Invalid map[int]Problem
+	Size    int
+}
+
+// PatchAppointmentRequest reschedules an appointment or changes its session type, fields that aren't sent are left as they are
+type PatchAppointmentRequest struct {
+	ID          int        `param:"id" validate:"required"`
+	StartTime   *time.Time `json:"starts_at" validate:"omitempty,halfhour"`
+	EndTime     *time.Time `json:"ends_at" validate:"omitempty,halfhour"`
+	SessionType string     `json:"session_type"`
+}
+
+type AppointmentIDRequest struct {
+	ID int `param:"id" validate:"required"`
+}
+
+type UserIDRequest struct {
+	ID int `param:"id" validate:"required"`
+}
+
+type TrainerIDRequest struct {
+	ID int `param:"id" validate:"required"`
+}
+
+// FreeBusyRequest asks when a trainer is busy between from and to
+type FreeBusyRequest struct {
+	ID   int       `param:"id" validate:"required"`
+	From time.Time `query:"from" validate:"required"`
+	To   time.Time `query:"to" validate:"required,gtfield=From"`
+}
+
+// CalendarRequest is a request for a trainer's or user's calendar from a calendar app, the token is from the calendar's link
+type CalendarRequest struct {
+	ID    int    `param:"id" validate:"required"`
+	Token string `query:"token" validate:"required"`
+	// Tenant is in the link because calendar apps can't send the tenant header, the token is only valid for it
+	Tenant string `query:"tenant"`
 }
 
 // MiddlewareAvailable is a middleware that takes the request and converts it to an appointment
@@ -37,22 +132,20 @@ func MiddlewareAvailable(next echo.HandlerFunc) echo.HandlerFunc {
 		}
 
 		SetAppointment(c, app)
-		next(c)
-		return nil
+		return next(c)
 	}
 }
 
-// MiddlewareScheduled is a middleware that takes the request and converts it to an appointment
+// MiddlewareScheduled is a middleware that takes the request and converts it to a schedule query
 func MiddlewareScheduled(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		app, err := requestToAppointment(c, &GetScheduledRequest{})
+		query, err := requestToScheduleQuery(c)
 		if err != nil {
 			return err
 		}
 
-		SetAppointment(c, app)
-		next(c)
-		return nil
+		SetScheduleQuery(c, query)
+		return next(c)
 	}
 }
 
@@ -65,9 +158,172 @@ func MiddlewarePost(next echo.HandlerFunc) echo.HandlerFunc {
 		}
 
 		SetAppointment(c, app)
-		next(c)
-		return nil
+		return next(c)
+	}
+}
+
+// MiddlewarePatch is a middleware that takes the changes to the appointment in the path and converts them to an appointment
+func MiddlewarePatch(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		app, err := requestToAppointment(c, &PatchAppointmentRequest{})
+		if err != nil {
+			return err
+		}
+
+		SetAppointment(c, app)
+		return next(c)
+	}
+}
+
+// MiddlewareBatch is a middleware that takes a bulk booking request and validates each appointment in it
+func MiddlewareBatch(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		batch, err := requestToBatch(c)
+		if err != nil {
+			return err
+		}
+
+		SetBatch(c, batch)
+		return next(c)
+	}
+}
+
+// MiddlewareAppointmentID is a middleware that takes the appointment ID from the path and converts it to an appointment
+func MiddlewareAppointmentID(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		app, err := requestToAppointment(c, &AppointmentIDRequest{})
+		if err != nil {
+			return err
+		}
+
+		SetAppointment(c, app)
+		return next(c)
+	}
+}
+
+// MiddlewareUserID is a middleware that takes the user ID from the path and converts it to an appointment
+func MiddlewareUserID(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		app, err := requestToAppointment(c, &UserIDRequest{})
+		if err != nil {
+			return err
+		}
+
+		SetAppointment(c, app)
+		return next(c)
+	}
+}
+
+// MiddlewareTrainerID is a middleware that takes the trainer ID from the path and converts it to an appointment
+func MiddlewareTrainerID(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		app, err := requestToAppointment(c, &TrainerIDRequest{})
+		if err != nil {
+			return err
+		}
+
+		SetAppointment(c, app)
+		return next(c)
+	}
+}
+
+// MiddlewareFreeBusy is a middleware that takes the trainer ID from the path and the range from the query and converts them to an appointment
+func MiddlewareFreeBusy(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		app, err := requestToAppointment(c, &FreeBusyRequest{})
+		if err != nil {
+			return err
+		}
+
+		SetAppointment(c, app)
+		return next(c)
+	}
+}
+
+// MiddlewareDeprecated marks a response from an unversioned route as deprecated and links to the same route in the version.
+// The headers are set before the route runs so they are on error responses too.
+func MiddlewareDeprecated(version string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Response().Header()
+			header.Set(headerDeprecation, fmt.Sprintf("@%d", legacyDeprecatedAt.Unix()))
+			header.Set(headerSunset, legacySunsetAt.Format(http.TimeFormat))
+			header.Add(headerLink, fmt.Sprintf(`</%s%s>; rel="successor-version"`, version, c.Request().URL.Path))
+			return next(c)
+		}
+	}
+}
+
+// MiddlewareTenant works out which tenant the request is for and puts that tenant's manager on the context.
+// An API key takes priority, then the request host, then the tenant header.
+func MiddlewareTenant(tenants *appointment.Tenants) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			tenantID, err := requestTenant(c, tenants)
+			if err != nil {
+				return err
+			}
+
+			appManager, err := tenants.Manager(tenantID)
+			if err != nil {
+				return managerProblem(err, "error finding tenant")
+			}
+
+			SetTenantID(c, tenantID)
+			SetManager(c, appManager)
+			return next(c)
+		}
+	}
+}
+
+// requestTenant returns the ID of the tenant the request belongs to, a request with an api key belongs to the key's tenant
+func requestTenant(c echo.Context, tenants *appointment.Tenants) (string, error) {
+	if key := c.Request().Header.Get(headerAPIKey); key != "" {
+		tenantID, apiKey, ok := tenants.Authenticate(key)
+		if !ok {
+			return "", newProblem(http.StatusUnauthorized, CodeInvalidAPIKey, "invalid api key")
+		}
+		SetAPIKey(c, apiKey)
+		return tenantID, nil
 	}
+
+	if tenantID, ok := tenants.TenantForHost(c.Request().Host); ok {
+		return tenantID, nil
+	}
+
+	if tenantID := c.Request().Header.Get(headerTenantID); tenantID != "" {
+		return tenantID, nil
+	}
+
+	// Public routes are opened by calendar apps that can't send headers, their links name the tenant and are signed for it
+	if publicRoutes[versionRoute(c.Request().Method, c.Path())] {
+		if tenantID := c.QueryParam(queryTenant); tenantID != "" {
+			return tenantID, nil
+		}
+	}
+
+	if tenantID, ok := tenants.DefaultTenant(); ok {
+		return tenantID, nil
+	}
+	return "", newProblem(http.StatusBadRequest, CodeTenantRequired, "tenant could not be determined from the request")
+}
+
+func SetTenantID(c echo.Context, tenantID string) {
+	c.Set(keyTenantID, tenantID)
+}
+
+// GetTenantID returns the tenant the request belongs to, it is empty on routes that aren't scoped to a tenant
+func GetTenantID(c echo.Context) string {
+	tenantID, _ := c.Get(keyTenantID).(string)
+	return tenantID
+}
+
+func SetManager(c echo.Context, appManager appointment.Manager) {
+	c.Set(keyManager, appManager)
+}
+
+func GetManager(c echo.Context) appointment.Manager {
+	return c.Get(keyManager).(appointment.Manager)
 }
 
 func SetAppointment(c echo.Context, app appointment.Appointment) {
@@ -78,40 +334,192 @@ func GetAppointment(c echo.Context) appointment.Appointment {
 	return c.Get(keyAppointmentRequest).(appointment.Appointment)
 }
 
+func SetScheduleQuery(c echo.Context, query appointment.ScheduleQuery) {
+	c.Set(keyScheduleQuery, query)
+}
+
+func GetScheduleQuery(c echo.Context) appointment.ScheduleQuery {
+	return c.Get(keyScheduleQuery).(appointment.ScheduleQuery)
+}
+
+func SetBatch(c echo.Context, batch Batch) {
+	c.Set(keyBatch, batch)
+}
+
+func GetBatch(c echo.Context) Batch {
+	return c.Get(keyBatch).(Batch)
+}
+
 // requestToAppointment takes any of the request types and converts it to appointment
 // It does this by binding the request to the request struct, validating it,
 // and then switching on the type of the request to construct the appointment
 func requestToAppointment(c echo.Context, req interface{}) (appointment.Appointment, error) {
-	// Bind the request to the request struct
-	if err := c.Bind(req); err != nil {
-		return appointment.Appointment{}, echo.NewHTTPError(http.StatusBadRequest, err)
-	}
-
-	// Validate the request
-	if err := c.Validate(req); err != nil {
-		return appointment.Appointment{}, echo.NewHTTPError(http.StatusBadRequest, err)
+	if err := bindRequest(c, req); err != nil {
+		return appointment.Appointment{}, err
 	}
 
 	// Switch on the type of the request to construct the appointment
 	switch v := req.(type) {
 	case *GetAppointmentRequest:
 		return appointment.Appointment{
-			StartTime: v.StartTime,
-			EndTime:   v.EndTime,
-			TrainerID: v.TrainerID,
+			StartTime:  v.StartTime,
+			EndTime:    v.EndTime,
+			TrainerID:  v.TrainerID,
+			LocationID: v.LocationID,
 		}, nil
 	case *PostAppointmentRequest:
+		return postRequestToAppointment(v), nil
+	case *GetScheduledRequest:
 		return appointment.Appointment{
-			StartTime: v.StartTime,
-			EndTime:   v.EndTime,
-			TrainerID: v.TrainerID,
-			UserID:    v.UserID,
+			TrainerID:  v.TrainerID,
+			LocationID: v.LocationID,
+			UserID:     v.UserID,
 		}, nil
-	case *GetScheduledRequest:
+	case *PatchAppointmentRequest:
+		// Times that aren't sent stay zero so the manager leaves them as they are
+		app := appointment.Appointment{
+			ID:          v.ID,
+			SessionType: v.SessionType,
+		}
+		if v.StartTime != nil {
+			app.StartTime = *v.StartTime
+		}
+		if v.EndTime != nil {
+			app.EndTime = *v.EndTime
+		}
+		return app, nil
+	case *AppointmentIDRequest:
 		return appointment.Appointment{
-			TrainerID: v.TrainerID,
+			ID: v.ID,
+		}, nil
+	case *UserIDRequest:
+		return appointment.Appointment{
+			UserID: v.ID,
+		}, nil
+	case *TrainerIDRequest:
+		return appointment.Appointment{
+			TrainerID: v.ID,
+		}, nil
+	case *FreeBusyRequest:
+		return appointment.Appointment{
+			TrainerID: v.ID,
+			StartTime: v.From,
+			EndTime:   v.To,
 		}, nil
 	default:
-		return appointment.Appointment{}, echo.NewHTTPError(http.StatusBadRequest, "unknown request type")
+		return appointment.Appointment{}, newProblem(http.StatusInternalServerError, CodeInternal, "unknown request type")
+	}
+}
+
+// postRequestToAppointment converts a booking to an appointment
+func postRequestToAppointment(req *PostAppointmentRequest) appointment.Appointment {
+	app := appointment.Appointment{
+		StartTime:   req.StartTime,
+		EndTime:     req.EndTime,
+		TrainerID:   req.TrainerID,
+		UserID:      req.UserID,
+		SessionType: req.SessionType,
+	}
+	if req.Tentative {
+		app.Status = appointment.StatusTentative
+	}
+	return app
+}
+
+// requestToBatch binds a PostBatchRequest and validates each appointment in it like a single booking
+func requestToBatch(c echo.Context) (Batch, error) {
+	var req PostBatchRequest
+	if err := bindRequest(c, &req); err != nil {
+		return Batch{}, err
+	}
+
+	batch := Batch{Atomic: req.Atomic, Invalid: map[int]Problem{}, Size: len(req.Appointments)}
+	for i := range req.Appointments {
+		if err := validateRequest(c, &req.Appointments[i]); err != nil {
+			batch.Invalid[i] = validationProblemFor(c, err)
+			continue
+		}
+		batch.Appointments = append(batch.Appointments, postRequestToAppointment(&req.Appointments[i]))
+		batch.Indexes = append(batch.Indexes, i)
+	}
+	return batch, nil
+}
+
+// requestToScheduleQuery binds a GetScheduledRequest and converts it to the query for the manager
+func requestToScheduleQuery(c echo.Context) (appointment.ScheduleQuery, error) {
+	var req GetScheduledRequest
+	if err := bindRequest(c, &req); err != nil {
+		return appointment.ScheduleQuery{}, err
+	}
+
+	query := appointment.ScheduleQuery{
+		TrainerID:  req.TrainerID,
+		LocationID: req.LocationID,
+		UserID:     req.UserID,
+		From:       req.From,
+		To:         req.To,
+		Descending: req.Sort == "-starts_at",
+		Limit:      req.Limit,
+		Cursor:     req.Cursor,
+	}
+	query.Statuses = splitStatuses(req.Status)
+	return query, nil
+}
+
+// splitStatuses reads a status filter that can be repeated or comma separated
+func splitStatuses(values []string) []appointment.Status {
+	var statuses []appointment.Status
+	for _, value := range values {
+		for _, status := range strings.Split(value, ",") {
+			statuses = append(statuses, appointment.Status(strings.TrimSpace(status)))
+		}
+	}
+	return statuses
+}
+
+// bindRequest binds the request to the request struct and validates it
+func bindRequest(c echo.Context, req interface{}) error {
+	if err := c.Bind(req); err != nil {
+		return newProblem(http.StatusBadRequest, CodeBadRequest, bindErrorDetail(err))
+	}
+
+	// Validate the request, the business hours come from the tenant's manager when there is one
+	if err := validateRequest(c, req); err != nil {
+		return validationProblem(c, err)
+	}
+	return nil
+}
+
+// validateRequest validates the request with the tenant's business hours if the validator supports rules that need them
+func validateRequest(c echo.Context, req interface{}) error {
+	v, ok := c.Echo().Validator.(*validator.Validator)
+	if !ok {
+		return c.Validate(req)
+	}
+
+	ctx := c.Request().Context()
+	if appManager, ok := c.Get(keyManager).(appointment.Manager); ok {
+		ctx = validator.WithBusinessHours(ctx, businessHours(appManager))
+	}
+	return v.ValidateCtx(ctx, req)
+}
+
+// businessHours returns the opening hours of the location a request is booked at.
+// Unknown trainers and locations pass validation so the manager can report them with the right error.
+func businessHours(appManager appointment.Manager) validator.BusinessHours {
+	return func(trainerID int, locationID int) (int, int, *time.Location, bool) {
+		location, err := appManager.GetBookingLocation(trainerID, locationID)
+		if err != nil {
+			return 0, 0, nil, false
+		}
+		return location.OpeningHours.Open, location.OpeningHours.Close, location.Zone(), true
+	}
+}
+
+// bindErrorDetail returns the message of a bind error without echo's code prefix
+func bindErrorDetail(err error) string {
+	if he, ok := err.(*echo.HTTPError); ok {
+		return fmt.Sprint(he.Message)
 	}
+	return err.Error()
 }
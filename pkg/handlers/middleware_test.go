@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/justinthompson/appointment/pkg/appointment"
 	"github.com/justinthompson/appointment/pkg/validator"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
@@ -34,8 +37,8 @@ func TestRequestToAppointment(t *testing.T) {
 	t.Run("successful conversion of GetAppointmentRequest", func(t *testing.T) {
 		c, _ := newContext()
 		req := &GetAppointmentRequest{
-			StartTime: time.Now(),
-			EndTime:   time.Now().Add(1 * time.Hour),
+			StartTime: time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC),
+			EndTime:   time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC),
 			TrainerID: 1,
 		}
 		app, err := requestToAppointment(c, req)
@@ -47,8 +50,8 @@ func TestRequestToAppointment(t *testing.T) {
 	t.Run("successful conversion of PostAppointmentRequest", func(t *testing.T) {
 		c, _ := newContext()
 		req := &PostAppointmentRequest{
-			StartTime: time.Now(),
-			EndTime:   time.Now().Add(1 * time.Hour),
+			StartTime: time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC),
+			EndTime:   time.Date(2022, 1, 1, 9, 30, 0, 0, time.UTC),
 			TrainerID: 1,
 			UserID:    1,
 		}
@@ -70,6 +73,44 @@ func TestRequestToAppointment(t *testing.T) {
 	})
 }
 
+func TestRequestToAppointment_BookingRules(t *testing.T) {
+	start := time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		req   *PostAppointmentRequest
+		field string
+		rule  string
+	}{
+		{"not on the half hour", &PostAppointmentRequest{StartTime: start.Add(15 * time.Minute), EndTime: start.Add(45 * time.Minute)}, "starts_at", "halfhour"},
+		{"end before start", &PostAppointmentRequest{StartTime: start, EndTime: start.Add(-30 * time.Minute)}, "ends_at", "gtfield"},
+		{"outside business hours", &PostAppointmentRequest{StartTime: start.Add(-3 * time.Hour), EndTime: start.Add(-150 * time.Minute)}, "starts_at", "business_hours"},
+		{"wrong duration", &PostAppointmentRequest{StartTime: start, EndTime: start.Add(time.Hour)}, "ends_at", "duration"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newContext()
+			tt.req.TrainerID, tt.req.UserID = 1, 1
+			_, err := requestToAppointment(c, tt.req)
+			assertProblem(t, err, http.StatusUnprocessableEntity, CodeValidationFailed)
+
+			problem := err.(*echo.HTTPError).Message.(Problem)
+			require.NotEmpty(t, problem.Errors)
+			assert.Equal(t, tt.field, problem.Errors[0].JSONName)
+			assert.Equal(t, tt.rule, problem.Errors[0].Rule)
+		})
+	}
+
+	t.Run("uses the tenant's business hours", func(t *testing.T) {
+		c, _ := newContext()
+		SetManager(c, &appointment.MockAppointmentManager{LocationsList: []appointment.Location{
+			{ID: 2, OpeningHours: appointment.OpeningHours{Open: 6, Close: 20}},
+		}})
+		req := &GetAppointmentRequest{StartTime: start.Add(-3 * time.Hour), EndTime: start.Add(-2 * time.Hour), LocationID: 2}
+		_, err := requestToAppointment(c, req)
+		assert.NoError(t, err)
+	})
+}
+
 func newContext() (echo.Context, *httptest.ResponseRecorder) {
 	req := httptest.NewRequest("GET", "/", nil)
 	rec := httptest.NewRecorder()
@@ -78,3 +119,109 @@ func newContext() (echo.Context, *httptest.ResponseRecorder) {
 	c.Echo().Validator = validator.NewValidator()
 	return c, rec
 }
+
+func TestMiddlewareTenant(t *testing.T) {
+	tenants := appointment.NewSingleTenant(appointment.NewMockAppointmentManager(nil, nil))
+	handler := MiddlewareTenant(tenants)(func(c echo.Context) error {
+		assert.NotNil(t, GetManager(c))
+		return nil
+	})
+
+	t.Run("defaults to the only tenant", func(t *testing.T) {
+		c, _ := newContext()
+		require.NoError(t, handler(c))
+	})
+	t.Run("unknown tenant header", func(t *testing.T) {
+		c, _ := newContext()
+		c.Request().Header.Set(headerTenantID, "initech")
+		assertHTTPError(t, handler(c), http.StatusNotFound)
+	})
+	t.Run("unknown api key", func(t *testing.T) {
+		c, _ := newContext()
+		c.Request().Header.Set(headerAPIKey, "not-a-key")
+		assertHTTPError(t, handler(c), http.StatusUnauthorized)
+	})
+}
+
+func TestRequestToScheduleQuery(t *testing.T) {
+	t.Run("filters", func(t *testing.T) {
+		c, _ := newContext()
+		c.Request().URL.RawQuery = "user_id=3&from=2022-01-01T00:00:00Z&to=2022-02-01T00:00:00Z&status=confirmed,pending&status=no_show&sort=-starts_at&limit=10&cursor=abc"
+		query, err := requestToScheduleQuery(c)
+		require.NoError(t, err)
+		assert.Equal(t, appointment.ScheduleQuery{
+			UserID:     3,
+			From:       time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+			To:         time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC),
+			Statuses:   []appointment.Status{appointment.StatusConfirmed, appointment.StatusPending, appointment.StatusNoShow},
+			Descending: true,
+			Limit:      10,
+			Cursor:     "abc",
+		}, query)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		for _, rawQuery := range []string{
+			"",
+			"trainer_id=1&limit=500",
+			"trainer_id=1&sort=user_id",
+			"trainer_id=1&from=2022-02-01T00:00:00Z&to=2022-01-01T00:00:00Z",
+		} {
+			c, _ := newContext()
+			c.Request().URL.RawQuery = rawQuery
+			_, err := requestToScheduleQuery(c)
+			assertProblem(t, err, http.StatusUnprocessableEntity, CodeValidationFailed)
+		}
+	})
+}
+
+func TestMiddlewareDeprecated(t *testing.T) {
+	c, rec := newContext()
+	c.Request().URL.Path = "/schedule/4/cancel"
+	err := MiddlewareDeprecated("v1")(func(c echo.Context) error {
+		return newProblem(http.StatusNotFound, CodeAppointmentNotFound, "appointment 4 does not exist")
+	})(c)
+	assertHTTPError(t, err, http.StatusNotFound)
+
+	assert.Equal(t, "@1793491200", rec.Header().Get(headerDeprecation))
+	assert.Equal(t, "Sat, 01 May 2027 00:00:00 GMT", rec.Header().Get(headerSunset))
+	assert.Equal(t, `</v1/schedule/4/cancel>; rel="successor-version"`, rec.Header().Get(headerLink))
+}
+
+func TestRequestToAppointment_ValidationProblem(t *testing.T) {
+	c, _ := newContext()
+	c.Request().Header.Set("Accept-Language", "es")
+	_, err := requestToAppointment(c, &GetScheduledRequest{})
+	assertProblem(t, err, http.StatusUnprocessableEntity, CodeValidationFailed)
+
+	problem := err.(*echo.HTTPError).Message.(Problem)
+	require.Len(t, problem.Errors, 1)
+	assert.Equal(t, "trainer_id", problem.Errors[0].JSONName)
+	assert.Equal(t, "required_without_all", problem.Errors[0].Rule)
+	assert.Equal(t, "trainer_id es un campo requerido", problem.Errors[0].Message)
+}
+
+func TestRequestToAppointment_Patch(t *testing.T) {
+	patch := func(body string) (appointment.Appointment, error) {
+		c, _ := newContext()
+		c.SetRequest(httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(body)))
+		c.Request().Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c.SetParamNames("id")
+		c.SetParamValues("3")
+		return requestToAppointment(c, &PatchAppointmentRequest{})
+	}
+
+	app, err := patch(`{"starts_at": "2030-01-01T10:00:00Z", "ends_at": "2030-01-01T10:30:00Z"}`)
+	require.NoError(t, err)
+	assert.Equal(t, 3, app.ID)
+	assert.Equal(t, time.Date(2030, 1, 1, 10, 0, 0, 0, time.UTC), app.StartTime.UTC())
+	assert.Empty(t, app.SessionType)
+
+	// Fields that aren't sent stay zero
+	app, err = patch(`{"session_type": "standard"}`)
+	require.NoError(t, err)
+	assert.True(t, app.StartTime.IsZero())
+	assert.Equal(t, "standard", app.SessionType)
+
+	_, err = patch(`{"starts_at": "2030-01-01T10:15:00Z"}`)
+	assertProblem(t, err, http.StatusUnprocessableEntity, CodeValidationFailed)
+}
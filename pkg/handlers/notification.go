@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/justinthompson/appointment/pkg/notification"
+)
+
+// PreviewNotificationRequest renders a notification type in a locale.
+// The sample appointment is in the trainer's location, or in UTC without a trainer.
+type PreviewNotificationRequest struct {
+	Type      string `param:"type" validate:"required,oneof=booking_confirmation reminder"`
+	Locale    string `query:"locale"`
+	TrainerID int    `query:"trainer_id"`
+}
+
+// MiddlewarePreviewNotification is a middleware that binds and validates a notification preview
+func MiddlewarePreviewNotification(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req PreviewNotificationRequest
+		if err := bindRequest(c, &req); err != nil {
+			return err
+		}
+
+		c.Set(keyPreview, req)
+		return next(c)
+	}
+}
+
+func GetPreview(c echo.Context) PreviewNotificationRequest {
+	return c.Get(keyPreview).(PreviewNotificationRequest)
+}
+
+// handleGetNotificationPreview renders the tenant's templates for a notification against a sample appointment
+// so gyms can check their wording before it is sent to clients
+func handleGetNotificationPreview(c echo.Context, appManager appointment.Manager) error {
+	req := GetPreview(c)
+	var location appointment.Location
+	if req.TrainerID != 0 {
+		var err error
+		if location, err = appManager.GetBookingLocation(req.TrainerID, 0); err != nil {
+			return managerProblem(err, "error getting location")
+		}
+	}
+	templates, err := appManager.GetMessageTemplates()
+	if err != nil {
+		return managerProblem(err, "error getting templates")
+	}
+
+	typ := notification.Type(req.Type)
+	msg, err := notification.Render(templates, typ, notification.Sample(typ, req.Locale, location, time.Now().UTC()))
+	if err != nil {
+		return newProblem(http.StatusUnprocessableEntity, CodeInvalidTemplate, err.Error())
+	}
+	return c.JSON(http.StatusOK, msg)
+}
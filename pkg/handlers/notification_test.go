@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/justinthompson/appointment/pkg/notification"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationPreview(t *testing.T) {
+	appManager := appointment.NewMockAppointmentManager(nil, nil)
+	appManager.MessageTemplates = appointment.MessageTemplates{
+		"es": {"booking_confirmation": {Subject: "¡Reservado, {{.User.Name}}!"}},
+		"de": {"reminder": {Text: "{{.Missing}}"}},
+	}
+	e := echo.New()
+	BuildRouter(e, appointment.NewSingleTenant(appManager), Config{AllowAnonymous: true})
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	rec := serve("/v1/notifications/reminder/preview")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var msg notification.Message
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &msg))
+	assert.Equal(t, "en", msg.Locale)
+	assert.Contains(t, msg.Subject, "Reminder: your session on ")
+	assert.Contains(t, msg.Text, "Hi Alex,")
+	assert.Contains(t, msg.HTML, "<p>Hi Alex,</p>")
+
+	// The gym's subject with the built in spanish for the rest
+	rec = serve("/v1/notifications/booking_confirmation/preview?locale=es-MX&trainer_id=1")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &msg))
+	assert.Equal(t, "es", msg.Locale)
+	assert.Equal(t, "¡Reservado, Alex!", msg.Subject)
+	assert.Contains(t, msg.Text, "está confirmada")
+
+	rec = serve("/v1/notifications/welcome/preview")
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), CodeValidationFailed)
+
+	rec = serve("/v1/notifications/reminder/preview?locale=de")
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), CodeInvalidTemplate)
+}
@@ -0,0 +1,451 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/justinthompson/appointment/pkg/ical"
+	"github.com/justinthompson/appointment/pkg/notification"
+	"github.com/justinthompson/appointment/pkg/validator"
+)
+
+type (
+	// routeDoc is what the spec says about a route that can't be worked out from the router
+	routeDoc struct {
+		summary string
+		// request is the request struct the route binds, its query, param and json tags become the parameters and body
+		request interface{}
+		// response is written with status when the request succeeds, a negotiated response depends on the Accept header
+		response interface{}
+		status   int
+	}
+
+	// file is a response that isn't json
+	file struct {
+		mimeType string
+	}
+
+	// upload is a request whose body is a file, the parameters come from the params request struct
+	upload struct {
+		mimeType string
+		params   interface{}
+	}
+
+	// withFile is a json response that can also be asked for as a file with the Accept header
+	withFile struct {
+		response interface{}
+		file     file
+	}
+
+	// negotiated is a response that has a legacy and a current version, see responseVersion
+	negotiated struct {
+		legacy  interface{}
+		current interface{}
+	}
+
+	openAPI struct {
+		OpenAPI    string                          `json:"openapi"`
+		Info       openAPIInfo                     `json:"info"`
+		Paths      map[string]map[string]operation `json:"paths"`
+		Components components                      `json:"components"`
+		Security   []map[string][]string           `json:"security"`
+	}
+
+	openAPIInfo struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	}
+
+	operation struct {
+		Summary     string              `json:"summary"`
+		OperationID string              `json:"operationId"`
+		Deprecated  bool                `json:"deprecated,omitempty"`
+		Parameters  []parameter         `json:"parameters,omitempty"`
+		RequestBody *requestBody        `json:"requestBody,omitempty"`
+		Responses   map[string]response `json:"responses"`
+	}
+
+	parameter struct {
+		Name        string  `json:"name"`
+		In          string  `json:"in"`
+		Description string  `json:"description,omitempty"`
+		Required    bool    `json:"required"`
+		Schema      *schema `json:"schema"`
+	}
+
+	requestBody struct {
+		Required bool                 `json:"required"`
+		Content  map[string]mediaType `json:"content"`
+	}
+
+	response struct {
+		Description string               `json:"description"`
+		Content     map[string]mediaType `json:"content,omitempty"`
+	}
+
+	mediaType struct {
+		Schema *schema `json:"schema"`
+	}
+
+	schema struct {
+		Ref                  string             `json:"$ref,omitempty"`
+		Type                 string             `json:"type,omitempty"`
+		Format               string             `json:"format,omitempty"`
+		Description          string             `json:"description,omitempty"`
+		Items                *schema            `json:"items,omitempty"`
+		Properties           map[string]*schema `json:"properties,omitempty"`
+		AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+		Required             []string           `json:"required,omitempty"`
+	}
+
+	components struct {
+		Schemas         map[string]*schema        `json:"schemas"`
+		SecuritySchemes map[string]securityScheme `json:"securitySchemes"`
+	}
+
+	securityScheme struct {
+		Type string `json:"type"`
+		In   string `json:"in"`
+		Name string `json:"name"`
+	}
+)
+
+const pathOpenAPI = "/openapi.json"
+
+// The appointment routes return the version of an appointment the client accepts
+var (
+	appointmentOne  = negotiated{LegacyAppointmentResponse{}, AppointmentResponse{}}
+	appointmentList = negotiated{[]LegacyAppointmentResponse{}, []AppointmentResponse{}}
+)
+
+// v1RouteDocs documents every route in v1Routes by method and path, the spec fails to build if a route is missing or extra
+var v1RouteDocs = map[string]routeDoc{
+	"GET /schedule/available":               {"List the available appointment times", GetAppointmentRequest{}, appointmentList, http.StatusOK},
+	"GET /schedule":                         {"List the scheduled appointments", GetScheduledRequest{}, appointmentList, http.StatusOK},
+	"POST /schedule":                        {"Book an appointment", PostAppointmentRequest{}, appointmentOne, http.StatusCreated},
+	"POST /schedule/batch":                  {"Book many appointments at once", PostBatchRequest{}, BatchResponse{}, http.StatusOK},
+	"GET /schedule/stream":                  {"Follow changes to the schedule as server-sent events", StreamScheduleRequest{}, file{mimeEventStream}, http.StatusOK},
+	"GET /schedule/export":                  {"Export appointments as a csv file", ExportScheduleRequest{}, file{mimeCSV}, http.StatusOK},
+	"POST /schedule/import":                 {"Book the appointments in a csv file and get a csv file of what happened to each row", upload{mimeCSV, ImportScheduleRequest{}}, file{mimeCSV}, http.StatusOK},
+	"GET /schedule/:id":                     {"Get an appointment", AppointmentIDRequest{}, appointmentOne, http.StatusOK},
+	"PATCH /schedule/:id":                   {"Reschedule an appointment or change its session type", PatchAppointmentRequest{}, appointmentOne, http.StatusOK},
+	"DELETE /schedule/:id":                  {"Delete an appointment booked in error", AppointmentIDRequest{}, nil, http.StatusNoContent},
+	"POST /schedule/:id/confirm":            {"Confirm a tentative appointment", AppointmentIDRequest{}, appointmentOne, http.StatusOK},
+	"POST /schedule/:id/check-in":           {"Check in to an appointment", AppointmentIDRequest{}, appointmentOne, http.StatusOK},
+	"POST /schedule/:id/complete":           {"Complete an appointment", AppointmentIDRequest{}, appointmentOne, http.StatusOK},
+	"POST /schedule/:id/no-show":            {"Mark an appointment as a no-show", AppointmentIDRequest{}, appointmentOne, http.StatusOK},
+	"POST /schedule/:id/cancel":             {"Cancel an appointment", AppointmentIDRequest{}, appointmentOne, http.StatusOK},
+	"POST /schedule/:id/accept":             {"Accept a booking request", AppointmentIDRequest{}, appointmentOne, http.StatusOK},
+	"POST /schedule/:id/decline":            {"Decline a booking request", AppointmentIDRequest{}, appointmentOne, http.StatusOK},
+	"GET /locations":                        {"List the locations", nil, []appointment.Location{}, http.StatusOK},
+	"GET /users/:id/attendance":             {"Get a user's attendance record", UserIDRequest{}, appointment.AttendanceRecord{}, http.StatusOK},
+	"GET /trainers/:id/calendar":            {"Get the URL of a trainer's calendar", TrainerIDRequest{}, CalendarLinkResponse{}, http.StatusOK},
+	"GET /trainers/:id/calendar.ics":        {"Get a trainer's appointments as an iCalendar file", CalendarRequest{}, file{ical.MIMEType}, http.StatusOK},
+	"POST /trainers/:id/busy":               {"Import a trainer's busy time from an iCalendar file", upload{ical.MIMEType, TrainerIDRequest{}}, BusyImportResponse{}, http.StatusOK},
+	"GET /trainers/:id/busy":                {"List a trainer's busy time", TrainerIDRequest{}, []appointment.BusyBlock{}, http.StatusOK},
+	"GET /trainers/:id/freebusy":            {"Get when a trainer is busy without the details of their appointments", FreeBusyRequest{}, withFile{FreeBusyResponse{}, file{ical.MIMEType}}, http.StatusOK},
+	"GET /users/:id/calendar":               {"Get the URL of a user's calendar", UserIDRequest{}, CalendarLinkResponse{}, http.StatusOK},
+	"GET /users/:id/calendar.ics":           {"Get a user's appointments as an iCalendar file", CalendarRequest{}, file{ical.MIMEType}, http.StatusOK},
+	"POST /webhooks":                        {"Add a webhook for appointment events", PostWebhookRequest{}, WebhookResponse{}, http.StatusCreated},
+	"GET /webhooks":                         {"List the webhooks", nil, []WebhookResponse{}, http.StatusOK},
+	"DELETE /webhooks/:id":                  {"Delete a webhook", WebhookIDRequest{}, nil, http.StatusNoContent},
+	"GET /webhooks/dead-letters":            {"List the webhook deliveries that were given up on", nil, []appointment.Delivery{}, http.StatusOK},
+	"POST /webhooks/dead-letters/:id/retry": {"Send a webhook delivery that was given up on again", DeliveryIDRequest{}, nil, http.StatusAccepted},
+	"GET /notifications/:type/preview":      {"Preview a notification's wording with a sample appointment", PreviewNotificationRequest{}, notification.Message{}, http.StatusOK},
+}
+
+var openAPIRouteDoc = routeDoc{"Get this OpenAPI document", nil, map[string]interface{}{}, http.StatusOK}
+
+// handleGetOpenAPI writes the OpenAPI document for the routes the server has
+func handleGetOpenAPI(c echo.Context) error {
+	spec, err := openAPISpec(c.Echo().Routes())
+	if err != nil {
+		return newProblem(http.StatusInternalServerError, CodeInternal, err.Error())
+	}
+	return c.JSON(http.StatusOK, spec)
+}
+
+// openAPISpec builds an OpenAPI 3 document for the routes from their docs and request structs
+func openAPISpec(routes []*echo.Route) (openAPI, error) {
+	spec := openAPI{
+		OpenAPI: "3.0.3",
+		Info:    openAPIInfo{Title: "Appointment API", Version: "1.0.0"},
+		Paths:   map[string]map[string]operation{},
+		Components: components{
+			Schemas: map[string]*schema{},
+			SecuritySchemes: map[string]securityScheme{
+				"ApiKey": {Type: "apiKey", In: "header", Name: headerAPIKey},
+			},
+		},
+		// The api key is only required by tenants with an api_keys.json, others can be matched by host or the tenant header
+		Security: []map[string][]string{{}, {"ApiKey": {}}},
+	}
+	problem := spec.Components.schemaFor(reflect.TypeOf(Problem{}))
+
+	registered := map[string]bool{}
+	for _, route := range routes {
+		key := route.Method + " " + route.Path
+		doc, deprecated, ok := docFor(route.Method, route.Path)
+		if !ok {
+			return openAPI{}, fmt.Errorf("route %s is not documented", key)
+		}
+		registered[key] = true
+
+		op := operation{
+			Summary:     doc.summary,
+			OperationID: operationID(route.Method, route.Path),
+			Deprecated:  deprecated,
+			Responses: map[string]response{
+				strconv.Itoa(doc.status): {Description: http.StatusText(doc.status)},
+				"default": {
+					Description: "Problem details",
+					Content:     map[string]mediaType{mimeProblemJSON: {Schema: problem}},
+				},
+			},
+		}
+		// Routes that succeed with no content, like deletes, have no response
+		if doc.response != nil {
+			op.Responses[strconv.Itoa(doc.status)] = response{
+				Description: http.StatusText(doc.status),
+				Content:     spec.Components.responseContent(doc.response),
+			}
+		}
+		if u, ok := doc.request.(upload); ok {
+			op.Parameters, _ = spec.Components.requestFor(reflect.TypeOf(u.params))
+			op.RequestBody = &requestBody{Required: true, Content: map[string]mediaType{u.mimeType: {Schema: &schema{Type: "string"}}}}
+		} else if doc.request != nil {
+			op.Parameters, op.RequestBody = spec.Components.requestFor(reflect.TypeOf(doc.request))
+		}
+		if isMutating(route.Method) {
+			op.Parameters = append(op.Parameters, parameter{
+				Name:        headerIdempotencyKey,
+				In:          "header",
+				Description: "retries with the same key and request get the first response instead of repeating the change",
+				Schema:      &schema{Type: "string"},
+			})
+		}
+
+		if requiresIfMatch(versionRoute(route.Method, route.Path)) {
+			op.Parameters = append(op.Parameters, parameter{
+				Name:        headerIfMatch,
+				In:          "header",
+				Description: "the ETag of the appointment, or * for any version",
+				Required:    true,
+				Schema:      &schema{Type: "string"},
+			})
+		}
+
+		path := openAPIPath(route.Path)
+		if spec.Paths[path] == nil {
+			spec.Paths[path] = map[string]operation{}
+		}
+		spec.Paths[path][strings.ToLower(route.Method)] = op
+	}
+
+	for _, version := range apiVersions {
+		for key := range version.docs {
+			method, path, _ := strings.Cut(key, " ")
+			versioned := method + " /" + version.name + path
+			if !registered[versioned] {
+				return openAPI{}, fmt.Errorf("documented route %s is not registered", versioned)
+			}
+			if version.name == legacyVersion && !registered[key] {
+				return openAPI{}, fmt.Errorf("documented route %s is not registered", key)
+			}
+		}
+	}
+	return spec, nil
+}
+
+// docFor finds the doc for a route in the version its path is under, routes outside a version are the deprecated legacy routes
+func docFor(method string, path string) (routeDoc, bool, bool) {
+	if method == http.MethodGet && path == pathOpenAPI {
+		return openAPIRouteDoc, false, true
+	}
+
+	for _, version := range apiVersions {
+		if rest, ok := strings.CutPrefix(path, "/"+version.name+"/"); ok {
+			doc, ok := version.docs[method+" /"+rest]
+			return doc, false, ok
+		}
+	}
+	for _, version := range apiVersions {
+		if version.name == legacyVersion {
+			doc, ok := version.docs[method+" "+path]
+			return doc, true, ok
+		}
+	}
+	return routeDoc{}, false, false
+}
+
+// responseContent returns the schema of a response by media type, negotiated responses have one for each version
+func (c components) responseContent(response interface{}) map[string]mediaType {
+	if f, ok := response.(file); ok {
+		return map[string]mediaType{f.mimeType: {Schema: &schema{Type: "string"}}}
+	}
+	if w, ok := response.(withFile); ok {
+		content := c.responseContent(w.response)
+		content[w.file.mimeType] = mediaType{Schema: &schema{Type: "string"}}
+		return content
+	}
+
+	n, ok := response.(negotiated)
+	if !ok {
+		return map[string]mediaType{echo.MIMEApplicationJSON: {Schema: c.schemaFor(reflect.TypeOf(response))}}
+	}
+
+	return map[string]mediaType{
+		echo.MIMEApplicationJSON: {Schema: c.schemaFor(reflect.TypeOf(n.legacy))},
+		fmt.Sprintf("%s; version=%d", echo.MIMEApplicationJSON, responseVersionLegacy):  {Schema: c.schemaFor(reflect.TypeOf(n.legacy))},
+		fmt.Sprintf("%s; version=%d", echo.MIMEApplicationJSON, responseVersionCurrent): {Schema: c.schemaFor(reflect.TypeOf(n.current))},
+	}
+}
+
+// requestFor turns the query and param tags of a request struct into parameters and the json tags into a body
+func (c components) requestFor(t reflect.Type) ([]parameter, *requestBody) {
+	var params []parameter
+	body := &schema{Type: "object", Properties: map[string]*schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := validator.FieldName(field)
+		required, description := ruleDescription(t, field.Tag.Get("validate"))
+
+		switch {
+		case field.Tag.Get("query") != "":
+			params = append(params, parameter{Name: name, In: "query", Description: description, Required: required, Schema: c.schemaFor(field.Type)})
+		case field.Tag.Get("param") != "":
+			params = append(params, parameter{Name: name, In: "path", Description: description, Required: true, Schema: c.schemaFor(field.Type)})
+		case field.Tag.Get("json") != "":
+			property := c.schemaFor(field.Type)
+			if description != "" {
+				property = &schema{Type: property.Type, Format: property.Format, Description: description}
+			}
+			body.Properties[name] = property
+			if required {
+				body.Required = append(body.Required, name)
+			}
+		}
+	}
+
+	if len(body.Properties) == 0 {
+		return params, nil
+	}
+	return params, &requestBody{Required: true, Content: map[string]mediaType{echo.MIMEApplicationJSON: {Schema: body}}}
+}
+
+// ruleDescription describes the validate rules of a field, required is only true for fields that are always required
+func ruleDescription(t reflect.Type, rules string) (bool, string) {
+	required := false
+	var descriptions []string
+	for _, rule := range strings.Split(rules, ",") {
+		tag, param, _ := strings.Cut(rule, "=")
+		switch tag {
+		case "required":
+			required = true
+		case "required_without":
+			descriptions = append(descriptions, "required without "+fieldName(t, param))
+		case "halfhour":
+			descriptions = append(descriptions, "on the hour or half-hour")
+		case "business_hours":
+			descriptions = append(descriptions, "within the business hours of the location")
+		case "gtfield":
+			descriptions = append(descriptions, "after "+fieldName(t, param))
+		case "duration":
+			start, duration, _ := strings.Cut(param, ":")
+			descriptions = append(descriptions, duration+" after "+fieldName(t, start))
+		}
+	}
+	return required, strings.Join(descriptions, ", ")
+}
+
+// fieldName returns the name a request field is sent as
+func fieldName(t reflect.Type, name string) string {
+	field, ok := t.FieldByName(name)
+	if !ok {
+		return name
+	}
+	return validator.FieldName(field)
+}
+
+// schemaFor returns the schema for a go type, structs are added to the components and referenced
+func (c components) schemaFor(t reflect.Type) *schema {
+	if t == reflect.TypeOf(time.Time{}) {
+		return &schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return c.schemaFor(t.Elem())
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int64:
+		return &schema{Type: "integer"}
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Slice:
+		return &schema{Type: "array", Items: c.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: c.schemaFor(t.Elem())}
+	case reflect.Struct:
+		ref := &schema{Ref: "#/components/schemas/" + t.Name()}
+		if _, ok := c.Schemas[t.Name()]; ok {
+			return ref
+		}
+
+		s := &schema{Type: "object", Properties: map[string]*schema{}}
+		c.Schemas[t.Name()] = s
+		c.addProperties(s, t)
+		sort.Strings(s.Required)
+		return ref
+	default:
+		// interface{} values can be anything
+		return &schema{}
+	}
+}
+
+// addProperties adds the json fields of a struct to the schema, the fields of embedded structs are added as if they were the struct's own
+func (c components) addProperties(s *schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			c.addProperties(s, field.Type)
+			continue
+		}
+		if !field.IsExported() || name == "-" || name == "" {
+			continue
+		}
+		s.Properties[name] = c.schemaFor(field.Type)
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Ptr {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// openAPIPath converts an echo path like /schedule/:id to /schedule/{id}
+func openAPIPath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if name, ok := strings.CutPrefix(part, ":"); ok {
+			parts[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// operationID names an operation after its method and path, e.g. POST /schedule/:id/check-in is postScheduleIdCheckIn
+func operationID(method string, path string) string {
+	id := strings.ToLower(method)
+	for _, word := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == ':' || r == '-' || r == '.' }) {
+		id += strings.ToUpper(word[:1]) + word[1:]
+	}
+	return id
+}
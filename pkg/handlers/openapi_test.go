@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOpenAPISpec_MatchesRoutes fails when a route is added to BuildRouter without documenting it or a documented route is removed
+func TestOpenAPISpec_MatchesRoutes(t *testing.T) {
+	e := newTestRouter()
+	spec, err := openAPISpec(e.Routes())
+	require.NoError(t, err)
+
+	operations := 0
+	for _, ops := range spec.Paths {
+		operations += len(ops)
+	}
+	assert.Equal(t, len(e.Routes()), operations)
+
+	_, err = openAPISpec(append(e.Routes(), &echo.Route{Method: http.MethodPut, Path: "/schedule/:id"}))
+	assert.EqualError(t, err, "route PUT /schedule/:id is not documented")
+	var withoutLocations []*echo.Route
+	for _, route := range e.Routes() {
+		if route.Path != "/v1/locations" {
+			withoutLocations = append(withoutLocations, route)
+		}
+	}
+	_, err = openAPISpec(withoutLocations)
+	assert.EqualError(t, err, "documented route GET /v1/locations is not registered")
+}
+
+func TestOpenAPISpec_RequestStructs(t *testing.T) {
+	spec, err := openAPISpec(newTestRouter().Routes())
+	require.NoError(t, err)
+
+	t.Run("query parameters", func(t *testing.T) {
+		params := spec.Paths["/schedule/available"]["get"].Parameters
+		require.Len(t, params, 4)
+		assert.Equal(t, parameter{
+			Name:        "starts_at",
+			In:          "query",
+			Description: "on the hour or half-hour, within the business hours of the location",
+			Required:    true,
+			Schema:      &schema{Type: "string", Format: "date-time"},
+		}, params[0])
+		assert.Contains(t, params[1].Description, "after starts_at")
+		assert.False(t, params[2].Required)
+		assert.Equal(t, "required without location_id", params[2].Description)
+	})
+	t.Run("path parameters", func(t *testing.T) {
+		params := spec.Paths["/schedule/{id}/check-in"]["post"].Parameters
+		require.Len(t, params, 2)
+		assert.Equal(t, "path", params[0].In)
+		assert.True(t, params[0].Required)
+		assert.Equal(t, headerIdempotencyKey, params[1].Name)
+		assert.Equal(t, "header", params[1].In)
+	})
+	t.Run("if-match", func(t *testing.T) {
+		op := spec.Paths["/schedule/{id}"]["delete"]
+		require.Len(t, op.Parameters, 3)
+		assert.Equal(t, headerIfMatch, op.Parameters[2].Name)
+		assert.True(t, op.Parameters[2].Required)
+		assert.Nil(t, op.Responses["204"].Content)
+		assert.Len(t, spec.Paths["/schedule/{id}"]["get"].Parameters, 1)
+	})
+	t.Run("json body", func(t *testing.T) {
+		op := spec.Paths["/schedule"]["post"]
+		require.NotNil(t, op.RequestBody)
+		body := op.RequestBody.Content[echo.MIMEApplicationJSON].Schema
+		assert.Equal(t, []string{"starts_at", "ends_at", "trainer_id", "user_id"}, body.Required)
+		assert.Contains(t, body.Properties["ends_at"].Description, "30m after starts_at")
+		assert.Equal(t, "boolean", body.Properties["tentative"].Type)
+		assert.Contains(t, op.Responses, "201")
+	})
+	t.Run("versions", func(t *testing.T) {
+		assert.False(t, spec.Paths["/v1/schedule"]["post"].Deprecated)
+		assert.True(t, spec.Paths["/schedule"]["post"].Deprecated)
+		assert.Equal(t, spec.Paths["/v1/schedule"]["post"].RequestBody, spec.Paths["/schedule"]["post"].RequestBody)
+		assert.Equal(t, "postV1Schedule", spec.Paths["/v1/schedule"]["post"].OperationID)
+	})
+	t.Run("response schemas", func(t *testing.T) {
+		content := spec.Paths["/schedule"]["get"].Responses["200"].Content
+		assert.Equal(t, "#/components/schemas/LegacyAppointmentResponse", content[echo.MIMEApplicationJSON].Schema.Items.Ref)
+		assert.Equal(t, "#/components/schemas/AppointmentResponse", content["application/json; version=2"].Schema.Items.Ref)
+		assert.Contains(t, spec.Components.Schemas["LegacyAppointmentResponse"].Properties, "started_at")
+		assert.Contains(t, spec.Components.Schemas["AppointmentResponse"].Properties, "starts_at")
+		// The fields shared by both versions are flattened into each
+		assert.Contains(t, spec.Components.Schemas["AppointmentResponse"].Properties, "trainer_id")
+		assert.Contains(t, spec.Components.Schemas, "Problem")
+	})
+}
+
+func TestHandleGetOpenAPI(t *testing.T) {
+	e := newTestRouter()
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, pathOpenAPI, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var spec map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &spec))
+	assert.Equal(t, "3.0.3", spec["openapi"])
+	assert.Contains(t, spec["paths"], "/users/{id}/attendance")
+}
+
+func TestOperationID(t *testing.T) {
+	assert.Equal(t, "postScheduleIdCheckIn", operationID(http.MethodPost, "/schedule/:id/check-in"))
+	assert.Equal(t, "getOpenapiJson", operationID(http.MethodGet, pathOpenAPI))
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/justinthompson/appointment/pkg/validator"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+const mimeProblemJSON = "application/problem+json"
+
+// Codes clients can branch on, these are part of the API and must not change
+const (
+	CodeBadRequest          = "bad_request"
+	CodeValidationFailed    = "validation_failed"
+	CodeTrainerNotFound     = "trainer_not_found"
+	CodeLocationNotFound    = "location_not_found"
+	CodeAppointmentNotFound = "appointment_not_found"
+	CodeTenantNotFound      = "tenant_not_found"
+	CodeWebhookNotFound     = "webhook_not_found"
+	CodeDeliveryNotFound    = "delivery_not_found"
+	CodeUserNotFound        = "user_not_found"
+	CodeTenantRequired      = "tenant_required"
+	CodeInvalidAPIKey       = "invalid_api_key"
+	CodeAPIKeyRequired      = "api_key_required"
+	CodeForbidden           = "forbidden"
+	// CodeInvalidCalendarToken is returned when a calendar URL's token isn't for that calendar
+	CodeInvalidCalendarToken = "invalid_calendar_token"
+	CodeSlotConflict         = "slot_conflict"
+	CodeInvalidTransition    = "invalid_transition"
+	CodeBookingBlocked       = "booking_blocked"
+	CodeUnsupportedVersion   = "unsupported_version"
+	// CodePreconditionRequired is returned when a change to an appointment is sent without If-Match
+	CodePreconditionRequired = "precondition_required"
+	// CodeVersionMismatch is returned when If-Match isn't the appointment's current ETag
+	CodeVersionMismatch = "version_mismatch"
+	// CodeIdempotencyKeyReused is returned when an Idempotency-Key is sent again with a different request
+	CodeIdempotencyKeyReused     = "idempotency_key_reused"
+	CodeIdempotencyKeyInProgress = "idempotency_key_in_progress"
+	// CodeBatchFailed is returned when an all or nothing batch wasn't booked, the items say which appointments failed
+	CodeBatchFailed = "batch_failed"
+	// CodeBatchAborted is the code of an appointment in a failed batch that wasn't booked because of another appointment
+	CodeBatchAborted = "batch_aborted"
+	// CodeInvalidCalendar is returned when an uploaded iCalendar file can't be read
+	CodeInvalidCalendar = "invalid_calendar"
+	// CodeInvalidTemplate is returned when a preview fails because one of the gym's templates can't be rendered
+	CodeInvalidTemplate = "invalid_template"
+	// CodeInvalidCSV is returned when an uploaded csv file can't be read or is missing columns, errors in rows are in the result file
+	CodeInvalidCSV           = "invalid_csv"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeInternal             = "internal_error"
+)
+
+// Problem is an RFC 7807 problem details body with a stable code
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+	// Errors lists the invalid fields of a request that failed validation
+	Errors []validator.FieldError `json:"errors,omitempty"`
+	// Items says what happened to each appointment in a batch that failed
+	Items []BatchItemResponse `json:"items,omitempty"`
+}
+
+// managerErrors maps the manager's sentinel errors to a status and code
+var managerErrors = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{appointment.ErrTrainerNotFound, http.StatusNotFound, CodeTrainerNotFound},
+	{appointment.ErrLocationNotFound, http.StatusNotFound, CodeLocationNotFound},
+	{appointment.ErrAppointmentNotFound, http.StatusNotFound, CodeAppointmentNotFound},
+	{appointment.ErrTenantNotFound, http.StatusNotFound, CodeTenantNotFound},
+	{appointment.ErrWebhookNotFound, http.StatusNotFound, CodeWebhookNotFound},
+	{appointment.ErrDeliveryNotFound, http.StatusNotFound, CodeDeliveryNotFound},
+	{appointment.ErrUserNotFound, http.StatusNotFound, CodeUserNotFound},
+	{appointment.ErrSlotConflict, http.StatusConflict, CodeSlotConflict},
+	{appointment.ErrInvalidTransition, http.StatusConflict, CodeInvalidTransition},
+	{appointment.ErrBookingBlocked, http.StatusForbidden, CodeBookingBlocked},
+	{appointment.ErrVersionMismatch, http.StatusPreconditionFailed, CodeVersionMismatch},
+	{appointment.ErrBatchAborted, http.StatusFailedDependency, CodeBatchAborted},
+	{appointment.ErrValidation, http.StatusUnprocessableEntity, CodeValidationFailed},
+}
+
+// newProblem returns an HTTP error with a problem body
+func newProblem(status int, code string, detail string) *echo.HTTPError {
+	return echo.NewHTTPError(status, problemFor(status, code, detail))
+}
+
+// problemFor builds a problem for the status, the type is about:blank so the title is the status text
+func problemFor(status int, code string, detail string) Problem {
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// validationProblem lists the invalid fields of a request in the client's language
+func validationProblem(c echo.Context, err error) *echo.HTTPError {
+	problem := validationProblemFor(c, err)
+	return echo.NewHTTPError(problem.Status, problem)
+}
+
+// validationProblemFor is the problem validationProblem returns
+func validationProblemFor(c echo.Context, err error) Problem {
+	var validationErr *validator.ValidationError
+	if !errors.As(err, &validationErr) {
+		return problemFor(http.StatusUnprocessableEntity, CodeValidationFailed, err.Error())
+	}
+
+	problem := problemFor(http.StatusUnprocessableEntity, CodeValidationFailed, "the request has invalid fields")
+	problem.Errors = validationErr.Fields(c.Request().Header.Get("Accept-Language"))
+	return problem
+}
+
+// managerProblem converts an error from the manager into a problem, errors that don't match a sentinel are internal errors
+func managerProblem(err error, action string) *echo.HTTPError {
+	problem := managerProblemFor(err, action)
+	return echo.NewHTTPError(problem.Status, problem)
+}
+
+// managerProblemFor is the problem managerProblem returns
+func managerProblemFor(err error, action string) Problem {
+	detail := fmt.Errorf("%s: %w", action, err).Error()
+	for _, e := range managerErrors {
+		if errors.Is(err, e.err) {
+			return problemFor(e.status, e.code, detail)
+		}
+	}
+
+	log.Error().Err(err).Msg(action)
+	return problemFor(http.StatusInternalServerError, CodeInternal, detail)
+}
+
+// problemErrorHandler writes every error as application/problem+json, including the errors echo creates itself like 404 and 405
+func problemErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	problem := problemFor(http.StatusInternalServerError, CodeInternal, "")
+	if he, ok := err.(*echo.HTTPError); ok {
+		if internal, ok := he.Internal.(*echo.HTTPError); ok {
+			he = internal
+		}
+		if p, ok := he.Message.(Problem); ok {
+			problem = p
+		} else {
+			problem = problemFor(he.Code, statusCode(he.Code), fmt.Sprint(he.Message))
+		}
+	} else {
+		log.Error().Err(err).Msg("unhandled error")
+	}
+	problem.Instance = c.Request().URL.Path
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(problem.Status)
+	} else {
+		err = writeProblem(c, problem)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("error writing problem response")
+	}
+}
+
+// writeProblem writes the problem with the problem+json content type
+func writeProblem(c echo.Context, problem Problem) error {
+	body, err := json.Marshal(problem)
+	if err != nil {
+		return err
+	}
+	return c.Blob(problem.Status, mimeProblemJSON, body)
+}
+
+// statusCode makes a code from the status text for errors that didn't come with one, e.g. 404 becomes not_found
+func statusCode(status int) string {
+	if status == http.StatusBadRequest {
+		return CodeBadRequest
+	}
+	text := http.StatusText(status)
+	if text == "" {
+		return CodeInternal
+	}
+	return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProblemErrorHandler(t *testing.T) {
+	t.Run("problem from a handler", func(t *testing.T) {
+		c, rec := newContext()
+		problemErrorHandler(newProblem(http.StatusConflict, CodeSlotConflict, "appointment already exists at this time"), c)
+
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.Equal(t, mimeProblemJSON, rec.Header().Get(echo.HeaderContentType))
+
+		var problem Problem
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+		assert.Equal(t, Problem{
+			Type:     "about:blank",
+			Title:    "Conflict",
+			Status:   http.StatusConflict,
+			Detail:   "appointment already exists at this time",
+			Instance: "/",
+			Code:     CodeSlotConflict,
+		}, problem)
+	})
+	t.Run("error created by echo", func(t *testing.T) {
+		c, rec := newContext()
+		problemErrorHandler(echo.ErrNotFound, c)
+
+		var problem Problem
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+		assert.Equal(t, http.StatusNotFound, problem.Status)
+		assert.Equal(t, "not_found", problem.Code)
+	})
+	t.Run("plain error", func(t *testing.T) {
+		c, rec := newContext()
+		problemErrorHandler(fmt.Errorf("something broke"), c)
+
+		var problem Problem
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+		assert.Equal(t, http.StatusInternalServerError, problem.Status)
+		assert.Equal(t, CodeInternal, problem.Code)
+		assert.Empty(t, problem.Detail)
+	})
+}
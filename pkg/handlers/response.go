@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/labstack/echo/v4"
+)
+
+// Response versions a client can ask for with a version parameter in the Accept header, e.g. application/json; version=2
+const (
+	// responseVersionLegacy names the times started_at and ended_at, clients that don't ask for a version get this
+	responseVersionLegacy = 1
+	// responseVersionCurrent names the times starts_at and ends_at like the requests
+	responseVersionCurrent = 2
+)
+
+type (
+	// AppointmentResponse is an appointment with the same field names as the requests
+	AppointmentResponse struct {
+		ID        int       `json:"id,omitempty"`
+		StartTime time.Time `json:"starts_at"`
+		EndTime   time.Time `json:"ends_at"`
+		appointmentFields
+	}
+
+	// LegacyAppointmentResponse is an appointment as it was returned before the names matched the requests
+	LegacyAppointmentResponse struct {
+		ID        int       `json:"id,omitempty"`
+		StartTime time.Time `json:"started_at"`
+		EndTime   time.Time `json:"ended_at"`
+		appointmentFields
+	}
+
+	// BatchResponse says what happened to each appointment in a batch in the order they were sent
+	BatchResponse struct {
+		Items []BatchItemResponse `json:"items"`
+	}
+
+	// BatchItemResponse is an appointment from a batch, it has the booked appointment with a 201 status or the problem that stopped it
+	BatchItemResponse struct {
+		Status int `json:"status"`
+		// Appointment is in the response version like a single booking
+		Appointment interface{} `json:"appointment,omitempty"`
+		Problem     *Problem    `json:"problem,omitempty"`
+	}
+
+	// appointmentFields are the fields every version of an appointment response has
+	appointmentFields struct {
+		UserID           int                        `json:"user_id,omitempty"`
+		TrainerID        int                        `json:"trainer_id"`
+		LocationID       int                        `json:"location_id,omitempty"`
+		Status           appointment.Status         `json:"status,omitempty"`
+		StatusHistory    []appointment.StatusChange `json:"status_history,omitempty"`
+		ExpiresAt        *time.Time                 `json:"expires_at,omitempty"`
+		SessionType      string                     `json:"session_type,omitempty"`
+		LateCancellation bool                       `json:"late_cancellation,omitempty"`
+		LateCancelFee    int                        `json:"late_cancel_fee,omitempty"`
+		Version          int                        `json:"version,omitempty"`
+	}
+)
+
+// writeAppointment writes the appointment in the response version with its version as the ETag
+func writeAppointment(c echo.Context, status int, version int, app appointment.Appointment) error {
+	c.Response().Header().Set(headerETag, appointmentETag(app))
+	setVersionContentType(c, version)
+	return c.JSON(status, appointmentResponse(version, app))
+}
+
+// writeAppointments writes the appointments in the response version.
+// The ETag is a hash of the body so a client polling with If-None-Match gets 304 until something changes.
+func writeAppointments(c echo.Context, status int, version int, apps []appointment.Appointment) error {
+	responses := make([]interface{}, 0, len(apps))
+	for _, app := range apps {
+		responses = append(responses, appointmentResponse(version, app))
+	}
+	body, err := json.Marshal(responses)
+	if err != nil {
+		return err
+	}
+
+	etag := bodyETag(body)
+	c.Response().Header().Set(headerETag, etag)
+	if notModified(c.Request(), etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.Blob(status, versionContentType(version), append(body, '\n'))
+}
+
+// setVersionContentType tells the client which version the response is, echo only sets the content type if it isn't already
+func setVersionContentType(c echo.Context, version int) {
+	c.Response().Header().Set(echo.HeaderContentType, versionContentType(version))
+}
+
+// versionContentType is the content type of a response in the version
+func versionContentType(version int) string {
+	return fmt.Sprintf("%s; version=%d", echo.MIMEApplicationJSON, version)
+}
+
+// appointmentResponse converts the appointment to the response for the version
+func appointmentResponse(version int, app appointment.Appointment) interface{} {
+	fields := appointmentFields{
+		UserID:           app.UserID,
+		TrainerID:        app.TrainerID,
+		LocationID:       app.LocationID,
+		Status:           app.Status,
+		StatusHistory:    app.StatusHistory,
+		ExpiresAt:        app.ExpiresAt,
+		SessionType:      app.SessionType,
+		LateCancellation: app.LateCancellation,
+		LateCancelFee:    app.LateCancelFee,
+		Version:          app.Version,
+	}
+	if version == responseVersionLegacy {
+		return LegacyAppointmentResponse{ID: app.ID, StartTime: app.StartTime, EndTime: app.EndTime, appointmentFields: fields}
+	}
+	return AppointmentResponse{ID: app.ID, StartTime: app.StartTime, EndTime: app.EndTime, appointmentFields: fields}
+}
+
+// responseVersion returns the version the Accept header asks for.
+// The first json media type with a version wins, clients that don't give one get the legacy version.
+func responseVersion(c echo.Context) (int, error) {
+	c.Response().Header().Add(echo.HeaderVary, "Accept")
+
+	version := responseVersionLegacy
+	for _, accept := range strings.Split(c.Request().Header.Get(echo.HeaderAccept), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil || params["version"] == "" {
+			continue
+		}
+		if mediaType != echo.MIMEApplicationJSON && mediaType != "application/*" && mediaType != "*/*" {
+			continue
+		}
+
+		v, err := strconv.Atoi(params["version"])
+		if err != nil || v < responseVersionLegacy || v > responseVersionCurrent {
+			return 0, newProblem(http.StatusNotAcceptable, CodeUnsupportedVersion, fmt.Sprintf("response version %s is not supported", params["version"]))
+		}
+		version = v
+		break
+	}
+	return version, nil
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseVersion(t *testing.T) {
+	tests := []struct {
+		accept  string
+		version int
+	}{
+		{"", responseVersionLegacy},
+		{"application/json", responseVersionLegacy},
+		{"application/json; version=1", responseVersionLegacy},
+		{"application/json; version=2", responseVersionCurrent},
+		{"text/html, */*; version=2", responseVersionCurrent},
+		{"text/html; version=2", responseVersionLegacy},
+	}
+	for _, tt := range tests {
+		c, _ := newContext()
+		c.Request().Header.Set("Accept", tt.accept)
+		version, err := responseVersion(c)
+		require.NoError(t, err, tt.accept)
+		assert.Equal(t, tt.version, version, tt.accept)
+	}
+
+	c, _ := newContext()
+	c.Request().Header.Set("Accept", "application/json; version=3")
+	_, err := responseVersion(c)
+	assertProblem(t, err, http.StatusNotAcceptable, CodeUnsupportedVersion)
+}
+
+func TestHandlePostAppointment_ResponseVersion(t *testing.T) {
+	app := appointment.Appointment{
+		StartTime: time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC),
+		EndTime:   time.Date(2022, 1, 1, 9, 30, 0, 0, time.UTC),
+		TrainerID: 1,
+	}
+
+	t.Run("legacy names by default", func(t *testing.T) {
+		c, rec := newContext()
+		SetAppointment(c, app)
+		require.NoError(t, handlePostAppointment(c, appointment.NewMockAppointmentManager(nil, nil)))
+		assert.Equal(t, "application/json; version=1", rec.Header().Get("Content-Type"))
+
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		assert.Equal(t, "2022-01-01T09:00:00Z", body["started_at"])
+		assert.Equal(t, "2022-01-01T09:30:00Z", body["ended_at"])
+		assert.NotContains(t, body, "starts_at")
+	})
+	t.Run("request names for version 2", func(t *testing.T) {
+		c, rec := newContext()
+		c.Request().Header.Set("Accept", "application/json; version=2")
+		SetAppointment(c, app)
+		require.NoError(t, handlePostAppointment(c, appointment.NewMockAppointmentManager(nil, nil)))
+		assert.Equal(t, "application/json; version=2", rec.Header().Get("Content-Type"))
+
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		assert.Equal(t, "2022-01-01T09:00:00Z", body["starts_at"])
+		assert.Equal(t, "2022-01-01T09:30:00Z", body["ends_at"])
+		assert.Equal(t, float64(1), body["trainer_id"])
+		assert.NotContains(t, body, "started_at")
+	})
+	t.Run("unsupported version doesn't book", func(t *testing.T) {
+		c, _ := newContext()
+		c.Request().Header.Set("Accept", "application/json; version=9")
+		SetAppointment(c, app)
+		err := handlePostAppointment(c, appointment.NewMockAppointmentManager(nil, appointment.ErrSlotConflict))
+		assertProblem(t, err, http.StatusNotAcceptable, CodeUnsupportedVersion)
+	})
+}
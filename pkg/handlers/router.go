@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -11,11 +13,37 @@ import (
 	"github.com/justinthompson/appointment/pkg/validator"
 )
 
-// BuildRouter sets up the routes for the API
-func BuildRouter(r *echo.Echo, appManager appointment.Manager) {
+// Config has the settings for the router, zero values use the defaults
+type Config struct {
+	// IdempotencyWindow is how long the response to a request with an Idempotency-Key is replayed for retries, 24h by default
+	IdempotencyWindow time.Duration
+	// BodyLimit is the largest request body a route accepts, 1KB by default
+	BodyLimit string
+	// RouteBodyLimits overrides BodyLimit for routes by method and path within the version, e.g. "POST /schedule/batch": "64KB"
+	RouteBodyLimits map[string]string
+	// CalendarSecret signs the calendar URLs, changing it revokes them.
+	// A random secret is used if it is empty so calendar URLs stop working when the server restarts.
+	CalendarSecret []byte
+	// AllowAnonymous serves tenants that have no api keys to anyone without a key, for development.
+	// By default every request needs a key so a tenant without keys can't be used until it has some.
+	AllowAnonymous bool
+}
+
+// Body limits used when the config doesn't set them, bulk routes need more than a single booking
+const defaultBodyLimit = "1KB"
+
+var defaultRouteBodyLimits = map[string]string{
+	"POST /schedule/batch":    "64KB",
+	"POST /schedule/import":   "1MB",
+	"POST /trainers/:id/busy": "256KB",
+}
+
+// BuildRouter sets up the routes for the API.
+// Every route is scoped to a tenant and uses that tenant's manager.
+func BuildRouter(r *echo.Echo, tenants *appointment.Tenants, config Config) {
 	r.Use(middleware.Recover())
 	r.Use(middleware.Secure())
-	r.Use(middleware.BodyLimit("1KB"))
+	r.Use(MiddlewareBodyLimit(config.bodyLimit(), config.routeBodyLimits()))
 	// In a real system I wouldnt log every request because the cost and noise would be bad.
 	// I just added this because I wanted to test it out
 	r.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
@@ -36,25 +64,265 @@ func BuildRouter(r *echo.Echo, appManager appointment.Manager) {
 		},
 	}))
 	r.Use(middleware.TimeoutWithConfig(middleware.TimeoutConfig{
+		// Streams stay open until the client goes away
+		Skipper: func(c echo.Context) bool {
+			return streamingRoutes[versionRoute(c.Request().Method, c.Path())]
+		},
 		ErrorMessage: "request timed out",
 		Timeout:      1 * time.Second,
 	}))
 
 	r.Validator = validator.NewValidator()
+	r.HTTPErrorHandler = problemErrorHandler
+
+	if len(config.CalendarSecret) == 0 {
+		config.CalendarSecret = make([]byte, 32)
+		if _, err := rand.Read(config.CalendarSecret); err != nil {
+			panic(err)
+		}
+		log.Warn().Msg("no calendar secret is set, calendar urls will stop working when the server restarts")
+	}
+
+	for _, tenantID := range tenants.IDs() {
+		switch {
+		case tenants.HasAPIKeys(tenantID):
+		case config.AllowAnonymous:
+			log.Warn().Str("tenant", tenantID).Msg("the tenant has no api keys, anyone that can reach the server can use its api")
+		default:
+			log.Warn().Str("tenant", tenantID).Msg("the tenant has no api keys, every request to it will be refused")
+		}
+	}
+
+	tenant := MiddlewareTenant(tenants)
+	authenticate := MiddlewareAuthenticate(tenants, config.AllowAnonymous)
+	// Retries of mutating requests are replayed from here, the store is shared so a key is the same request on every version
+	idempotent := MiddlewareIdempotency(newIdempotencyStore(config.IdempotencyWindow))
+	for _, version := range apiVersions {
+		version.routes(r.Group("/"+version.name), config, tenant, authenticate, idempotent)
+		// Clients from before the API was versioned still call the root, those routes are deprecated in favour of the version
+		if version.name == legacyVersion {
+			version.routes(r.Group(""), config, MiddlewareDeprecated(version.name), tenant, authenticate, idempotent)
+		}
+	}
+
+	// The spec is built from the routes above so it isn't scoped to a tenant
+	r.GET(pathOpenAPI, handleGetOpenAPI)
+}
+
+// bodyLimit returns the default body limit
+func (c Config) bodyLimit() string {
+	if c.BodyLimit == "" {
+		return defaultBodyLimit
+	}
+	return c.BodyLimit
+}
+
+// routeBodyLimits returns the body limit of each route that doesn't use the default, the config's limits win
+func (c Config) routeBodyLimits() map[string]string {
+	limits := make(map[string]string, len(defaultRouteBodyLimits)+len(c.RouteBodyLimits))
+	for route, limit := range defaultRouteBodyLimits {
+		limits[route] = limit
+	}
+	for route, limit := range c.RouteBodyLimits {
+		limits[route] = limit
+	}
+	return limits
+}
+
+// MiddlewareBodyLimit limits the size of request bodies, routes in limits get their own limit.
+// It runs after routing so the route's path is known, the same route has the same limit in every version and at the root.
+func MiddlewareBodyLimit(limit string, limits map[string]string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		limited := middleware.BodyLimit(limit)(next)
+		routes := make(map[string]echo.HandlerFunc, len(limits))
+		for route, limit := range limits {
+			routes[route] = middleware.BodyLimit(limit)(next)
+		}
+
+		return func(c echo.Context) error {
+			if handler, ok := routes[versionRoute(c.Request().Method, c.Path())]; ok {
+				return handler(c)
+			}
+			return limited(c)
+		}
+	}
+}
+
+// versionRoute returns the method and path of a route within its version, e.g. POST /v1/schedule is POST /schedule
+func versionRoute(method string, path string) string {
+	for _, version := range apiVersions {
+		if rest, ok := strings.CutPrefix(path, "/"+version.name+"/"); ok {
+			return method + " /" + rest
+		}
+	}
+	return method + " " + path
+}
+
+// apiVersion is a version of the API mounted at /<name>.
+// Versions can bind and return different shapes but every version uses the tenant's manager.
+type apiVersion struct {
+	name string
+	// routes registers the version's routes on the group with the middleware in front of each route's own
+	routes func(g *echo.Group, config Config, m ...echo.MiddlewareFunc)
+	// docs describes each route for the OpenAPI spec by method and path within the version
+	docs map[string]routeDoc
+}
+
+// legacyVersion is the version the unversioned routes at the root behave as
+const legacyVersion = "v1"
+
+// apiVersions are the versions the router mounts, a new version is mounted by adding it here
+var apiVersions = []apiVersion{
+	{name: "v1", routes: v1Routes, docs: v1RouteDocs},
+}
+
+// v1Routes registers the routes for version 1 of the API
+func v1Routes(g *echo.Group, config Config, m ...echo.MiddlewareFunc) {
+	// with returns the shared middleware followed by the route's own
+	with := func(route ...echo.MiddlewareFunc) []echo.MiddlewareFunc {
+		return append(append([]echo.MiddlewareFunc{}, m...), route...)
+	}
 
 	handlerGetAvailableTimes := func(c echo.Context) error {
-		return handleGetAvailableTimes(c, appManager)
+		return handleGetAvailableTimes(c, GetManager(c))
 	}
 
 	handlerGetScheduledAppointments := func(c echo.Context) error {
-		return handleGetScheduledAppointments(c, appManager)
+		return handleGetScheduledAppointments(c, GetManager(c))
 	}
 
 	handlerAddNewAppointment := func(c echo.Context) error {
-		return handlePostAppointment(c, appManager)
+		return handlePostAppointment(c, GetManager(c))
+	}
+
+	handlerGetAppointment := func(c echo.Context) error {
+		return handleGetAppointment(c, GetManager(c))
+	}
+
+	handlerPatchAppointment := func(c echo.Context) error {
+		return handlePatchAppointment(c, GetManager(c))
 	}
 
-	r.GET("/schedule/available", handlerGetAvailableTimes, MiddlewareAvailable)
-	r.GET("/schedule", handlerGetScheduledAppointments, MiddlewareScheduled)
-	r.POST("/schedule", handlerAddNewAppointment, MiddlewarePost)
+	handlerDeleteAppointment := func(c echo.Context) error {
+		return handleDeleteAppointment(c, GetManager(c))
+	}
+
+	handlerGetScheduleStream := func(c echo.Context) error {
+		return handleGetScheduleStream(c, GetManager(c))
+	}
+
+	handlerPostBatch := func(c echo.Context) error {
+		return handlePostBatch(c, GetManager(c))
+	}
+
+	handlerGetScheduleExport := func(c echo.Context) error {
+		return handleGetScheduleExport(c, GetManager(c))
+	}
+
+	handlerPostScheduleImport := func(c echo.Context) error {
+		return handlePostScheduleImport(c, GetManager(c))
+	}
+
+	// handlerTransition returns a handler that applies the action to the appointment in the path
+	handlerTransition := func(action appointment.Action) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			return handleTransitionAppointment(c, GetManager(c), action)
+		}
+	}
+
+	handlerGetLocations := func(c echo.Context) error {
+		return handleGetLocations(c, GetManager(c))
+	}
+
+	handlerGetAttendanceRecord := func(c echo.Context) error {
+		return handleGetAttendanceRecord(c, GetManager(c))
+	}
+
+	handlerPostBusyBlocks := func(c echo.Context) error {
+		return handlePostBusyBlocks(c, GetManager(c))
+	}
+
+	handlerGetBusyBlocks := func(c echo.Context) error {
+		return handleGetBusyBlocks(c, GetManager(c))
+	}
+
+	handlerGetFreeBusy := func(c echo.Context) error {
+		return handleGetFreeBusy(c, GetManager(c))
+	}
+
+	handlerPostWebhook := func(c echo.Context) error {
+		return handlePostWebhook(c, GetManager(c))
+	}
+
+	handlerGetWebhooks := func(c echo.Context) error {
+		return handleGetWebhooks(c, GetManager(c))
+	}
+
+	handlerDeleteWebhook := func(c echo.Context) error {
+		return handleDeleteWebhook(c, GetManager(c))
+	}
+
+	handlerGetDeadLetters := func(c echo.Context) error {
+		return handleGetDeadLetters(c, GetManager(c))
+	}
+
+	handlerPostRetryDeadLetter := func(c echo.Context) error {
+		return handlePostRetryDeadLetter(c, GetManager(c))
+	}
+
+	handlerGetNotificationPreview := func(c echo.Context) error {
+		return handleGetNotificationPreview(c, GetManager(c))
+	}
+
+	// handlerCalendar returns a handler that writes the feed's calendar
+	handlerCalendar := func(feed calendarFeed) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			return handleGetCalendar(c, GetManager(c), feed)
+		}
+	}
+
+	// handlerCalendarLink returns a handler that returns the URL of the feed's calendar
+	handlerCalendarLink := func(feed calendarFeed) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			return handleGetCalendarLink(c, feed, config.CalendarSecret)
+		}
+	}
+
+	// Admins can use every route, trainers only their own schedule and clients only their own appointments
+	admin := MiddlewareRole(appointment.RoleAdmin)
+	staff := MiddlewareRole(appointment.RoleAdmin, appointment.RoleTrainer)
+	notTrainer := MiddlewareRole(appointment.RoleAdmin, appointment.RoleClient)
+
+	g.GET("/schedule/available", handlerGetAvailableTimes, with(MiddlewareAvailable)...)
+	g.GET("/schedule", handlerGetScheduledAppointments, with(MiddlewareScheduled, MiddlewareAuthorizeSchedule)...)
+	g.POST("/schedule", handlerAddNewAppointment, with(MiddlewarePost, MiddlewareAuthorizeBooking)...)
+	g.POST("/schedule/batch", handlerPostBatch, with(MiddlewareBatch, MiddlewareAuthorizeBatch)...)
+	g.GET("/schedule/stream", handlerGetScheduleStream, with(staff, MiddlewareStream, MiddlewareAuthorizeSchedule)...)
+	g.GET("/schedule/export", handlerGetScheduleExport, with(MiddlewareExport, MiddlewareAuthorizeSchedule)...)
+	g.POST("/schedule/import", handlerPostScheduleImport, with(admin, MiddlewareImport)...)
+	g.GET("/schedule/:id", handlerGetAppointment, with(MiddlewareAppointmentID, MiddlewareAuthorizeAppointment)...)
+	g.PATCH("/schedule/:id", handlerPatchAppointment, with(MiddlewarePatch, MiddlewareAuthorizeAppointment)...)
+	g.DELETE("/schedule/:id", handlerDeleteAppointment, with(staff, MiddlewareAppointmentID, MiddlewareAuthorizeAppointment)...)
+	g.POST("/schedule/:id/confirm", handlerTransition(appointment.ActionConfirm), with(MiddlewareAppointmentID, MiddlewareAuthorizeAppointment)...)
+	g.POST("/schedule/:id/check-in", handlerTransition(appointment.ActionCheckIn), with(staff, MiddlewareAppointmentID, MiddlewareAuthorizeAppointment)...)
+	g.POST("/schedule/:id/complete", handlerTransition(appointment.ActionComplete), with(staff, MiddlewareAppointmentID, MiddlewareAuthorizeAppointment)...)
+	g.POST("/schedule/:id/no-show", handlerTransition(appointment.ActionNoShow), with(staff, MiddlewareAppointmentID, MiddlewareAuthorizeAppointment)...)
+	g.POST("/schedule/:id/cancel", handlerTransition(appointment.ActionCancel), with(MiddlewareAppointmentID, MiddlewareAuthorizeAppointment)...)
+	g.POST("/schedule/:id/accept", handlerTransition(appointment.ActionAccept), with(staff, MiddlewareAppointmentID, MiddlewareAuthorizeAppointment)...)
+	g.POST("/schedule/:id/decline", handlerTransition(appointment.ActionDecline), with(staff, MiddlewareAppointmentID, MiddlewareAuthorizeAppointment)...)
+	g.GET("/locations", handlerGetLocations, with()...)
+	g.GET("/users/:id/attendance", handlerGetAttendanceRecord, with(MiddlewareUserID, MiddlewareAuthorizeUser)...)
+	g.GET("/trainers/:id/calendar", handlerCalendarLink(calendarTrainer), with(staff, MiddlewareTrainerID, MiddlewareAuthorizeTrainer)...)
+	g.GET("/trainers/:id/calendar.ics", handlerCalendar(calendarTrainer), with(MiddlewareCalendarToken(calendarTrainer, config.CalendarSecret))...)
+	g.POST("/trainers/:id/busy", handlerPostBusyBlocks, with(staff, MiddlewareBusyImport, MiddlewareAuthorizeTrainer)...)
+	g.GET("/trainers/:id/busy", handlerGetBusyBlocks, with(staff, MiddlewareTrainerID, MiddlewareAuthorizeTrainer)...)
+	g.GET("/trainers/:id/freebusy", handlerGetFreeBusy, with(MiddlewareFreeBusy)...)
+	g.GET("/users/:id/calendar", handlerCalendarLink(calendarUser), with(notTrainer, MiddlewareUserID, MiddlewareAuthorizeUser)...)
+	g.GET("/users/:id/calendar.ics", handlerCalendar(calendarUser), with(MiddlewareCalendarToken(calendarUser, config.CalendarSecret))...)
+	g.POST("/webhooks", handlerPostWebhook, with(admin, MiddlewarePostWebhook)...)
+	g.GET("/webhooks", handlerGetWebhooks, with(admin)...)
+	g.DELETE("/webhooks/:id", handlerDeleteWebhook, with(admin, MiddlewareWebhookID)...)
+	g.GET("/webhooks/dead-letters", handlerGetDeadLetters, with(admin)...)
+	g.POST("/webhooks/dead-letters/:id/retry", handlerPostRetryDeadLetter, with(admin, MiddlewareDeliveryID)...)
+	g.GET("/notifications/:type/preview", handlerGetNotificationPreview, with(admin, MiddlewarePreviewNotification)...)
 }
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRouter() *echo.Echo {
+	e := echo.New()
+	BuildRouter(e, appointment.NewSingleTenant(appointment.NewMockAppointmentManager(nil, nil)), Config{AllowAnonymous: true})
+	return e
+}
+
+func TestBuildRouter_Versions(t *testing.T) {
+	e := newTestRouter()
+
+	t.Run("v1", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/locations", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get(headerDeprecation))
+	})
+	t.Run("legacy routes are deprecated", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/locations", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NotEmpty(t, rec.Header().Get(headerDeprecation))
+		assert.NotEmpty(t, rec.Header().Get(headerSunset))
+		assert.Equal(t, `</v1/locations>; rel="successor-version"`, rec.Header().Get(headerLink))
+	})
+	t.Run("unknown version", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v9/locations", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
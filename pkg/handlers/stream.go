@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+)
+
+const (
+	mimeEventStream   = "text/event-stream"
+	headerLastEventID = "Last-Event-ID"
+
+	// eventReset tells a stream's client it missed events and should fetch the schedule again
+	eventReset = "reset"
+)
+
+// streamKeepAlive is how often a comment is sent on a quiet stream so proxies don't close it
+var streamKeepAlive = 15 * time.Second
+
+// streamingRoutes are the routes that stay open, they are skipped by the request timeout
+var streamingRoutes = map[string]bool{
+	"GET /schedule/stream": true,
+}
+
+type (
+	// StreamScheduleRequest follows the changes to a trainer's or location's schedule
+	StreamScheduleRequest struct {
+		TrainerID  int `query:"trainer_id" validate:"required_without=LocationID"`
+		LocationID int `query:"location_id"`
+	}
+
+	// StreamEventResponse is the data of an event on the schedule stream, the appointment is in the current response version
+	StreamEventResponse struct {
+		Type        appointment.EventType `json:"type"`
+		At          time.Time             `json:"at"`
+		Appointment AppointmentResponse   `json:"appointment"`
+	}
+)
+
+// MiddlewareStream is a middleware that takes the filters of a schedule stream and converts them to a schedule query
+func MiddlewareStream(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req StreamScheduleRequest
+		if err := bindRequest(c, &req); err != nil {
+			return err
+		}
+
+		SetScheduleQuery(c, appointment.ScheduleQuery{TrainerID: req.TrainerID, LocationID: req.LocationID})
+		return next(c)
+	}
+}
+
+// handleGetScheduleStream sends the changes to the schedule as server-sent events until the client goes away.
+// A client that reconnects with Last-Event-ID gets the events it missed, or a reset event if they are no longer kept.
+func handleGetScheduleStream(c echo.Context, appManager appointment.Manager) error {
+	query := GetScheduleQuery(c)
+	after := -1
+	if header := strings.TrimSpace(c.Request().Header.Get(headerLastEventID)); header != "" {
+		id, err := strconv.Atoi(header)
+		if err != nil || id < 0 {
+			return newProblem(http.StatusBadRequest, CodeBadRequest, "Last-Event-ID must be the id of an event")
+		}
+		after = id
+	}
+
+	// Check the manager before the stream starts so an error can still be a problem response
+	feed, err := appManager.EventsAfter(after)
+	if err != nil {
+		return managerProblem(err, "error streaming schedule")
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, mimeEventStream)
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	// Stop nginx buffering the events
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	fmt.Fprint(res, "retry: 3000\n\n")
+	res.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		if feed.Missed {
+			fmt.Fprintf(res, "id: %d\nevent: %s\ndata: {}\n\n", feed.LatestID, eventReset)
+		}
+		for _, event := range feed.Events {
+			if !streamMatches(query, event.Appointment) {
+				continue
+			}
+			data, err := json.Marshal(StreamEventResponse{
+				Type:        event.Type,
+				At:          event.At,
+				Appointment: appointmentResponse(responseVersionCurrent, event.Appointment).(AppointmentResponse),
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		}
+		res.Flush()
+		after = feed.LatestID
+
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-feed.Next:
+		case <-keepAlive.C:
+			fmt.Fprint(res, ": keep-alive\n\n")
+			res.Flush()
+		}
+
+		if feed, err = appManager.EventsAfter(after); err != nil {
+			log.Error().Err(err).Msg("error streaming schedule")
+			return nil
+		}
+	}
+}
+
+// streamMatches reports whether the appointment is on the schedule the stream follows
+func streamMatches(query appointment.ScheduleQuery, app appointment.Appointment) bool {
+	if query.TrainerID != 0 && app.TrainerID != query.TrainerID {
+		return false
+	}
+	return query.LocationID == 0 || app.LocationID == query.LocationID
+}
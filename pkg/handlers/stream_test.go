@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetScheduleStream(t *testing.T) {
+	start := time.Date(2030, 1, 7, 17, 0, 0, 0, time.UTC)
+	appManager := appointment.NewMockAppointmentManager(nil, nil)
+	appManager.Events = []appointment.Event{
+		{ID: 1, Type: appointment.EventCreated, At: start, Appointment: appointment.Appointment{ID: 4, TrainerID: 1, StartTime: start}},
+		{ID: 2, Type: appointment.EventCreated, At: start, Appointment: appointment.Appointment{ID: 5, TrainerID: 2, StartTime: start}},
+		{ID: 3, Type: "appointment.cancelled", At: start, Appointment: appointment.Appointment{ID: 4, TrainerID: 1, StartTime: start}},
+	}
+	e := echo.New()
+	BuildRouter(e, appointment.NewSingleTenant(appManager), Config{AllowAnonymous: true})
+	stream := func(target string, lastEventID string, wait time.Duration) *httptest.ResponseRecorder {
+		ctx, cancel := context.WithTimeout(context.Background(), wait)
+		defer cancel()
+		req := httptest.NewRequest(http.MethodGet, target, nil).WithContext(ctx)
+		if lastEventID != "" {
+			req.Header.Set(headerLastEventID, lastEventID)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("resume", func(t *testing.T) {
+		// The stream outlives the request timeout
+		rec := stream("/v1/schedule/stream?trainer_id=1", "1", 1200*time.Millisecond)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, mimeEventStream, rec.Header().Get(echo.HeaderContentType))
+
+		body := rec.Body.String()
+		assert.True(t, strings.HasPrefix(body, "retry: 3000\n\nid: 3\nevent: appointment.cancelled\ndata: {"), body)
+		assert.Contains(t, body, `"starts_at":"2030-01-07T17:00:00Z"`)
+		// Trainer 2's appointment isn't on the stream
+		assert.NotContains(t, body, "id: 2\n")
+	})
+	t.Run("from now", func(t *testing.T) {
+		rec := stream("/v1/schedule/stream?trainer_id=1", "", 50*time.Millisecond)
+		assert.Equal(t, "retry: 3000\n\n", rec.Body.String())
+	})
+	t.Run("invalid", func(t *testing.T) {
+		rec := stream("/v1/schedule/stream?trainer_id=1", "latest", 50*time.Millisecond)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec = stream("/v1/schedule/stream", "", 50*time.Millisecond)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+}
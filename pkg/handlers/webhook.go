@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+)
+
+type (
+	// PostWebhookRequest adds a webhook, it is sent every event type when events is empty.
+	// A secret is generated when one isn't sent.
+	PostWebhookRequest struct {
+		URL    string   `json:"url" validate:"required,url"`
+		Events []string `json:"events"`
+		Secret string   `json:"secret"`
+	}
+
+	WebhookIDRequest struct {
+		ID int `param:"id" validate:"required"`
+	}
+
+	DeliveryIDRequest struct {
+		ID int `param:"id" validate:"required"`
+	}
+
+	// WebhookResponse is a webhook, the secret is only returned when the webhook is added
+	WebhookResponse struct {
+		ID        int                     `json:"id"`
+		URL       string                  `json:"url"`
+		Events    []appointment.EventType `json:"events"`
+		Secret    string                  `json:"secret,omitempty"`
+		CreatedAt time.Time               `json:"created_at"`
+	}
+)
+
+// MiddlewarePostWebhook is a middleware that binds and validates a new webhook
+func MiddlewarePostWebhook(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req PostWebhookRequest
+		if err := bindRequest(c, &req); err != nil {
+			return err
+		}
+
+		webhook := appointment.Webhook{URL: req.URL, Secret: req.Secret}
+		for _, eventType := range req.Events {
+			webhook.Events = append(webhook.Events, appointment.EventType(eventType))
+		}
+		SetWebhook(c, webhook)
+		return next(c)
+	}
+}
+
+// MiddlewareWebhookID is a middleware that takes the webhook ID from the path
+func MiddlewareWebhookID(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req WebhookIDRequest
+		if err := bindRequest(c, &req); err != nil {
+			return err
+		}
+
+		SetWebhook(c, appointment.Webhook{ID: req.ID})
+		return next(c)
+	}
+}
+
+// MiddlewareDeliveryID is a middleware that takes the delivery ID from the path
+func MiddlewareDeliveryID(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req DeliveryIDRequest
+		if err := bindRequest(c, &req); err != nil {
+			return err
+		}
+
+		SetDelivery(c, appointment.Delivery{ID: req.ID})
+		return next(c)
+	}
+}
+
+func SetWebhook(c echo.Context, webhook appointment.Webhook) {
+	c.Set(keyWebhook, webhook)
+}
+
+func GetWebhook(c echo.Context) appointment.Webhook {
+	return c.Get(keyWebhook).(appointment.Webhook)
+}
+
+func SetDelivery(c echo.Context, delivery appointment.Delivery) {
+	c.Set(keyDelivery, delivery)
+}
+
+func GetDelivery(c echo.Context) appointment.Delivery {
+	return c.Get(keyDelivery).(appointment.Delivery)
+}
+
+// handlePostWebhook adds the webhook and returns it with its secret, which isn't shown again
+func handlePostWebhook(c echo.Context, appManager appointment.Manager) error {
+	webhook := GetWebhook(c)
+	if webhook.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+
+	webhook, err := appManager.CreateWebhook(webhook)
+	if err != nil {
+		return managerProblem(err, "error adding webhook")
+	}
+	return c.JSON(http.StatusCreated, webhookResponse(webhook, true))
+}
+
+// handleGetWebhooks lists the tenant's webhooks without their secrets
+func handleGetWebhooks(c echo.Context, appManager appointment.Manager) error {
+	webhooks, err := appManager.GetWebhooks()
+	if err != nil {
+		return managerProblem(err, "error getting webhooks")
+	}
+
+	responses := make([]WebhookResponse, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		responses = append(responses, webhookResponse(webhook, false))
+	}
+	return c.JSON(http.StatusOK, responses)
+}
+
+// handleDeleteWebhook removes the webhook in the path, events it hasn't been sent yet are dropped
+func handleDeleteWebhook(c echo.Context, appManager appointment.Manager) error {
+	if err := appManager.DeleteWebhook(GetWebhook(c).ID); err != nil {
+		return managerProblem(err, "error deleting webhook")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// handleGetDeadLetters lists the deliveries that failed too many times to be retried
+func handleGetDeadLetters(c echo.Context, appManager appointment.Manager) error {
+	deliveries, err := appManager.GetDeadLetters()
+	if err != nil {
+		return managerProblem(err, "error getting dead letters")
+	}
+	if deliveries == nil {
+		deliveries = []appointment.Delivery{}
+	}
+	return c.JSON(http.StatusOK, deliveries)
+}
+
+// handlePostRetryDeadLetter sends the delivery in the path again, its retries start over
+func handlePostRetryDeadLetter(c echo.Context, appManager appointment.Manager) error {
+	if err := appManager.RetryDeadLetter(GetDelivery(c).ID); err != nil {
+		return managerProblem(err, "error retrying delivery")
+	}
+	return c.NoContent(http.StatusAccepted)
+}
+
+// webhookResponse converts the webhook for clients, the secret is left out unless withSecret is set
+func webhookResponse(webhook appointment.Webhook, withSecret bool) WebhookResponse {
+	resp := WebhookResponse{
+		ID:        webhook.ID,
+		URL:       webhook.URL,
+		Events:    webhook.Events,
+		CreatedAt: webhook.CreatedAt,
+	}
+	if resp.Events == nil {
+		resp.Events = []appointment.EventType{}
+	}
+	if withSecret {
+		resp.Secret = webhook.Secret
+	}
+	return resp
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookRoutes(t *testing.T) {
+	appManager := appointment.NewMockAppointmentManager(nil, nil)
+	appManager.DeadLetters = []appointment.Delivery{{ID: 3, WebhookID: 1, Attempts: 12, LastError: "webhook responded 500 Internal Server Error"}}
+	e := echo.New()
+	BuildRouter(e, appointment.NewSingleTenant(appManager), Config{AllowAnonymous: true})
+	serve := func(method string, target string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The secret is generated and only shown when the webhook is added
+	rec := serve(http.MethodPost, "/v1/webhooks", `{"url": "https://example.com/hook", "events": ["appointment.created"]}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created WebhookResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.Equal(t, []appointment.EventType{appointment.EventCreated}, created.Events)
+	assert.Len(t, created.Secret, 64)
+	assert.Equal(t, created.Secret, appManager.Webhooks[0].Secret)
+
+	rec = serve(http.MethodGet, "/v1/webhooks", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), created.Secret)
+	assert.Contains(t, rec.Body.String(), "https://example.com/hook")
+
+	rec = serve(http.MethodPost, "/v1/webhooks", `{"url": "not a url"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	// Deleting a webhook doesn't need If-Match like deleting an appointment does
+	rec = serve(http.MethodDelete, "/v1/webhooks/1", "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = serve(http.MethodDelete, "/v1/webhooks/1", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), CodeWebhookNotFound)
+
+	rec = serve(http.MethodGet, "/v1/webhooks/dead-letters", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "webhook responded 500 Internal Server Error")
+
+	rec = serve(http.MethodPost, "/v1/webhooks/dead-letters/3/retry", "")
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Empty(t, appManager.DeadLetters)
+	require.Len(t, appManager.Outbox, 1)
+	assert.Zero(t, appManager.Outbox[0].Attempts)
+
+	rec = serve(http.MethodPost, "/v1/webhooks/dead-letters/3/retry", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), CodeDeliveryNotFound)
+}
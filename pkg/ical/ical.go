@@ -0,0 +1,297 @@
+// Package ical reads and writes calendars in the iCalendar format (RFC 5545)
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MIMEType is the content type of an iCalendar file
+const MIMEType = "text/calendar"
+
+// Event statuses
+const (
+	StatusTentative = "TENTATIVE"
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+const (
+	// maxLineLength is the most octets a line can have before it is folded
+	maxLineLength = 75
+	dateTimeUTC   = "20060102T150405Z"
+	dateTimeLocal = "20060102T150405"
+)
+
+type (
+	// Calendar is a VCALENDAR of events
+	Calendar struct {
+		// ProdID names the product that made the calendar
+		ProdID string
+		// Name is shown by calendar apps that subscribe to the calendar
+		Name     string
+		Events   []Event
+		FreeBusy []FreeBusy
+	}
+
+	// Event is a VEVENT.
+	// Times in a time zone from the tz database are written with its TZID and the calendar gets a VTIMEZONE for it, other times are written in UTC.
+	Event struct {
+		// UID must stay the same for the event so calendar apps update it instead of adding a copy
+		UID   string
+		Start time.Time
+		End   time.Time
+		// Stamp is when the event last changed
+		Stamp time.Time
+		// Sequence goes up every time the event changes
+		Sequence    int
+		Summary     string
+		Description string
+		Location    string
+		Status      string
+
+		// These are read by Parse, Encode writes single events that don't need them
+		AllDay bool
+		// Transparent events don't make the calendar's owner busy
+		Transparent bool
+		Recurrence  *Recurrence
+		ExDates     []time.Time
+		// RecurrenceID is set on an override, it replaces the occurrence of the recurring event with the same UID that starts then
+		RecurrenceID time.Time
+	}
+
+	// FreeBusy is a VFREEBUSY, when someone is busy between Start and End without saying what they're doing.
+	// Its times are always written in UTC.
+	FreeBusy struct {
+		UID   string
+		Stamp time.Time
+		Start time.Time
+		End   time.Time
+		Busy  []Period
+	}
+)
+
+// Encode writes the calendar to w
+func (c Calendar) Encode(w io.Writer) error {
+	var b bytes.Buffer
+	line := func(name string, value string) {
+		writeLine(&b, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", c.ProdID)
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME", escapeText(c.Name))
+	}
+	for _, tz := range c.timeZones() {
+		tz.encode(line)
+	}
+	for _, event := range c.Events {
+		event.encode(line)
+	}
+	for _, fb := range c.FreeBusy {
+		fb.encode(line)
+	}
+	line("END", "VCALENDAR")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func (e Event) encode(line func(name string, value string)) {
+	line("BEGIN", "VEVENT")
+	line("UID", escapeText(e.UID))
+	line("DTSTAMP", e.Stamp.UTC().Format(dateTimeUTC))
+	line("LAST-MODIFIED", e.Stamp.UTC().Format(dateTimeUTC))
+	line(dateTime("DTSTART", e.Start))
+	line(dateTime("DTEND", e.End))
+	line("SEQUENCE", fmt.Sprint(e.Sequence))
+	if e.Summary != "" {
+		line("SUMMARY", escapeText(e.Summary))
+	}
+	if e.Description != "" {
+		line("DESCRIPTION", escapeText(e.Description))
+	}
+	if e.Location != "" {
+		line("LOCATION", escapeText(e.Location))
+	}
+	if e.Status != "" {
+		line("STATUS", e.Status)
+	}
+	line("END", "VEVENT")
+}
+
+func (fb FreeBusy) encode(line func(name string, value string)) {
+	line("BEGIN", "VFREEBUSY")
+	line("UID", escapeText(fb.UID))
+	line("DTSTAMP", fb.Stamp.UTC().Format(dateTimeUTC))
+	line("DTSTART", fb.Start.UTC().Format(dateTimeUTC))
+	line("DTEND", fb.End.UTC().Format(dateTimeUTC))
+	for _, busy := range fb.Busy {
+		line("FREEBUSY;FBTYPE=BUSY", busy.Start.UTC().Format(dateTimeUTC)+"/"+busy.End.UTC().Format(dateTimeUTC))
+	}
+	line("END", "VFREEBUSY")
+}
+
+// dateTime returns the property for t, in its time zone if it has a TZID and otherwise in UTC
+func dateTime(name string, t time.Time) (string, string) {
+	if tzid, ok := timeZoneID(t); ok {
+		return name + ";TZID=" + tzid, t.Format(dateTimeLocal)
+	}
+	return name, t.UTC().Format(dateTimeUTC)
+}
+
+// timeZoneID returns the tz database name of t's time zone, times in UTC or a fixed offset don't have one
+func timeZoneID(t time.Time) (string, bool) {
+	name := t.Location().String()
+	if name == "" || name == "UTC" || name == "Local" {
+		return "", false
+	}
+	return name, true
+}
+
+// escapeText escapes a TEXT value
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// writeLine writes a content line ending in CRLF, long lines are folded without splitting a character
+func writeLine(b *bytes.Buffer, line string) {
+	limit := maxLineLength
+	for len(line) > limit {
+		n := limit
+		for n > 0 && !utf8.RuneStart(line[n]) {
+			n--
+		}
+		b.WriteString(line[:n])
+		b.WriteString("\r\n ")
+		line = line[n:]
+		// The space that starts a folded line counts towards its length
+		limit = maxLineLength - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+type (
+	// timeZone is a VTIMEZONE with the offset changes between the first and last event in it
+	timeZone struct {
+		id          string
+		observances []observance
+	}
+
+	// observance is a STANDARD or DAYLIGHT period starting at onset
+	observance struct {
+		onset    time.Time
+		from, to int
+		name     string
+		daylight bool
+	}
+)
+
+// timeZones returns the time zones the events use sorted by TZID
+func (c Calendar) timeZones() []timeZone {
+	type span struct {
+		loc      *time.Location
+		from, to time.Time
+	}
+	spans := map[string]*span{}
+	for _, event := range c.Events {
+		for _, t := range []time.Time{event.Start, event.End} {
+			id, ok := timeZoneID(t)
+			if !ok {
+				continue
+			}
+			s, ok := spans[id]
+			if !ok {
+				spans[id] = &span{loc: t.Location(), from: t, to: t}
+				continue
+			}
+			if t.Before(s.from) {
+				s.from = t
+			}
+			if t.After(s.to) {
+				s.to = t
+			}
+		}
+	}
+
+	var zones []timeZone
+	for id, s := range spans {
+		zones = append(zones, timeZone{id: id, observances: observances(s.loc, s.from, s.to)})
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].id < zones[j].id })
+	return zones
+}
+
+// observances finds the offset changes of loc in the years from and to are in.
+// The first observance is the offset at the start of the first year so every event has one that applies.
+func observances(loc *time.Location, from time.Time, to time.Time) []observance {
+	start := time.Date(from.In(loc).Year(), time.January, 1, 0, 0, 0, 0, loc)
+	end := time.Date(to.In(loc).Year()+1, time.January, 1, 0, 0, 0, 0, loc)
+
+	name, offset := start.Zone()
+	first := observance{onset: time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC), from: offset, to: offset, name: name, daylight: start.IsDST()}
+	list := []observance{first}
+	for t := start; t.Before(end); t = t.Add(time.Hour) {
+		next := t.Add(time.Hour)
+		if _, nextOffset := next.Zone(); nextOffset == offset {
+			continue
+		}
+
+		// Narrow the change down to the second it happens
+		before, after := t, next
+		for after.Sub(before) > time.Second {
+			mid := before.Add(after.Sub(before) / 2)
+			if _, o := mid.Zone(); o == offset {
+				before = mid
+			} else {
+				after = mid
+			}
+		}
+		nextName, nextOffset := after.Zone()
+		// The onset is in the local time of the offset it changes from
+		onset := after.UTC().Add(time.Duration(offset) * time.Second)
+		list = append(list, observance{onset: onset, from: offset, to: nextOffset, name: nextName, daylight: after.IsDST()})
+		offset = nextOffset
+	}
+	return list
+}
+
+func (tz timeZone) encode(line func(name string, value string)) {
+	line("BEGIN", "VTIMEZONE")
+	line("TZID", tz.id)
+	for _, o := range tz.observances {
+		kind := "STANDARD"
+		if o.daylight {
+			kind = "DAYLIGHT"
+		}
+		line("BEGIN", kind)
+		line("DTSTART", o.onset.Format(dateTimeLocal))
+		line("TZOFFSETFROM", formatOffset(o.from))
+		line("TZOFFSETTO", formatOffset(o.to))
+		if o.name != "" {
+			line("TZNAME", escapeText(o.name))
+		}
+		line("END", kind)
+	}
+	line("END", "VTIMEZONE")
+}
+
+// formatOffset formats an offset in seconds east of UTC as +hhmm
+func formatOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset%3600/60)
+}
@@ -0,0 +1,80 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encode(t *testing.T, c Calendar) string {
+	var b bytes.Buffer
+	require.NoError(t, c.Encode(&b))
+	return b.String()
+}
+
+func TestEncode(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	require.NoError(t, err)
+	stamp := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	start := time.Date(2030, 3, 12, 9, 0, 0, 0, la)
+
+	out := encode(t, Calendar{ProdID: "-//test//EN", Name: "Trainer 1", Events: []Event{
+		{UID: "1@test", Start: start, End: start.Add(30 * time.Minute), Stamp: stamp, Sequence: 2, Summary: "Session, with user 5", Status: StatusConfirmed},
+		{UID: "2@test", Start: stamp, End: stamp.Add(30 * time.Minute), Stamp: stamp, Status: StatusCancelled},
+	}})
+
+	assert.True(t, strings.HasPrefix(out, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\n"))
+	assert.True(t, strings.HasSuffix(out, "END:VCALENDAR\r\n"))
+	assert.Contains(t, out, "\r\nDTSTART;TZID=America/Los_Angeles:20300312T090000\r\n")
+	assert.Contains(t, out, "\r\nDTEND;TZID=America/Los_Angeles:20300312T093000\r\n")
+	assert.Contains(t, out, "\r\nSUMMARY:Session\\, with user 5\r\n")
+	assert.Contains(t, out, "\r\nSEQUENCE:2\r\n")
+	// Times without a TZID are in UTC
+	assert.Contains(t, out, "\r\nDTSTART:20300101T120000Z\r\n")
+	assert.Contains(t, out, "\r\nSTATUS:CANCELLED\r\n")
+
+	// The time zone has the daylight saving changes in the year of the event
+	assert.Equal(t, 1, strings.Count(out, "BEGIN:VTIMEZONE"))
+	assert.Contains(t, out, "BEGIN:DAYLIGHT\r\nDTSTART:20300310T020000\r\nTZOFFSETFROM:-0800\r\nTZOFFSETTO:-0700\r\nTZNAME:PDT\r\nEND:DAYLIGHT")
+	assert.Contains(t, out, "BEGIN:STANDARD\r\nDTSTART:20301103T020000\r\nTZOFFSETFROM:-0700\r\nTZOFFSETTO:-0800\r\nTZNAME:PST\r\nEND:STANDARD")
+}
+
+func TestEncode_FreeBusy(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	require.NoError(t, err)
+	start := time.Date(2030, 3, 12, 9, 0, 0, 0, la)
+
+	out := encode(t, Calendar{ProdID: "-//test//EN", FreeBusy: []FreeBusy{{
+		UID:   "fb@test",
+		Stamp: start,
+		Start: start,
+		End:   start.Add(8 * time.Hour),
+		Busy:  []Period{{Start: start, End: start.Add(time.Hour)}},
+	}}})
+
+	// Free/busy is in UTC so it doesn't need a time zone
+	assert.NotContains(t, out, "BEGIN:VTIMEZONE")
+	assert.Contains(t, out, "BEGIN:VFREEBUSY\r\nUID:fb@test\r\nDTSTAMP:20300312T160000Z\r\nDTSTART:20300312T160000Z\r\nDTEND:20300313T000000Z\r\n")
+	assert.Contains(t, out, "\r\nFREEBUSY;FBTYPE=BUSY:20300312T160000Z/20300312T170000Z\r\nEND:VFREEBUSY\r\n")
+}
+
+func TestWriteLine_Folds(t *testing.T) {
+	var b bytes.Buffer
+	writeLine(&b, "DESCRIPTION:"+strings.Repeat("é", 100))
+
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n")
+	require.Greater(t, len(lines), 1)
+	unfolded := lines[0]
+	for i, line := range lines {
+		assert.LessOrEqual(t, len(line), maxLineLength)
+		if i > 0 {
+			require.True(t, strings.HasPrefix(line, " "))
+			unfolded += line[1:]
+		}
+	}
+	assert.Equal(t, "DESCRIPTION:"+strings.Repeat("é", 100), unfolded)
+}
@@ -0,0 +1,320 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dateValue = "20060102"
+
+// property is a content line split into its name, parameters and value
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Parse reads the events of a calendar.
+// An override of one occurrence of a recurring event is kept as its own event with the same UID,
+// the occurrence it replaces is added to the recurring event's ExDates so it isn't there twice.
+// Times without a time zone are in loc, or UTC if loc is nil, and all day events last from midnight to midnight in loc.
+// TZIDs must be tz database names, the VTIMEZONEs in the file aren't read.
+func Parse(r io.Reader, loc *time.Location) ([]Event, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		events []Event
+		event  *Event
+		// end and duration are kept until the event ends because they can come before DTSTART
+		end      *property
+		duration *property
+		// depth counts the components inside the event, like alarms, whose properties aren't the event's
+		depth int
+	)
+	for i, line := range lines {
+		p, err := parseProperty(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		switch {
+		case p.name == "BEGIN" && p.value == "VEVENT" && event == nil:
+			event, end, duration, depth = &Event{}, nil, nil, 0
+		case event == nil:
+			continue
+		case p.name == "BEGIN":
+			depth++
+		case p.name == "END" && depth > 0:
+			depth--
+		case p.name == "END" && p.value == "VEVENT":
+			if err := event.finish(end, duration, loc); err != nil {
+				return nil, fmt.Errorf("event %q: %w", event.UID, err)
+			}
+			events = append(events, *event)
+			event = nil
+		case depth > 0:
+			continue
+		case p.name == "DTEND":
+			end = &p
+		case p.name == "DURATION":
+			duration = &p
+		default:
+			if err := event.set(p, loc); err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+		}
+	}
+	if event != nil {
+		return nil, fmt.Errorf("event %q is not ended", event.UID)
+	}
+	excludeOverrides(events)
+	return events, nil
+}
+
+// excludeOverrides adds the occurrence each override replaces to the ExDates of the recurring event it belongs to
+func excludeOverrides(events []Event) {
+	for _, override := range events {
+		if override.RecurrenceID.IsZero() {
+			continue
+		}
+		for i := range events {
+			if events[i].UID == override.UID && events[i].RecurrenceID.IsZero() {
+				events[i].ExDates = append(events[i].ExDates, override.RecurrenceID)
+			}
+		}
+	}
+}
+
+// set sets the event property p
+func (e *Event) set(p property, loc *time.Location) error {
+	var err error
+	switch p.name {
+	case "UID":
+		e.UID = unescapeText(p.value)
+	case "SUMMARY":
+		e.Summary = unescapeText(p.value)
+	case "DESCRIPTION":
+		e.Description = unescapeText(p.value)
+	case "LOCATION":
+		e.Location = unescapeText(p.value)
+	case "STATUS":
+		e.Status = strings.ToUpper(p.value)
+	case "TRANSP":
+		e.Transparent = strings.EqualFold(p.value, "TRANSPARENT")
+	case "SEQUENCE":
+		e.Sequence, err = strconv.Atoi(p.value)
+	case "DTSTART":
+		e.Start, e.AllDay, err = parseTime(p, loc)
+	case "RECURRENCE-ID":
+		e.RecurrenceID, _, err = parseTime(p, loc)
+	case "RRULE":
+		e.Recurrence, err = parseRecurrence(p.value, loc)
+	case "EXDATE":
+		for _, value := range strings.Split(p.value, ",") {
+			var t time.Time
+			t, _, err = parseTime(property{name: p.name, params: p.params, value: value}, loc)
+			if err != nil {
+				break
+			}
+			e.ExDates = append(e.ExDates, t)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.name, err)
+	}
+	return nil
+}
+
+// finish works out when the event ends once all of its properties are read
+func (e *Event) finish(end *property, duration *property, loc *time.Location) error {
+	if e.Start.IsZero() {
+		return fmt.Errorf("DTSTART is required")
+	}
+
+	switch {
+	case end != nil:
+		t, _, err := parseTime(*end, loc)
+		if err != nil {
+			return fmt.Errorf("DTEND: %w", err)
+		}
+		e.End = t
+	case duration != nil:
+		d, err := parseDuration(duration.value)
+		if err != nil {
+			return fmt.Errorf("DURATION: %w", err)
+		}
+		e.End = e.Start.Add(d)
+	case e.AllDay:
+		e.End = e.Start.AddDate(0, 0, 1)
+	default:
+		e.End = e.Start
+	}
+
+	if e.End.Before(e.Start) {
+		return fmt.Errorf("ends before it starts")
+	}
+	if e.Recurrence != nil {
+		if err := e.Recurrence.check(e.Start); err != nil {
+			return fmt.Errorf("RRULE: %w", err)
+		}
+	}
+	if e.Recurrence != nil && !e.Recurrence.Until.IsZero() && e.AllDay {
+		// An all day UNTIL is a date, the last day still counts
+		e.Recurrence.Until = e.Recurrence.Until.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return nil
+}
+
+// unfold reads the content lines, joining lines that were folded
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// parseProperty splits a content line, the value starts at the first colon that isn't in a quoted parameter
+func parseProperty(line string) (property, error) {
+	quoted := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		}
+		if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return property{}, fmt.Errorf("%q is not a property", line)
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	p := property{name: strings.ToUpper(parts[0]), params: map[string]string{}, value: line[colon+1:]}
+	for _, param := range parts[1:] {
+		name, value, _ := strings.Cut(param, "=")
+		p.params[strings.ToUpper(name)] = strings.Trim(value, `"`)
+	}
+	return p, nil
+}
+
+// parseTime reads a DATE or DATE-TIME value, all day is true for dates
+func parseTime(p property, loc *time.Location) (time.Time, bool, error) {
+	if tzid := p.params["TZID"]; tzid != "" {
+		tz, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("unknown time zone %s", tzid)
+		}
+		loc = tz
+	}
+
+	value := strings.TrimSpace(p.value)
+	if p.params["VALUE"] == "DATE" || len(value) == len(dateValue) {
+		t, err := time.ParseInLocation(dateValue, value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(dateTimeUTC, value)
+		return t, false, err
+	}
+	t, err := time.ParseInLocation(dateTimeLocal, value, loc)
+	return t, false, err
+}
+
+// parseDuration reads a duration like PT1H30M or P1D, days and weeks are taken as 24 hours
+func parseDuration(s string) (time.Duration, error) {
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign, s = -1, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "P") {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	var d time.Duration
+	inTime := false
+	number := ""
+	parts := 0
+	for _, r := range s[1:] {
+		switch {
+		case r >= '0' && r <= '9':
+			number += string(r)
+			continue
+		case r == 'T':
+			inTime = true
+			continue
+		}
+
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		number = ""
+		parts++
+		switch {
+		case r == 'W' && !inTime:
+			d += time.Duration(n) * 7 * 24 * time.Hour
+		case r == 'D' && !inTime:
+			d += time.Duration(n) * 24 * time.Hour
+		case r == 'H' && inTime:
+			d += time.Duration(n) * time.Hour
+		case r == 'M' && inTime:
+			d += time.Duration(n) * time.Minute
+		case r == 'S' && inTime:
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+	}
+	if number != "" || parts == 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return sign * d, nil
+}
+
+// unescapeText reverses escapeText
+func unescapeText(s string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped && (r == 'n' || r == 'N'):
+			b.WriteRune('\n')
+		case escaped:
+			b.WriteRune(r)
+		case r == '\\':
+			escaped = true
+			continue
+		default:
+			b.WriteRune(r)
+		}
+		escaped = false
+	}
+	return b.String()
+}
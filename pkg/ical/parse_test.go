@@ -0,0 +1,261 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parse(t *testing.T, lines ...string) []Event {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	require.NoError(t, err)
+	events, err := Parse(strings.NewReader(strings.Join(lines, "\r\n")), la)
+	require.NoError(t, err)
+	return events
+}
+
+func TestParse(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	require.NoError(t, err)
+
+	t.Run("times", func(t *testing.T) {
+		events := parse(t,
+			"BEGIN:VCALENDAR",
+			"BEGIN:VEVENT",
+			"UID:utc@test",
+			"SUMMARY:Dentist\\, downtown",
+			"DTSTART:20300312T170000Z",
+			"DTEND:20300312T180000Z",
+			"END:VEVENT",
+			"BEGIN:VEVENT",
+			"UID:zone@test",
+			"DTSTART;TZID=America/New_York:20300312T090000",
+			"DURATION:PT1H30M",
+			"TRANSP:TRANSPARENT",
+			"END:VEVENT",
+			"BEGIN:VEVENT",
+			"UID:floating@test",
+			"DTEND:20300312T100000",
+			"DTSTART:20300312T090000",
+			"END:VEVENT",
+			"BEGIN:VEVENT",
+			"UID:all-day@test",
+			"DTSTART;VALUE=DATE:20300312",
+			"END:VEVENT",
+			"END:VCALENDAR",
+		)
+		require.Len(t, events, 4)
+
+		assert.Equal(t, "Dentist, downtown", events[0].Summary)
+		assert.True(t, events[0].Start.Equal(time.Date(2030, 3, 12, 17, 0, 0, 0, time.UTC)))
+		assert.Equal(t, time.Hour, events[0].End.Sub(events[0].Start))
+
+		assert.Equal(t, "America/New_York", events[1].Start.Location().String())
+		assert.Equal(t, 90*time.Minute, events[1].End.Sub(events[1].Start))
+		assert.True(t, events[1].Transparent)
+
+		// Times without a time zone are in the location given to Parse, DTEND can come first
+		assert.Equal(t, time.Date(2030, 3, 12, 9, 0, 0, 0, la), events[2].Start)
+		assert.Equal(t, time.Date(2030, 3, 12, 10, 0, 0, 0, la), events[2].End)
+
+		assert.True(t, events[3].AllDay)
+		assert.Equal(t, time.Date(2030, 3, 13, 0, 0, 0, 0, la), events[3].End)
+	})
+	t.Run("folded lines and alarms", func(t *testing.T) {
+		events := parse(t,
+			"BEGIN:VEVENT",
+			"UID:folded@test",
+			"DESCRIPTION:a long",
+			"  description",
+			"DTSTART:20300312T170000Z",
+			"BEGIN:VALARM",
+			"DESCRIPTION:Reminder",
+			"END:VALARM",
+			"END:VEVENT",
+		)
+		require.Len(t, events, 1)
+		assert.Equal(t, "a long description", events[0].Description)
+	})
+	t.Run("overridden occurrence", func(t *testing.T) {
+		events := parse(t,
+			"BEGIN:VEVENT",
+			"UID:standup@test",
+			"DTSTART:20300311T090000",
+			"DTEND:20300311T093000",
+			"RRULE:FREQ=DAILY;COUNT=3",
+			"END:VEVENT",
+			"BEGIN:VEVENT",
+			"UID:standup@test",
+			"RECURRENCE-ID:20300312T090000",
+			"DTSTART:20300312T140000",
+			"DTEND:20300312T143000",
+			"END:VEVENT",
+			"END:VCALENDAR",
+		)
+		require.Len(t, events, 2)
+		assert.Equal(t, "standup@test", events[1].UID)
+		assert.Equal(t, time.Date(2030, 3, 12, 9, 0, 0, 0, la), events[1].RecurrenceID)
+
+		// The moved occurrence comes from the override rather than the rule
+		var starts []time.Time
+		for _, event := range events {
+			for _, period := range event.Occurrences(time.Time{}, time.Date(2031, 1, 1, 0, 0, 0, 0, la), 100) {
+				starts = append(starts, period.Start)
+			}
+		}
+		assert.Equal(t, []time.Time{
+			time.Date(2030, 3, 11, 9, 0, 0, 0, la),
+			time.Date(2030, 3, 13, 9, 0, 0, 0, la),
+			time.Date(2030, 3, 12, 14, 0, 0, 0, la),
+		}, starts)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		for name, body := range map[string]string{
+			"no start":          "BEGIN:VEVENT\r\nUID:1\r\nEND:VEVENT",
+			"not ended":         "BEGIN:VEVENT\r\nDTSTART:20300312T170000Z",
+			"unknown time zone": "BEGIN:VEVENT\r\nDTSTART;TZID=Nowhere:20300312T090000\r\nEND:VEVENT",
+			"ends before start": "BEGIN:VEVENT\r\nDTSTART:20300312T170000Z\r\nDTEND:20300312T160000Z\r\nEND:VEVENT",
+			"unsupported rule":  "BEGIN:VEVENT\r\nDTSTART:20300312T170000Z\r\nRRULE:FREQ=MONTHLY;BYDAY=1MO\r\nEND:VEVENT",
+			"not a property":    "BEGIN:VEVENT\r\nDTSTART\r\nEND:VEVENT",
+			"never happens":     "BEGIN:VEVENT\r\nDTSTART:20261019T090000Z\r\nRRULE:FREQ=DAILY;INTERVAL=7;BYDAY=TU\r\nEND:VEVENT",
+		} {
+			_, err := Parse(strings.NewReader(body), nil)
+			assert.Error(t, err, name)
+		}
+	})
+}
+
+func TestOccurrences(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	require.NoError(t, err)
+	until := time.Date(2031, 1, 1, 0, 0, 0, 0, la)
+	starts := func(periods []Period) []string {
+		var s []string
+		for _, p := range periods {
+			s = append(s, p.Start.Format("Mon 2006-01-02 15:04 MST"))
+		}
+		return s
+	}
+
+	t.Run("weekly on days with an excluded date", func(t *testing.T) {
+		events := parse(t,
+			"BEGIN:VEVENT",
+			"DTSTART;TZID=America/Los_Angeles:20300304T090000",
+			"DTEND;TZID=America/Los_Angeles:20300304T100000",
+			"RRULE:FREQ=WEEKLY;BYDAY=MO,WE;COUNT=5",
+			"EXDATE;TZID=America/Los_Angeles:20300311T090000",
+			"END:VEVENT",
+		)
+		require.Len(t, events, 1)
+		periods := events[0].Occurrences(time.Time{}, until, 100)
+		// The clock time stays the same across the change to daylight saving on March 10th
+		assert.Equal(t, []string{
+			"Mon 2030-03-04 09:00 PST",
+			"Wed 2030-03-06 09:00 PST",
+			"Wed 2030-03-13 09:00 PDT",
+			"Mon 2030-03-18 09:00 PDT",
+		}, starts(periods))
+		assert.Equal(t, time.Hour, periods[0].End.Sub(periods[0].Start))
+	})
+	t.Run("daily on weekdays until a date", func(t *testing.T) {
+		events := parse(t,
+			"BEGIN:VEVENT",
+			"DTSTART:20300301T090000",
+			"RRULE:FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR;UNTIL=20300306T090000",
+			"END:VEVENT",
+		)
+		assert.Equal(t, []string{
+			"Fri 2030-03-01 09:00 PST",
+			"Mon 2030-03-04 09:00 PST",
+			"Tue 2030-03-05 09:00 PST",
+			"Wed 2030-03-06 09:00 PST",
+		}, starts(events[0].Occurrences(time.Time{}, until, 100)))
+	})
+	t.Run("monthly skips short months", func(t *testing.T) {
+		events := parse(t,
+			"BEGIN:VEVENT",
+			"DTSTART:20300131T090000",
+			"RRULE:FREQ=MONTHLY;COUNT=3",
+			"END:VEVENT",
+		)
+		assert.Equal(t, []string{
+			"Thu 2030-01-31 09:00 PST",
+			"Sun 2030-03-31 09:00 PDT",
+			"Fri 2030-05-31 09:00 PDT",
+		}, starts(events[0].Occurrences(time.Time{}, until, 100)))
+	})
+	t.Run("skipped dates stop at until", func(t *testing.T) {
+		// Every other day from a Monday is only on Tuesdays every other week
+		events := parse(t,
+			"BEGIN:VEVENT",
+			"DTSTART:20261019T090000",
+			"RRULE:FREQ=DAILY;INTERVAL=2;BYDAY=TU",
+			"END:VEVENT",
+		)
+		assert.Equal(t, []string{
+			"Tue 2026-10-27 09:00 PDT",
+			"Tue 2026-11-10 09:00 PST",
+		}, starts(events[0].Occurrences(time.Time{}, time.Date(2026, 11, 20, 0, 0, 0, 0, la), 100)))
+
+		// A rule that never happens ends at until instead of looking forever
+		r := &Recurrence{Freq: FreqDaily, Interval: 7, ByDay: []time.Weekday{time.Tuesday}}
+		event := Event{Start: time.Date(2026, 10, 19, 9, 0, 0, 0, la), Recurrence: r}
+		event.End = event.Start
+		assert.Empty(t, event.Occurrences(time.Time{}, until, 100))
+		r = &Recurrence{Freq: FreqYearly, Interval: 100}
+		event = Event{Start: time.Date(2028, 2, 29, 9, 0, 0, 0, la), End: time.Date(2028, 2, 29, 10, 0, 0, 0, la), Recurrence: r}
+		assert.Len(t, event.Occurrences(time.Time{}, until, 100), 1)
+	})
+	t.Run("stops at until without a limit", func(t *testing.T) {
+		events := parse(t,
+			"BEGIN:VEVENT",
+			"DTSTART;VALUE=DATE:20300101",
+			"RRULE:FREQ=WEEKLY;INTERVAL=2",
+			"END:VEVENT",
+		)
+		periods := events[0].Occurrences(time.Time{}, time.Date(2030, 2, 1, 0, 0, 0, 0, la), 100)
+		assert.Len(t, periods, 3)
+		assert.Equal(t, 24*time.Hour, periods[0].End.Sub(periods[0].Start))
+	})
+	t.Run("from a time with a limit", func(t *testing.T) {
+		events := parse(t,
+			"BEGIN:VEVENT",
+			"DTSTART:20300301T090000",
+			"DURATION:PT30M",
+			"RRULE:FREQ=DAILY;COUNT=10",
+			"END:VEVENT",
+		)
+		// The occurrence in progress at from is kept and the ones before it still count towards COUNT
+		from := time.Date(2030, 3, 5, 9, 15, 0, 0, la)
+		assert.Equal(t, []string{
+			"Tue 2030-03-05 09:00 PST",
+			"Wed 2030-03-06 09:00 PST",
+			"Thu 2030-03-07 09:00 PST",
+			"Fri 2030-03-08 09:00 PST",
+			"Sat 2030-03-09 09:00 PST",
+			"Sun 2030-03-10 09:00 PDT",
+		}, starts(events[0].Occurrences(from, until, 100)))
+		assert.Len(t, events[0].Occurrences(from, until, 2), 2)
+	})
+}
+
+func TestParseDuration(t *testing.T) {
+	for s, want := range map[string]time.Duration{
+		"PT1H30M": 90 * time.Minute,
+		"P1D":     24 * time.Hour,
+		"P1W":     7 * 24 * time.Hour,
+		"-PT15M":  -15 * time.Minute,
+		"P1DT2H":  26 * time.Hour,
+	} {
+		d, err := parseDuration(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, d, s)
+	}
+	for _, s := range []string{"1H", "PT1X", "PT", "PT1H2"} {
+		_, err := parseDuration(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -0,0 +1,227 @@
+package ical
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence frequencies
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+	FreqYearly  = "YEARLY"
+)
+
+type (
+	// Recurrence is an RRULE.
+	// Only the parts calendar apps use for busy time are supported: FREQ, INTERVAL, COUNT, UNTIL, WKST and BYDAY without ordinals on daily and weekly rules.
+	Recurrence struct {
+		Freq     string
+		Interval int
+		// Count is how many times the event happens including the dates that are excluded, zero means no limit
+		Count int
+		// Until is the last time the event can start, zero means no limit
+		Until     time.Time
+		ByDay     []time.Weekday
+		WeekStart time.Weekday
+	}
+
+	// Period is one occurrence of an event
+	Period struct {
+		Start time.Time
+		End   time.Time
+	}
+)
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// parseRecurrence reads an RRULE value, parts that aren't supported are an error so the occurrences aren't silently wrong
+func parseRecurrence(value string, loc *time.Location) (*Recurrence, error) {
+	r := &Recurrence{Interval: 1, WeekStart: time.Monday}
+	for _, part := range strings.Split(value, ";") {
+		name, v, _ := strings.Cut(part, "=")
+		var err error
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			r.Freq = strings.ToUpper(v)
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(v)
+			if err == nil && r.Interval < 1 {
+				err = fmt.Errorf("INTERVAL must be at least 1")
+			}
+		case "COUNT":
+			r.Count, err = strconv.Atoi(v)
+		case "UNTIL":
+			r.Until, _, err = parseTime(property{value: v}, loc)
+		case "WKST":
+			day, ok := weekdays[strings.ToUpper(v)]
+			if !ok {
+				err = fmt.Errorf("unknown weekday %s", v)
+			}
+			r.WeekStart = day
+		case "BYDAY":
+			for _, d := range strings.Split(v, ",") {
+				day, ok := weekdays[strings.ToUpper(d)]
+				if !ok {
+					return nil, fmt.Errorf("unsupported BYDAY %s", d)
+				}
+				r.ByDay = append(r.ByDay, day)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported RRULE part %s", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	switch r.Freq {
+	case FreqDaily, FreqWeekly:
+	case FreqMonthly, FreqYearly:
+		if len(r.ByDay) > 0 {
+			return nil, fmt.Errorf("unsupported BYDAY on a %s rule", strings.ToLower(r.Freq))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported FREQ %q", r.Freq)
+	}
+	return r, nil
+}
+
+// Occurrences returns up to limit occurrences of the event that end after from and start before until, without the excluded dates.
+// Occurrences before from still count towards the rule's COUNT.
+// Recurring events keep their wall clock time in their time zone so they don't move when daylight saving changes.
+func (e Event) Occurrences(from time.Time, until time.Time, limit int) []Period {
+	duration := e.End.Sub(e.Start)
+	if e.Recurrence == nil {
+		if !e.Start.Before(until) || !e.End.After(from) || limit < 1 {
+			return nil
+		}
+		return []Period{{Start: e.Start, End: e.End}}
+	}
+
+	r := e.Recurrence
+	var periods []Period
+	count := 0
+	r.starts(e.Start, until, func(start time.Time) bool {
+		if (r.Count > 0 && count >= r.Count) || len(periods) >= limit {
+			return false
+		}
+		count++
+		if end := start.Add(duration); end.After(from) && !e.excluded(start) {
+			periods = append(periods, Period{Start: start, End: end})
+		}
+		return true
+	})
+	return periods
+}
+
+// starts calls yield with each start time of the rule before until in order until it returns false.
+// The limits are checked on dates the rule skips too, so a rule that skips every date still ends.
+func (r *Recurrence) starts(first time.Time, until time.Time, yield func(time.Time) bool) {
+	y, m, d := first.Date()
+	hour, min, sec := first.Clock()
+	loc := first.Location()
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, hour, min, sec, first.Nanosecond(), loc)
+	}
+
+	switch r.Freq {
+	case FreqDaily:
+		for n := 0; ; n += r.Interval {
+			t := at(y, m, d+n)
+			if r.ended(t, until) {
+				return
+			}
+			if len(r.ByDay) > 0 && !r.onDay(t.Weekday()) {
+				continue
+			}
+			if !yield(t) {
+				return
+			}
+		}
+	case FreqWeekly:
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []time.Weekday{first.Weekday()}
+		}
+		// Days are ordered from the start of the week
+		offsets := make([]int, 0, len(days))
+		for _, day := range days {
+			offsets = append(offsets, (int(day)-int(r.WeekStart)+7)%7)
+		}
+		sort.Ints(offsets)
+
+		weekStart := d - (int(first.Weekday())-int(r.WeekStart)+7)%7
+		for week := 0; ; week += r.Interval {
+			for _, offset := range offsets {
+				t := at(y, m, weekStart+week*7+offset)
+				if t.Before(first) {
+					continue
+				}
+				if r.ended(t, until) || !yield(t) {
+					return
+				}
+			}
+		}
+	case FreqMonthly, FreqYearly:
+		for n := 0; ; n += r.Interval {
+			t := at(y, m+time.Month(n), d)
+			if r.Freq == FreqYearly {
+				t = at(y+n, m, d)
+			}
+			if r.ended(t, until) {
+				return
+			}
+			// Months without the day, like the 31st, are skipped
+			if t.Day() != d {
+				continue
+			}
+			if !yield(t) {
+				return
+			}
+		}
+	}
+}
+
+// ended reports whether start is after the rule's UNTIL or not before until
+func (r *Recurrence) ended(start time.Time, until time.Time) bool {
+	return (!r.Until.IsZero() && start.After(r.Until)) || !start.Before(until)
+}
+
+// check rejects a rule that can never happen from first, like a daily rule every 7 days on a weekday other than first's
+func (r *Recurrence) check(first time.Time) error {
+	if r.Freq == FreqDaily && len(r.ByDay) > 0 && r.Interval%7 == 0 && !r.onDay(first.Weekday()) {
+		return fmt.Errorf("BYDAY never matches a daily rule every %d days from a %s", r.Interval, first.Weekday())
+	}
+	return nil
+}
+
+// onDay reports whether the rule's BYDAY has the weekday
+func (r *Recurrence) onDay(day time.Weekday) bool {
+	for _, d := range r.ByDay {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// excluded reports whether the occurrence starting at start is in EXDATE
+func (e Event) excluded(start time.Time) bool {
+	for _, exdate := range e.ExDates {
+		if exdate.Equal(start) {
+			return true
+		}
+		// An excluded date excludes an all day occurrence on that day
+		if e.AllDay && exdate.Year() == start.Year() && exdate.YearDay() == start.YearDay() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package notification
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+)
+
+// Confirmer sends clients a booking confirmation when an appointment is booked confirmed or a request is accepted
+type Confirmer struct {
+	tenants     *appointment.Tenants
+	notifier    Notifier
+	unsubscribe []func()
+}
+
+// NewConfirmer returns a confirmer that sends confirmations through the notifier
+func NewConfirmer(tenants *appointment.Tenants, notifier Notifier) *Confirmer {
+	return &Confirmer{tenants: tenants, notifier: notifier}
+}
+
+// Start follows each tenant's appointment events
+func (c *Confirmer) Start() error {
+	for _, tenantID := range c.tenants.IDs() {
+		manager, err := c.tenants.Manager(tenantID)
+		if err != nil {
+			return err
+		}
+
+		tenantID := tenantID
+		c.unsubscribe = append(c.unsubscribe, manager.SubscribeAsync(func(event appointment.DomainEvent) {
+			c.handle(tenantID, manager, event)
+		}, 1))
+	}
+	return nil
+}
+
+// Stop stops following the tenants' events
+func (c *Confirmer) Stop() {
+	for _, unsubscribe := range c.unsubscribe {
+		unsubscribe()
+	}
+	c.unsubscribe = nil
+}
+
+// handle sends a confirmation for events that confirm a booking
+func (c *Confirmer) handle(tenantID string, manager appointment.Manager, event appointment.DomainEvent) {
+	app := event.Base().Appointment
+	switch event.(type) {
+	case appointment.AppointmentCreated, appointment.AppointmentStatusChanged:
+		if app.Status != appointment.StatusConfirmed {
+			return
+		}
+	default:
+		return
+	}
+
+	n, err := Compose(tenantID, manager, TypeConfirmation, app, 0)
+	if err == nil {
+		err = c.notifier.Notify(context.Background(), n)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("tenant", tenantID).Int("appointment", app.ID).Msg("error sending booking confirmation")
+	}
+}
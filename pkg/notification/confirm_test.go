@@ -0,0 +1,63 @@
+package notification
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+)
+
+// recordingNotifier keeps the notifications it is sent
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent []Notification
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, notification Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, notification)
+	return nil
+}
+
+func (n *recordingNotifier) count() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.sent)
+}
+
+func TestConfirmer(t *testing.T) {
+	manager := appointment.NewMockAppointmentManager(nil, nil)
+	manager.Users = []appointment.User{{ID: 5, Name: "Sam", Email: "sam@example.com", Locale: "es"}}
+	notifier := &recordingNotifier{}
+	c := NewConfirmer(appointment.NewSingleTenant(manager), notifier)
+	require.NoError(t, c.Start())
+	defer c.Stop()
+
+	start := time.Date(2030, 1, 9, 18, 30, 0, 0, time.UTC)
+	pending := appointment.Appointment{ID: 1, TrainerID: 2, UserID: 5, StartTime: start, Status: appointment.StatusPending, SessionType: "standard"}
+	confirmed := pending
+	confirmed.Status = appointment.StatusConfirmed
+	booked := appointment.Appointment{ID: 2, TrainerID: 2, UserID: 6, StartTime: start.Add(time.Hour), Status: appointment.StatusConfirmed, SessionType: "standard"}
+
+	manager.Publish(appointment.AppointmentCreated{Event: appointment.Event{ID: 1, Appointment: pending}})
+	manager.Publish(appointment.AppointmentStatusChanged{Event: appointment.Event{ID: 2, Appointment: confirmed}, From: appointment.StatusPending})
+	manager.Publish(appointment.AppointmentRescheduled{Event: appointment.Event{ID: 3, Appointment: confirmed}, Previous: confirmed})
+	manager.Publish(appointment.AppointmentCreated{Event: appointment.Event{ID: 4, Appointment: booked}})
+	require.Eventually(t, func() bool { return notifier.count() == 2 }, time.Second, time.Millisecond)
+
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	accepted, created := notifier.sent[0], notifier.sent[1]
+	assert.Equal(t, TypeConfirmation, accepted.Type)
+	assert.Equal(t, confirmed, accepted.Appointment)
+	assert.Equal(t, "Tu sesión del mié 9 ene a las 18:30 está reservada", accepted.Message.Subject)
+	// Users that aren't in users.json only have their ID and get the default locale
+	assert.Equal(t, appointment.User{ID: 6}, created.User)
+	assert.Equal(t, "en", created.Message.Locale)
+}
@@ -0,0 +1,93 @@
+// Package notification writes the messages sent to clients about their appointments from templates
+// in their locale, and sends them through a Notifier
+package notification
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+)
+
+type (
+	// Notification is a message to an appointment's client
+	Notification struct {
+		Type        Type
+		TenantID    string
+		Appointment appointment.Appointment
+		// User is the client, only the ID is set for users that aren't in users.json
+		User appointment.User
+		// Location is the trainer's location, the appointment is shown in its time zone
+		Location appointment.Location
+		// Before is how long before the appointment a reminder is for
+		Before  time.Duration
+		Message Message
+	}
+
+	// Notifier sends notifications
+	Notifier interface {
+		Notify(ctx context.Context, n Notification) error
+	}
+)
+
+// Compose writes the notification of the appointment for its client in their locale with the tenant's templates
+func Compose(tenantID string, manager appointment.Manager, typ Type, app appointment.Appointment, before time.Duration) (Notification, error) {
+	user, err := manager.GetUser(app.UserID)
+	if errors.Is(err, appointment.ErrUserNotFound) {
+		user = appointment.User{ID: app.UserID}
+	} else if err != nil {
+		return Notification{}, err
+	}
+	location, err := manager.GetBookingLocation(app.TrainerID, 0)
+	if err != nil {
+		return Notification{}, err
+	}
+	templates, err := manager.GetMessageTemplates()
+	if err != nil {
+		return Notification{}, err
+	}
+
+	msg, err := Render(templates, typ, Data{Locale: user.Locale, Appointment: app, User: user, Location: location, Before: before})
+	if err != nil {
+		return Notification{}, err
+	}
+	return Notification{
+		Type:        typ,
+		TenantID:    tenantID,
+		Appointment: app,
+		User:        user,
+		Location:    location,
+		Before:      before,
+		Message:     msg,
+	}, nil
+}
+
+// Sample is made up data to preview templates with, an appointment tomorrow at 9am in the location
+func Sample(typ Type, locale string, location appointment.Location, now time.Time) Data {
+	if zone := location.Zone(); zone != nil {
+		now = now.In(zone)
+	}
+	start := time.Date(now.Year(), now.Month(), now.Day()+1, 9, 0, 0, 0, now.Location())
+
+	data := Data{
+		Locale: locale,
+		Appointment: appointment.Appointment{
+			ID:          1,
+			TrainerID:   1,
+			UserID:      1,
+			LocationID:  location.ID,
+			StartTime:   start,
+			EndTime:     start.Add(appointment.AppointmentDuration),
+			SessionType: appointment.DefaultSessionType,
+			Status:      appointment.StatusConfirmed,
+			Version:     1,
+		},
+		User:     appointment.User{ID: 1, Name: "Alex", Email: "alex@example.com", Locale: locale},
+		Location: location,
+	}
+	if typ == TypeReminder {
+		data.Before = 24 * time.Hour
+	}
+	return data
+}
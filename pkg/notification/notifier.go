@@ -0,0 +1,155 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+type (
+	// LogNotifier writes notifications to the log instead of sending them, for development and deployments without email
+	LogNotifier struct{}
+
+	// SMTPNotifier emails notifications to users through an SMTP server
+	SMTPNotifier struct {
+		// Addr is the server's host:port
+		Addr string
+		From string
+		// Auth is nil for servers that don't need a login
+		Auth smtp.Auth
+	}
+)
+
+// Notify logs the notification
+func (LogNotifier) Notify(ctx context.Context, n Notification) error {
+	log.Info().
+		Str("tenant", n.TenantID).
+		Str("type", string(n.Type)).
+		Int("appointment", n.Appointment.ID).
+		Int("user", n.User.ID).
+		Str("locale", n.Message.Locale).
+		Dur("before", n.Before).
+		Msg(n.Message.Subject)
+	return nil
+}
+
+// Notify emails the notification to the user, users without an email address can't be notified.
+// The message has the text and the HTML as alternatives so mail clients show whichever they can.
+// Sending stops when ctx is done so a server that stops responding doesn't hold up the caller.
+func (s SMTPNotifier) Notify(ctx context.Context, n Notification) error {
+	if n.User.Email == "" {
+		return fmt.Errorf("user %d has no email address", n.User.ID)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", n.User.Email)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", n.Message.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+
+	body := multipart.NewWriter(&msg)
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", body.Boundary())
+	if err := writePart(body, "text/plain", n.Message.Text); err != nil {
+		return err
+	}
+	if n.Message.HTML != "" {
+		if err := writePart(body, "text/html", n.Message.HTML); err != nil {
+			return err
+		}
+	}
+	if err := body.Close(); err != nil {
+		return err
+	}
+
+	if err := s.send(ctx, n.User.Email, msg.Bytes()); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return fmt.Errorf("error emailing user %d: %w", n.User.ID, err)
+	}
+	return nil
+}
+
+// send is smtp.SendMail on a connection that gives up when ctx is done
+func (s SMTPNotifier) send(ctx context.Context, to string, msg []byte) error {
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// A context cancelled before its deadline unblocks whatever is waiting on the server
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.Auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(s.Auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// writePart adds a quoted-printable utf-8 part so accented wording survives servers that only take 7 bit mail
+func writePart(body *multipart.Writer, mediaType string, content string) error {
+	part, err := body.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mediaType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write([]byte(content)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
@@ -0,0 +1,169 @@
+package notification
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+)
+
+// receivedMail is a message the fake SMTP server received
+type receivedMail struct {
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTPServer accepts mail on a local port and sends each message it receives on the channel
+func fakeSMTPServer(t *testing.T) (string, <-chan receivedMail) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan receivedMail, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, received)
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func serveSMTP(conn net.Conn, received chan<- receivedMail) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost fake smtp")
+
+	var m receivedMail
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO", "HELO":
+			text.PrintfLine("250 localhost")
+		case "MAIL":
+			m = receivedMail{from: strings.TrimSuffix(strings.TrimPrefix(line, "MAIL FROM:<"), ">")}
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			m.to = append(m.to, strings.TrimSuffix(strings.TrimPrefix(line, "RCPT TO:<"), ">"))
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 send the message")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			m.data = string(data)
+			received <- m
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("250 OK")
+		}
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, received := fakeSMTPServer(t)
+	start := time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC)
+	n := Notification{
+		Type:        TypeReminder,
+		TenantID:    appointment.DefaultTenantID,
+		Appointment: appointment.Appointment{ID: 4, TrainerID: 2, UserID: 5, StartTime: start, SessionType: "standard"},
+		User:        appointment.User{ID: 5, Name: "Sam", Email: "sam@example.com", Locale: "es"},
+		Before:      time.Hour,
+		Message: Message{
+			Locale:  "es",
+			Subject: "Recordatorio: tu sesión del lun 7 ene a las 09:00",
+			Text:    "Hola Sam, te recordamos tu sesión.",
+			HTML:    "<p>Hola Sam, te recordamos tu sesión.</p>",
+		},
+	}
+
+	notifier := SMTPNotifier{Addr: addr, From: "gym@example.com"}
+	require.NoError(t, notifier.Notify(context.Background(), n))
+
+	select {
+	case m := <-received:
+		assert.Equal(t, "gym@example.com", m.from)
+		assert.Equal(t, []string{"sam@example.com"}, m.to)
+
+		msg, err := mail.ReadMessage(strings.NewReader(m.data))
+		require.NoError(t, err)
+		subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+		require.NoError(t, err)
+		assert.Equal(t, n.Message.Subject, subject)
+
+		mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		require.Equal(t, "multipart/alternative", mediaType)
+		parts := multipart.NewReader(msg.Body, params["boundary"])
+		for _, want := range []struct{ contentType, body string }{
+			{"text/plain; charset=utf-8", n.Message.Text},
+			{"text/html; charset=utf-8", n.Message.HTML},
+		} {
+			part, err := parts.NextPart()
+			require.NoError(t, err)
+			assert.Equal(t, want.contentType, part.Header.Get("Content-Type"))
+			// The multipart reader decodes quoted-printable parts itself
+			body, err := io.ReadAll(part)
+			require.NoError(t, err)
+			assert.Equal(t, want.body, string(body))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no mail was received")
+	}
+
+	n.User.Email = ""
+	assert.EqualError(t, notifier.Notify(context.Background(), n), "user 5 has no email address")
+}
+
+func TestSMTPNotifier_Cancelled(t *testing.T) {
+	// The server accepts the connection and never says anything
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	n := Notification{User: appointment.User{ID: 5, Email: "sam@example.com"}, Message: Message{Subject: "Reminder"}}
+	notifier := SMTPNotifier{Addr: listener.Addr().String(), From: "gym@example.com"}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	done := make(chan error, 1)
+	go func() { done <- notifier.Notify(ctx, n) }()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Notify didn't return when the context was cancelled")
+	}
+}
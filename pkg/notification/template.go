@@ -0,0 +1,235 @@
+package notification
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+)
+
+// DefaultLocale is used when a user has no locale or there is no wording in theirs
+const DefaultLocale = "en"
+
+// Types of notification that are sent to clients
+const (
+	TypeConfirmation Type = "booking_confirmation"
+	TypeReminder     Type = "reminder"
+)
+
+type (
+	// Type is a kind of notification, each has its own templates
+	Type string
+
+	// Message is a rendered notification
+	Message struct {
+		// Locale is the one the message was written in, which falls back from the one asked for when there is no wording in it
+		Locale  string `json:"locale"`
+		Subject string `json:"subject"`
+		Text    string `json:"text"`
+		HTML    string `json:"html"`
+	}
+
+	// Data is what the templates are executed with. Times are in the appointment's location and
+	// written the way the locale writes them, so templates should use Date, ShortDate and Time
+	// rather than formatting Appointment.StartTime themselves.
+	Data struct {
+		Locale      string
+		Appointment appointment.Appointment
+		User        appointment.User
+		Location    appointment.Location
+		// Before is how long before the appointment a reminder is sent, zero for other notifications
+		Before time.Duration
+	}
+)
+
+//go:embed templates
+var builtinFiles embed.FS
+
+// builtin is the wording used for the parts a gym hasn't written its own templates for
+var builtin = loadBuiltin()
+
+// loadBuiltin reads the embedded templates, templates/<locale>/<type>.subject.txt, .txt and .html
+func loadBuiltin() appointment.MessageTemplates {
+	templates := appointment.MessageTemplates{}
+	err := fs.WalkDir(builtinFiles, "templates", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := builtinFiles.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		parts := strings.Split(path, "/")
+		locale, name := parts[1], parts[2]
+		if templates[locale] == nil {
+			templates[locale] = map[string]appointment.MessageTemplate{}
+		}
+		typ := name[:strings.Index(name, ".")]
+		msg := templates[locale][typ]
+		switch strings.TrimPrefix(name, typ) {
+		case ".subject.txt":
+			msg.Subject = string(b)
+		case ".txt":
+			msg.Text = string(b)
+		case ".html":
+			msg.HTML = string(b)
+		default:
+			return fmt.Errorf("unexpected template %s", path)
+		}
+		templates[locale][typ] = msg
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	return templates
+}
+
+// Types returns every notification type
+func Types() []Type {
+	return []Type{TypeConfirmation, TypeReminder}
+}
+
+// Render writes the notification in data.Locale using the gym's templates, falling back to the built in wording.
+// The locale falls back from a regional one like es-MX to its language and then to English, and a part
+// the gym hasn't written, like the HTML, uses the built in wording for the locale.
+func Render(templates appointment.MessageTemplates, typ Type, data Data) (Message, error) {
+	if _, ok := builtin[DefaultLocale][string(typ)]; !ok {
+		return Message{}, fmt.Errorf("unknown notification type %s", typ)
+	}
+
+	data.Locale = resolveLocale(templates, typ, data.Locale)
+	gym := templates[data.Locale][string(typ)]
+	part := func(own string, get func(appointment.MessageTemplate) string) string {
+		if own != "" {
+			return own
+		}
+		// A regional override like es-mx uses the language's wording for the rest
+		for _, locale := range []string{data.Locale, data.language()} {
+			if s := get(builtin[locale][string(typ)]); s != "" {
+				return s
+			}
+		}
+		return get(builtin[DefaultLocale][string(typ)])
+	}
+	subject := part(gym.Subject, func(t appointment.MessageTemplate) string { return t.Subject })
+	text := part(gym.Text, func(t appointment.MessageTemplate) string { return t.Text })
+	html := part(gym.HTML, func(t appointment.MessageTemplate) string { return t.HTML })
+
+	msg := Message{Locale: data.Locale}
+	name := data.Locale + "/" + string(typ)
+	var err error
+	if msg.Subject, err = executeText(name+" subject", subject, data); err != nil {
+		return Message{}, err
+	}
+	// Subjects are a single header line
+	msg.Subject = strings.Join(strings.Fields(msg.Subject), " ")
+	if msg.Text, err = executeText(name+" text", text, data); err != nil {
+		return Message{}, err
+	}
+
+	t, err := htmltemplate.New(name + " html").Parse(html)
+	if err != nil {
+		return Message{}, fmt.Errorf("error parsing %s html template: %w", name, err)
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return Message{}, fmt.Errorf("error rendering %s html template: %w", name, err)
+	}
+	msg.HTML = b.String()
+	return msg, nil
+}
+
+func executeText(name string, text string, data Data) (string, error) {
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("error parsing %s template: %w", name, err)
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("error rendering %s template: %w", name, err)
+	}
+	return b.String(), nil
+}
+
+// resolveLocale is the first of the locale, its language and the default that the gym or the built in templates have wording for
+func resolveLocale(templates appointment.MessageTemplates, typ Type, locale string) string {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	candidates := []string{locale}
+	if language, _, ok := strings.Cut(locale, "-"); ok {
+		candidates = append(candidates, language)
+	}
+	for _, candidate := range candidates {
+		if _, ok := templates[candidate][string(typ)]; ok {
+			return candidate
+		}
+		if _, ok := builtin[candidate][string(typ)]; ok {
+			return candidate
+		}
+	}
+	return DefaultLocale
+}
+
+// Start is when the appointment starts in its location's time zone
+func (d Data) Start() time.Time {
+	if zone := d.Location.Zone(); zone != nil {
+		return d.Appointment.StartTime.In(zone)
+	}
+	return d.Appointment.StartTime
+}
+
+// Date is the day of the appointment like Monday, January 7 or lunes, 7 de enero
+func (d Data) Date() string {
+	start := d.Start()
+	switch d.language() {
+	case "es":
+		return fmt.Sprintf("%s, %d de %s", weekdaysES[start.Weekday()], start.Day(), monthsES[start.Month()-1])
+	}
+	return start.Format("Monday, January 2")
+}
+
+// ShortDate is the day of the appointment like Mon Jan 7 or lun 7 ene
+func (d Data) ShortDate() string {
+	start := d.Start()
+	switch d.language() {
+	case "es":
+		return fmt.Sprintf("%s %d %s", abbreviate(weekdaysES[start.Weekday()]), start.Day(), abbreviate(monthsES[start.Month()-1]))
+	}
+	return start.Format("Mon Jan 2")
+}
+
+// Time is when the appointment starts like 9:00 AM, or 9:00 in locales that use the 24 hour clock
+func (d Data) Time() string {
+	switch d.language() {
+	case "es":
+		return d.Start().Format("15:04")
+	}
+	return d.Start().Format("3:04 PM")
+}
+
+// Zone is the abbreviation of the time zone the appointment is shown in, like PST
+func (d Data) Zone() string {
+	return d.Start().Format("MST")
+}
+
+func (d Data) language() string {
+	language, _, _ := strings.Cut(d.Locale, "-")
+	return language
+}
+
+// abbreviate is the first three letters of a day or month name
+func abbreviate(name string) string {
+	return string([]rune(name)[:3])
+}
+
+var (
+	weekdaysES = [...]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"}
+	monthsES   = [...]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"}
+)
@@ -0,0 +1,105 @@
+package notification
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+)
+
+func TestRender(t *testing.T) {
+	start := time.Date(2030, 1, 9, 18, 30, 0, 0, time.UTC)
+	data := Data{
+		Appointment: appointment.Appointment{ID: 4, TrainerID: 2, UserID: 5, StartTime: start, SessionType: "standard"},
+		User:        appointment.User{ID: 5, Name: "Sam <3"},
+		Location:    appointment.Location{Address: "1 Main St"},
+	}
+
+	t.Run("english by default", func(t *testing.T) {
+		msg, err := Render(nil, TypeConfirmation, data)
+		require.NoError(t, err)
+		assert.Equal(t, "en", msg.Locale)
+		assert.Equal(t, "Your session on Wed Jan 9 at 6:30 PM is booked", msg.Subject)
+		assert.Contains(t, msg.Text, "Hi Sam <3,\n\nYour standard session with trainer 2 on Wednesday, January 9 at 6:30 PM UTC is confirmed.\n\nWhere: 1 Main St\n")
+		assert.Contains(t, msg.HTML, "<p>Hi Sam &lt;3,</p>")
+	})
+
+	t.Run("regional locales fall back to their language", func(t *testing.T) {
+		data := data
+		data.Locale = "es_MX"
+		msg, err := Render(nil, TypeReminder, data)
+		require.NoError(t, err)
+		assert.Equal(t, "es", msg.Locale)
+		assert.Equal(t, "Recordatorio: tu sesión del mié 9 ene a las 18:30", msg.Subject)
+		assert.Contains(t, msg.Text, "con el entrenador 2 el miércoles, 9 de enero a las 18:30 UTC.")
+	})
+
+	t.Run("unknown locales fall back to english", func(t *testing.T) {
+		data := data
+		data.Locale = "fr"
+		msg, err := Render(nil, TypeReminder, data)
+		require.NoError(t, err)
+		assert.Equal(t, "en", msg.Locale)
+		assert.Equal(t, "Reminder: your session on Wed Jan 9 at 6:30 PM", msg.Subject)
+	})
+
+	t.Run("the gym's wording replaces the parts it has", func(t *testing.T) {
+		templates := appointment.MessageTemplates{
+			"es": {"reminder": {Subject: "¡{{.User.Name}}, mañana entrenas!"}},
+			"fr": {"reminder": {Subject: "Rappel : séance le {{.Date}}", Text: "Bonjour {{.User.Name}}"}},
+		}
+		data := data
+		data.Locale = "es"
+		msg, err := Render(templates, TypeReminder, data)
+		require.NoError(t, err)
+		assert.Equal(t, "¡Sam <3, mañana entrenas!", msg.Subject)
+		assert.Contains(t, msg.Text, "Te recordamos tu sesión")
+
+		// A regional override is used for the users in that region, their locale can be any case
+		templates["es-mx"] = map[string]appointment.MessageTemplate{"reminder": {Subject: "¡Órale {{.User.Name}}!"}}
+		data.Locale = "es-MX"
+		msg, err = Render(templates, TypeReminder, data)
+		require.NoError(t, err)
+		assert.Equal(t, "es-mx", msg.Locale)
+		assert.Equal(t, "¡Órale Sam <3!", msg.Subject)
+		assert.Contains(t, msg.Text, "Te recordamos tu sesión")
+
+		// A locale only the gym has uses the english wording for the rest
+		data.Locale = "fr"
+		msg, err = Render(templates, TypeReminder, data)
+		require.NoError(t, err)
+		assert.Equal(t, "fr", msg.Locale)
+		assert.Equal(t, "Rappel : séance le Wednesday, January 9", msg.Subject)
+		assert.Equal(t, "Bonjour Sam <3", msg.Text)
+		assert.Contains(t, msg.HTML, "This is a reminder")
+	})
+
+	t.Run("times are in the location's time zone", func(t *testing.T) {
+		data := data
+		data.Location = appointment.Location{}
+		data.Appointment.StartTime = start.In(time.FixedZone("EST", -5*60*60))
+		msg, err := Render(nil, TypeConfirmation, data)
+		require.NoError(t, err)
+		assert.Contains(t, msg.Text, "on Wednesday, January 9 at 1:30 PM EST is confirmed.")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := Render(nil, "welcome", data)
+		assert.EqualError(t, err, "unknown notification type welcome")
+
+		_, err = Render(appointment.MessageTemplates{"en": {"reminder": {Text: "{{.Trainer}}"}}}, TypeReminder, data)
+		assert.ErrorContains(t, err, "error rendering en/reminder text template")
+	})
+}
+
+func TestTypes(t *testing.T) {
+	// The templates a gym can write are checked against the appointment package's copy of the types
+	var types []string
+	for _, typ := range Types() {
+		types = append(types, string(typ))
+	}
+	assert.ElementsMatch(t, appointment.MessageTypes, types)
+}
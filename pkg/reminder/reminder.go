@@ -0,0 +1,284 @@
+// Package reminder sends clients reminders of their appointments at set times before they start
+package reminder
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/justinthompson/appointment/pkg/notification"
+)
+
+// DefaultOffsets remind clients the day before and an hour before
+var DefaultOffsets = []time.Duration{24 * time.Hour, time.Hour}
+
+// idleWait is how long the scheduler sleeps when no reminders are due, new ones wake it sooner
+const idleWait = time.Hour
+
+type (
+	// Scheduler sends reminders of the tenants' appointments at each offset before they start.
+	// Nothing is stored, the reminders are worked out from the appointments when it starts and kept up to date
+	// from the appointment events. Reminders that were due while the server was down aren't sent.
+	Scheduler struct {
+		tenants  *appointment.Tenants
+		notifier notification.Notifier
+		offsets  []time.Duration
+		now      func() time.Time
+
+		mu sync.Mutex
+		// scheduled are the appointments with reminders still to send, an appointment is removed once its last one is sent
+		scheduled   map[appointmentKey]scheduled
+		queue       reminderQueue
+		wake        chan struct{}
+		unsubscribe []func()
+	}
+
+	appointmentKey struct {
+		tenantID      string
+		appointmentID int
+	}
+
+	// scheduled is the version an appointment's reminders were worked out from and how many of them haven't been sent
+	scheduled struct {
+		version int
+		pending int
+	}
+
+	// queued is a reminder waiting to be sent, it is stale if the appointment has been scheduled again since
+	queued struct {
+		key     appointmentKey
+		at      time.Time
+		before  time.Duration
+		version int
+	}
+
+	// reminderQueue is a min-heap of reminders by when they are due
+	reminderQueue []queued
+)
+
+// NewScheduler returns a scheduler that sends reminders through the notifier at the offsets before each appointment
+func NewScheduler(tenants *appointment.Tenants, notifier notification.Notifier, offsets []time.Duration) *Scheduler {
+	return &Scheduler{
+		tenants:   tenants,
+		notifier:  notifier,
+		offsets:   offsets,
+		now:       time.Now,
+		scheduled: map[appointmentKey]scheduled{},
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// ParseOffsets reads a comma separated list of durations like 24h,1h
+func ParseOffsets(s string) ([]time.Duration, error) {
+	var offsets []time.Duration
+	for _, part := range strings.Split(s, ",") {
+		offset, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid reminder offset %q: %w", part, err)
+		}
+		if offset <= 0 {
+			return nil, fmt.Errorf("reminder offset %s must be before the appointment", offset)
+		}
+		offsets = append(offsets, offset)
+	}
+	return offsets, nil
+}
+
+// Run schedules the reminders of the stored appointments and sends them as they become due until ctx is done
+func (s *Scheduler) Run(ctx context.Context) error {
+	if err := s.Start(); err != nil {
+		return err
+	}
+	defer s.Stop()
+
+	for {
+		s.SendDue(ctx)
+		timer := time.NewTimer(s.untilNext())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		case <-s.wake:
+			timer.Stop()
+		}
+	}
+}
+
+// Start follows each tenant's appointment events and schedules the reminders of their upcoming appointments
+func (s *Scheduler) Start() error {
+	for _, tenantID := range s.tenants.IDs() {
+		manager, err := s.tenants.Manager(tenantID)
+		if err != nil {
+			return err
+		}
+
+		// Follow the events first so a change made while the appointments are read isn't missed
+		tenantID := tenantID
+		s.unsubscribe = append(s.unsubscribe, manager.SubscribeAsync(func(event appointment.DomainEvent) {
+			s.handle(tenantID, event)
+		}, 1))
+
+		upcoming, err := manager.GetUpcomingAppointments(s.now())
+		if err != nil {
+			return fmt.Errorf("error reading appointments of tenant %s: %w", tenantID, err)
+		}
+		for _, app := range upcoming {
+			s.schedule(tenantID, app)
+		}
+	}
+	return nil
+}
+
+// Stop stops following the tenants' events
+func (s *Scheduler) Stop() {
+	for _, unsubscribe := range s.unsubscribe {
+		unsubscribe()
+	}
+	s.unsubscribe = nil
+}
+
+// handle keeps an appointment's reminders up to date with its events
+func (s *Scheduler) handle(tenantID string, event appointment.DomainEvent) {
+	app := event.Base().Appointment
+	if _, ok := event.(appointment.AppointmentDeleted); ok {
+		s.mu.Lock()
+		delete(s.scheduled, appointmentKey{tenantID, app.ID})
+		s.mu.Unlock()
+		return
+	}
+	s.schedule(tenantID, app)
+}
+
+// schedule works out the appointment's reminders again, replacing the ones from an older version.
+// Appointments that aren't booked any more, like cancelled ones, and ones too soon for any reminder aren't kept.
+func (s *Scheduler) schedule(tenantID string, app appointment.Appointment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The same version can be seen twice when it is read at start as its event arrives
+	key := appointmentKey{tenantID, app.ID}
+	if current, ok := s.scheduled[key]; ok && current.version >= app.Version {
+		return
+	}
+	delete(s.scheduled, key)
+	if !reminds(app.Status) {
+		return
+	}
+
+	now := s.now()
+	pending := 0
+	for _, before := range s.offsets {
+		at := app.StartTime.Add(-before)
+		if at.After(now) {
+			heap.Push(&s.queue, queued{key: key, at: at, before: before, version: app.Version})
+			pending++
+		}
+	}
+	if pending == 0 {
+		return
+	}
+	s.scheduled[key] = scheduled{version: app.Version, pending: pending}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// SendDue sends every reminder that is due
+func (s *Scheduler) SendDue(ctx context.Context) {
+	for {
+		r, ok := s.nextDue()
+		if !ok {
+			return
+		}
+		if err := s.send(ctx, r); err != nil {
+			log.Error().Err(err).Str("tenant", r.key.tenantID).Int("appointment", r.key.appointmentID).Msg("error sending reminder")
+		}
+	}
+}
+
+// nextDue takes the next reminder that is due off the queue, skipping the ones that are stale.
+// The appointment is forgotten once its last reminder is taken.
+func (s *Scheduler) nextDue() (queued, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for len(s.queue) > 0 && !s.queue[0].at.After(now) {
+		r := heap.Pop(&s.queue).(queued)
+		current, ok := s.scheduled[r.key]
+		if !ok || current.version != r.version {
+			continue
+		}
+		if current.pending--; current.pending == 0 {
+			delete(s.scheduled, r.key)
+		} else {
+			s.scheduled[r.key] = current
+		}
+		return r, true
+	}
+	return queued{}, false
+}
+
+// untilNext is how long until the next reminder is due
+func (s *Scheduler) untilNext() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) == 0 {
+		return idleWait
+	}
+	return s.queue[0].at.Sub(s.now())
+}
+
+// send sends the reminder if the appointment is still booked for the time it was scheduled for
+func (s *Scheduler) send(ctx context.Context, r queued) error {
+	manager, err := s.tenants.Manager(r.key.tenantID)
+	if err != nil {
+		return err
+	}
+	app, err := manager.GetAppointment(r.key.appointmentID)
+	if errors.Is(err, appointment.ErrAppointmentNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !reminds(app.Status) || !app.StartTime.Equal(r.at.Add(r.before)) {
+		return nil
+	}
+
+	n, err := notification.Compose(r.key.tenantID, manager, notification.TypeReminder, app, r.before)
+	if err != nil {
+		return err
+	}
+	return s.notifier.Notify(ctx, n)
+}
+
+// reminds reports whether clients are reminded of appointments in the status, requests aren't until they are accepted
+func reminds(status appointment.Status) bool {
+	return status == appointment.StatusConfirmed || status == appointment.StatusTentative
+}
+
+func (q reminderQueue) Len() int { return len(q) }
+
+func (q reminderQueue) Less(i, j int) bool { return q[i].at.Before(q[j].at) }
+
+func (q reminderQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *reminderQueue) Push(x interface{}) { *q = append(*q, x.(queued)) }
+
+func (q *reminderQueue) Pop() interface{} {
+	old := *q
+	r := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return r
+}
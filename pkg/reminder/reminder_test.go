@@ -0,0 +1,130 @@
+package reminder
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+	"github.com/justinthompson/appointment/pkg/notification"
+)
+
+// recordingNotifier keeps the reminders it is sent
+type recordingNotifier struct {
+	mu        sync.Mutex
+	reminders []notification.Notification
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, r notification.Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.reminders = append(n.reminders, r)
+	return nil
+}
+
+func (n *recordingNotifier) sent() []notification.Notification {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	sent := n.reminders
+	n.reminders = nil
+	return sent
+}
+
+func TestScheduler(t *testing.T) {
+	now := time.Date(2030, 1, 6, 17, 0, 0, 0, time.UTC)
+	start := now.Add(25 * time.Hour)
+	booked := appointment.Appointment{ID: 1, TrainerID: 1, UserID: 5, StartTime: start, EndTime: start.Add(30 * time.Minute), Status: appointment.StatusConfirmed, Version: 1}
+	manager := appointment.NewMockAppointmentManager([]appointment.Appointment{
+		booked,
+		{ID: 2, TrainerID: 1, UserID: 6, StartTime: start.Add(time.Hour), Status: appointment.StatusPending, Version: 1},
+		{ID: 3, TrainerID: 1, UserID: 7, StartTime: start.Add(2 * time.Hour), Status: appointment.StatusCancelled, Version: 2},
+		{ID: 4, TrainerID: 1, UserID: 8, StartTime: now.Add(30 * time.Minute), Status: appointment.StatusConfirmed, Version: 1},
+	}, nil)
+	manager.Users = []appointment.User{{ID: 5, Name: "Sam", Email: "sam@example.com"}}
+
+	notifier := &recordingNotifier{}
+	s := NewScheduler(appointment.NewSingleTenant(manager), notifier, DefaultOffsets)
+	s.now = func() time.Time { return now }
+	require.NoError(t, s.Start())
+	defer s.Stop()
+	// publish gives the scheduler an event and waits for it to be handled
+	publish := func(event appointment.DomainEvent) {
+		manager.Publish(event)
+		app := event.Base().Appointment
+		require.Eventually(t, func() bool {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			current, ok := s.scheduled[appointmentKey{appointment.DefaultTenantID, app.ID}]
+			return current.version == app.Version || !ok
+		}, time.Second, time.Millisecond)
+	}
+
+	s.SendDue(context.Background())
+	assert.Empty(t, notifier.sent())
+	// Appointments too soon for a reminder aren't kept
+	scheduled := func() int {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.scheduled)
+	}
+	assert.Equal(t, 1, scheduled())
+
+	// The day before, only the confirmed appointment is reminded and only once
+	now = now.Add(time.Hour)
+	s.SendDue(context.Background())
+	s.SendDue(context.Background())
+	sent := notifier.sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, booked, sent[0].Appointment)
+	assert.Equal(t, "sam@example.com", sent[0].User.Email)
+	assert.Equal(t, 24*time.Hour, sent[0].Before)
+	assert.Equal(t, "Reminder: your session on Mon Jan 7 at 6:00 PM", sent[0].Message.Subject)
+
+	// A reschedule moves the reminders to the new time, even the day before one that was already sent
+	rescheduled := booked
+	rescheduled.StartTime, rescheduled.EndTime, rescheduled.Version = start.Add(3*time.Hour), start.Add(210*time.Minute), 2
+	manager.AppointmentsList[0] = rescheduled
+	publish(appointment.AppointmentRescheduled{Event: appointment.Event{ID: 1, Type: appointment.EventRescheduled, Appointment: rescheduled}, Previous: booked})
+	now = start.Add(-time.Hour)
+	s.SendDue(context.Background())
+	sent = notifier.sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, rescheduled, sent[0].Appointment)
+	assert.Equal(t, 24*time.Hour, sent[0].Before)
+	now = rescheduled.StartTime.Add(-time.Hour)
+	s.SendDue(context.Background())
+	sent = notifier.sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, time.Hour, sent[0].Before)
+	// The appointment is forgotten once its last reminder is sent
+	assert.Zero(t, scheduled())
+
+	// A booking request is reminded once it is accepted, and not once it is cancelled
+	accepted := manager.AppointmentsList[1]
+	accepted.StartTime, accepted.Status, accepted.Version = now.Add(2*time.Hour), appointment.StatusConfirmed, 2
+	manager.AppointmentsList[1] = accepted
+	publish(appointment.AppointmentStatusChanged{Event: appointment.Event{ID: 2, Type: "appointment.confirmed", Appointment: accepted}, From: appointment.StatusPending})
+	cancelled := accepted
+	cancelled.Status, cancelled.Version = appointment.StatusCancelled, 3
+	publish(appointment.AppointmentCancelled{Event: appointment.Event{ID: 3, Type: "appointment.cancelled", Appointment: cancelled}, From: appointment.StatusConfirmed})
+	manager.AppointmentsList[1] = cancelled
+	now = accepted.StartTime.Add(-time.Hour)
+	s.SendDue(context.Background())
+	assert.Empty(t, notifier.sent())
+	assert.Zero(t, scheduled())
+}
+
+func TestParseOffsets(t *testing.T) {
+	offsets, err := ParseOffsets("24h, 1h30m")
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{24 * time.Hour, 90 * time.Minute}, offsets)
+
+	_, err = ParseOffsets("24h,-1h")
+	assert.EqualError(t, err, "reminder offset -1h0m0s must be before the appointment")
+	_, err = ParseOffsets("tomorrow")
+	assert.Error(t, err)
+}
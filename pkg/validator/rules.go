@@ -0,0 +1,144 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Default business hours used when the validation context doesn't say where the appointment is
+const (
+	DefaultOpenHour  = 8
+	DefaultCloseHour = 17
+)
+
+type (
+	// BusinessHours returns the opening hours that apply to a request for the trainer or location.
+	// A nil time zone means the times are checked in the offset they were sent with.
+	// ok is false when the trainer or location is unknown, which is left for the manager to report.
+	BusinessHours func(trainerID int, locationID int) (open int, close int, tz *time.Location, ok bool)
+
+	businessHoursKey struct{}
+)
+
+// ruleTranslations are the messages for our rules, {1} is the duration for the duration rule
+var ruleTranslations = []struct {
+	tag string
+	en  string
+	es  string
+}{
+	{"halfhour", "{0} must be on the hour or half-hour", "{0} debe ser en punto o y media"},
+	{"business_hours", "{0} must be within business hours", "{0} debe estar dentro del horario de apertura"},
+	{"duration", "{0} must be {1} after the start", "{0} debe ser {1} después del inicio"},
+}
+
+// WithBusinessHours returns a context that the business_hours rule reads its opening hours from
+func WithBusinessHours(ctx context.Context, hours BusinessHours) context.Context {
+	return context.WithValue(ctx, businessHoursKey{}, hours)
+}
+
+// registerRules registers the booking rules as tags
+//
+//	halfhour        the time is on the hour or half-hour
+//	business_hours  the time is within the opening hours of the request's trainer or location, a start can't be the closing time
+//	business_hours=end  like business_hours for an end time, which can be the closing time but not the opening time
+//	duration=F:30m  the time is exactly 30m after the time in field F
+func registerRules(v *validator.Validate) error {
+	if err := v.RegisterValidation("halfhour", isHalfHour); err != nil {
+		return err
+	}
+	if err := v.RegisterValidationCtx("business_hours", isWithinBusinessHours); err != nil {
+		return err
+	}
+	return v.RegisterValidation("duration", isDuration)
+}
+
+// isHalfHour checks that a time is on the hour or half-hour
+func isHalfHour(fl validator.FieldLevel) bool {
+	t, ok := fl.Field().Interface().(time.Time)
+	if !ok {
+		return false
+	}
+	return t.Minute()%30 == 0 && t.Second() == 0 && t.Nanosecond() == 0
+}
+
+// isWithinBusinessHours checks a time against the hours from the context, or the default hours if there are none.
+// The trainer and location are read from the TrainerID and LocationID fields of the request.
+func isWithinBusinessHours(ctx context.Context, fl validator.FieldLevel) bool {
+	t, ok := fl.Field().Interface().(time.Time)
+	if !ok {
+		return false
+	}
+
+	open, close := DefaultOpenHour, DefaultCloseHour
+	if hours, ok := ctx.Value(businessHoursKey{}).(BusinessHours); ok {
+		var tz *time.Location
+		open, close, tz, ok = hours(intField(fl.Parent(), "TrainerID"), intField(fl.Parent(), "LocationID"))
+		if !ok {
+			return true
+		}
+		if tz != nil {
+			t = t.In(tz)
+		}
+	}
+
+	y, m, d := t.Date()
+	opens, closes := time.Date(y, m, d, open, 0, 0, 0, t.Location()), time.Date(y, m, d, close, 0, 0, 0, t.Location())
+	if fl.Param() == "end" {
+		return t.After(opens) && !t.After(closes)
+	}
+	return !t.Before(opens) && t.Before(closes)
+}
+
+// isDuration checks that a time is a fixed duration after another field, the param is field:duration
+func isDuration(fl validator.FieldLevel) bool {
+	end, ok := fl.Field().Interface().(time.Time)
+	if !ok {
+		return false
+	}
+
+	startField, duration, err := durationParam(fl.Param())
+	if err != nil {
+		panic(err)
+	}
+
+	start, ok := fieldByName(fl.Parent(), startField).Interface().(time.Time)
+	if !ok {
+		panic(fmt.Sprintf("duration: field %s is not a time", startField))
+	}
+	return end.Sub(start) == duration
+}
+
+// durationParam splits a duration rule's param into the start field and the duration
+func durationParam(param string) (string, time.Duration, error) {
+	field, value, ok := strings.Cut(param, ":")
+	if !ok {
+		return "", 0, fmt.Errorf("duration: param %q must be field:duration", param)
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return "", 0, fmt.Errorf("duration: %w", err)
+	}
+	return field, duration, nil
+}
+
+// fieldByName returns a field of the struct, following the pointer if the struct is one
+func fieldByName(parent reflect.Value, name string) reflect.Value {
+	if parent.Kind() == reflect.Ptr {
+		parent = parent.Elem()
+	}
+	return parent.FieldByName(name)
+}
+
+// intField returns the value of an int field or 0 if the struct doesn't have it
+func intField(parent reflect.Value, name string) int {
+	field := fieldByName(parent, name)
+	if !field.IsValid() || field.Kind() != reflect.Int {
+		return 0
+	}
+	return int(field.Int())
+}
@@ -1,17 +1,193 @@
 package validator
 
-import "github.com/go-playground/validator/v10"
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/es"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	es_translations "github.com/go-playground/validator/v10/translations/es"
+)
+
+// DefaultLocale is used when the client doesn't accept any of the locales we have translations for
+const DefaultLocale = "en"
 
 func NewValidator() *Validator {
+	v := validator.New()
+	// Report fields by the name the client sent them as rather than the go field name
+	v.RegisterTagNameFunc(FieldName)
+
+	if err := registerRules(v); err != nil {
+		panic(err)
+	}
+
+	english := en.New()
+	translators := ut.New(english, english, es.New())
+	enTrans, _ := translators.GetTranslator("en")
+	esTrans, _ := translators.GetTranslator("es")
+	// These only fail if the built in translations are broken
+	if err := en_translations.RegisterDefaultTranslations(v, enTrans); err != nil {
+		panic(err)
+	}
+	if err := es_translations.RegisterDefaultTranslations(v, esTrans); err != nil {
+		panic(err)
+	}
+	// The spanish translations are missing some of the rules our requests use
+	if err := registerTranslation(v, esTrans, "required_without", "{0} es un campo requerido"); err != nil {
+		panic(err)
+	}
+	if err := registerTranslation(v, esTrans, "required_without_all", "{0} es un campo requerido"); err != nil {
+		panic(err)
+	}
+	for _, t := range ruleTranslations {
+		if err := registerTranslation(v, enTrans, t.tag, t.en); err != nil {
+			panic(err)
+		}
+		if err := registerTranslation(v, esTrans, t.tag, t.es); err != nil {
+			panic(err)
+		}
+	}
+
 	return &Validator{
-		validator: validator.New(),
+		validator:   v,
+		translators: translators,
 	}
 }
 
 type Validator struct {
-	validator *validator.Validate
+	validator   *validator.Validate
+	translators *ut.UniversalTranslator
 }
 
+type (
+	// FieldError describes why one field of a request is invalid
+	FieldError struct {
+		Field    string `json:"field"`
+		JSONName string `json:"json_name"`
+		Rule     string `json:"rule"`
+		Message  string `json:"message"`
+	}
+
+	// ValidationError is returned by Validate when a request has invalid fields
+	ValidationError struct {
+		errs        validator.ValidationErrors
+		translators *ut.UniversalTranslator
+	}
+)
+
+// Validate validates the request struct, invalid fields are returned as a *ValidationError
 func (v *Validator) Validate(i interface{}) error {
-	return v.validator.Struct(i)
+	return v.ValidateCtx(context.Background(), i)
+}
+
+// ValidateCtx validates the request struct with rules like business_hours that read from the context
+func (v *Validator) ValidateCtx(ctx context.Context, i interface{}) error {
+	err := v.validator.StructCtx(ctx, i)
+	var errs validator.ValidationErrors
+	if errors.As(err, &errs) {
+		return &ValidationError{errs: errs, translators: v.translators}
+	}
+	return err
+}
+
+func (e *ValidationError) Error() string {
+	return e.errs.Error()
+}
+
+// Fields returns the invalid fields with messages in the best locale from an Accept-Language header
+func (e *ValidationError) Fields(acceptLanguage string) []FieldError {
+	trans, _ := e.translators.FindTranslator(acceptedLocales(acceptLanguage)...)
+	fallback, _ := e.translators.GetTranslator(DefaultLocale)
+
+	fields := make([]FieldError, 0, len(e.errs))
+	for _, fe := range e.errs {
+		message := fe.Translate(trans)
+		// Translate returns the raw error when the locale has no translation for the rule
+		if message == fe.Error() {
+			message = fe.Translate(fallback)
+		}
+
+		fields = append(fields, FieldError{
+			Field:    fe.StructField(),
+			JSONName: fe.Field(),
+			Rule:     fe.Tag(),
+			Message:  message,
+		})
+	}
+	return fields
+}
+
+// registerTranslation adds a message for a rule, {0} is replaced with the field name and {1} with the rule's parameter
+func registerTranslation(v *validator.Validate, trans ut.Translator, tag string, message string) error {
+	return v.RegisterTranslation(tag, trans, func(ut ut.Translator) error {
+		return ut.Add(tag, message, true)
+	}, func(ut ut.Translator, fe validator.FieldError) string {
+		param := fe.Param()
+		// The duration rule's param starts with the go name of the start field which clients don't know about
+		if tag == "duration" {
+			_, param, _ = strings.Cut(param, ":")
+		}
+		t, err := ut.T(tag, fe.Field(), param)
+		if err != nil {
+			return fe.Error()
+		}
+		return t
+	})
+}
+
+// FieldName returns the json, query or path parameter name of a request field, this is the name used in errors
+func FieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "query", "param"} {
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// acceptedLocales returns the languages in an Accept-Language header, most preferred first
+func acceptedLocales(acceptLanguage string) []string {
+	type locale struct {
+		name    string
+		quality float64
+	}
+
+	var locales []locale
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil || parsed <= 0 {
+				continue
+			}
+			quality = parsed
+		}
+
+		// Translations are only per language so en-US and en-GB both use en
+		base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		locales = append(locales, locale{name: base, quality: quality})
+	}
+	sort.SliceStable(locales, func(i, j int) bool { return locales[i].quality > locales[j].quality })
+
+	names := make([]string, 0, len(locales)+1)
+	for _, l := range locales {
+		names = append(names, l.name)
+	}
+	return append(names, DefaultLocale)
 }
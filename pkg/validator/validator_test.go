@@ -0,0 +1,136 @@
+package validator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testRequest struct {
+	StartTime time.Time `json:"starts_at" validate:"required"`
+	TrainerID int       `query:"trainer_id" validate:"required_without=UserID"`
+	UserID    int       `param:"id"`
+}
+
+func TestValidate_Fields(t *testing.T) {
+	v := NewValidator()
+	err := v.Validate(&testRequest{})
+	require.Error(t, err)
+
+	validationErr, ok := err.(*ValidationError)
+	require.True(t, ok)
+
+	t.Run("english", func(t *testing.T) {
+		assert.Equal(t, []FieldError{
+			{Field: "StartTime", JSONName: "starts_at", Rule: "required", Message: "starts_at is a required field"},
+			{Field: "TrainerID", JSONName: "trainer_id", Rule: "required_without", Message: "trainer_id is a required field"},
+		}, validationErr.Fields(""))
+	})
+	t.Run("spanish", func(t *testing.T) {
+		fields := validationErr.Fields("fr-CA, es-MX;q=0.8, en;q=0.5")
+		require.Len(t, fields, 2)
+		assert.Equal(t, "starts_at es un campo requerido", fields[0].Message)
+		assert.Equal(t, "trainer_id es un campo requerido", fields[1].Message)
+	})
+}
+
+func TestValidate_Valid(t *testing.T) {
+	v := NewValidator()
+	assert.NoError(t, v.Validate(&testRequest{StartTime: time.Now(), UserID: 1}))
+}
+
+func TestAcceptedLocales(t *testing.T) {
+	assert.Equal(t, []string{"en"}, acceptedLocales(""))
+	assert.Equal(t, []string{"es", "en", "en"}, acceptedLocales("en;q=0.5, es-ES, de;q=0"))
+}
+
+type bookingRequest struct {
+	StartTime  time.Time `json:"starts_at" validate:"halfhour,business_hours"`
+	EndTime    time.Time `json:"ends_at" validate:"halfhour,business_hours=end,gtfield=StartTime,duration=StartTime:30m"`
+	TrainerID  int       `json:"trainer_id"`
+	LocationID int       `json:"location_id"`
+}
+
+func TestValidate_BookingRules(t *testing.T) {
+	v := NewValidator()
+	start := time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		start time.Time
+		end   time.Time
+		rules []string
+	}{
+		{"valid", start, start.Add(30 * time.Minute), nil},
+		{"not on the half hour", start.Add(time.Minute), start.Add(31 * time.Minute), []string{"halfhour", "halfhour"}},
+		{"seconds past the half hour", start, start.Add(30*time.Minute + time.Second), []string{"halfhour"}},
+		{"end before start", start, start.Add(-30 * time.Minute), []string{"gtfield"}},
+		{"too long", start, start.Add(time.Hour), []string{"duration"}},
+		{"before opening", start.Add(-2 * time.Hour), start.Add(-90 * time.Minute), []string{"business_hours", "business_hours"}},
+		{"after closing", start.Add(9 * time.Hour), start.Add(570 * time.Minute), []string{"business_hours", "business_hours"}},
+		{"ends at closing", start.Add(450 * time.Minute), start.Add(8 * time.Hour), nil},
+		{"starts at closing", start.Add(8 * time.Hour), start.Add(510 * time.Minute), []string{"business_hours", "business_hours"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Validate(&bookingRequest{StartTime: tt.start, EndTime: tt.end})
+			if tt.rules == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			var rules []string
+			for _, field := range validationErr.Fields("") {
+				rules = append(rules, field.Rule)
+			}
+			assert.Equal(t, tt.rules, rules)
+		})
+	}
+}
+
+func TestValidateCtx_BusinessHours(t *testing.T) {
+	v := NewValidator()
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	var gotTrainer, gotLocation int
+	ctx := WithBusinessHours(context.Background(), func(trainerID int, locationID int) (int, int, *time.Location, bool) {
+		gotTrainer, gotLocation = trainerID, locationID
+		return 6, 20, newYork, locationID != 0
+	})
+
+	// 12:00 UTC is 7am in New York, before the default opening hour but after this location's
+	req := &bookingRequest{
+		StartTime:  time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC),
+		EndTime:    time.Date(2022, 1, 1, 12, 30, 0, 0, time.UTC),
+		TrainerID:  3,
+		LocationID: 2,
+	}
+	assert.NoError(t, v.ValidateCtx(ctx, req))
+	assert.Equal(t, 3, gotTrainer)
+	assert.Equal(t, 2, gotLocation)
+
+	// 02:00 UTC is 9pm in New York
+	req.StartTime, req.EndTime = req.StartTime.Add(-10*time.Hour), req.EndTime.Add(-10*time.Hour)
+	assert.Error(t, v.ValidateCtx(ctx, req))
+
+	// Unknown locations are left for the manager to report
+	req.LocationID = 0
+	assert.NoError(t, v.ValidateCtx(ctx, req))
+}
+
+func TestValidate_RuleTranslations(t *testing.T) {
+	v := NewValidator()
+	start := time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)
+	err := v.Validate(&bookingRequest{StartTime: start, EndTime: start.Add(time.Hour)})
+
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, "ends_at must be 30m after the start", validationErr.Fields("")[0].Message)
+	assert.Equal(t, "ends_at debe ser 30m después del inicio", validationErr.Fields("es")[0].Message)
+}
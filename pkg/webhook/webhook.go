@@ -0,0 +1,203 @@
+// Package webhook sends the events in each tenant's outbox to their webhooks
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// batchSize is the most deliveries of a tenant sent in one pass
+const batchSize = 100
+
+type (
+	// Payload is the body sent to a webhook
+	Payload struct {
+		// ID is the event's ID, it is the same for every attempt and every webhook the event is sent to
+		ID          int                     `json:"id"`
+		Type        appointment.EventType   `json:"type"`
+		CreatedAt   time.Time               `json:"created_at"`
+		Tenant      string                  `json:"tenant"`
+		Appointment appointment.Appointment `json:"appointment"`
+	}
+
+	// Dispatcher sends due deliveries and retries the ones that fail with exponential backoff.
+	// A delivery that fails MaxAttempts times is moved to the tenant's dead letters.
+	Dispatcher struct {
+		tenants *appointment.Tenants
+		client  *http.Client
+		now     func() time.Time
+
+		// Interval is how often the outboxes are checked
+		Interval    time.Duration
+		MaxAttempts int
+		// BaseDelay is the wait before the first retry, it doubles for each one after up to MaxDelay
+		BaseDelay time.Duration
+		MaxDelay  time.Duration
+	}
+)
+
+// NewDispatcher returns a dispatcher for the tenants' outboxes with the default retry schedule,
+// which gives up after about a day
+func NewDispatcher(tenants *appointment.Tenants) *Dispatcher {
+	return &Dispatcher{
+		tenants:     tenants,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		now:         time.Now,
+		Interval:    5 * time.Second,
+		MaxAttempts: 12,
+		BaseDelay:   30 * time.Second,
+		MaxDelay:    6 * time.Hour,
+	}
+}
+
+// Run delivers due events every Interval until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		d.DeliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue sends every tenant's due deliveries once
+func (d *Dispatcher) DeliverDue(ctx context.Context) {
+	for _, tenantID := range d.tenants.IDs() {
+		manager, err := d.tenants.Manager(tenantID)
+		if err != nil {
+			continue
+		}
+		if err := d.deliverTenant(ctx, tenantID, manager); err != nil {
+			log.Error().Err(err).Str("tenant", tenantID).Msg("error delivering webhooks")
+		}
+	}
+}
+
+// deliverTenant sends the tenant's due deliveries in the order their events happened
+func (d *Dispatcher) deliverTenant(ctx context.Context, tenantID string, manager appointment.Manager) error {
+	deliveries, err := manager.DueDeliveries(d.now(), batchSize)
+	if err != nil {
+		return err
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	webhooks, err := manager.GetWebhooks()
+	if err != nil {
+		return err
+	}
+	byID := make(map[int]appointment.Webhook, len(webhooks))
+	for _, webhook := range webhooks {
+		byID[webhook.ID] = webhook
+	}
+
+	// A webhook that failed isn't sent anything else this pass so its later events don't arrive before the one being retried
+	failed := make(map[int]bool)
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return nil
+		}
+		webhook, ok := byID[delivery.WebhookID]
+		if !ok || failed[webhook.ID] {
+			continue
+		}
+
+		if err := d.send(ctx, tenantID, webhook, delivery); err != nil {
+			failed[webhook.ID] = true
+			retryAt := d.retryAt(delivery.Attempts + 1)
+			if retryAt.IsZero() {
+				log.Warn().Err(err).Str("tenant", tenantID).Int("delivery", delivery.ID).Msg("webhook delivery moved to dead letters")
+			}
+			if err := manager.DeliveryFailed(delivery.ID, err.Error(), retryAt); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := manager.DeliveryDone(delivery.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send posts the delivery's event to the webhook, any response other than 2xx is a failure
+func (d *Dispatcher) send(ctx context.Context, tenantID string, webhook appointment.Webhook, delivery appointment.Delivery) error {
+	body, err := json.Marshal(Payload{
+		ID:          delivery.Event.ID,
+		Type:        delivery.Event.Type,
+		CreatedAt:   delivery.Event.At,
+		Tenant:      tenantID,
+		Appointment: delivery.Event.Appointment,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, string(delivery.Event.Type))
+	req.Header.Set(HeaderDelivery, strconv.Itoa(delivery.ID))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, d.now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// retryAt returns when to try a delivery again after it has failed attempts times, zero once it should be given up on
+func (d *Dispatcher) retryAt(attempts int) time.Time {
+	if attempts >= d.MaxAttempts {
+		return time.Time{}
+	}
+	delay := d.BaseDelay
+	for i := 1; i < attempts && delay < d.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxDelay {
+		delay = d.MaxDelay
+	}
+	return d.now().Add(delay)
+}
+
+// Sign returns the signature header for a body sent at t.
+// The signature is the hex HMAC-SHA256 of the unix time, a dot and the body so a receiver can refuse old requests being replayed.
+func Sign(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,140 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justinthompson/appointment/pkg/appointment"
+)
+
+func TestDeliverDue(t *testing.T) {
+	now := time.Date(2030, 1, 7, 17, 0, 0, 0, time.UTC)
+	newDispatcher := func(url string) (*Dispatcher, *appointment.MockAppointmentManager) {
+		manager := appointment.NewMockAppointmentManager(nil, nil)
+		manager.Webhooks = []appointment.Webhook{{ID: 1, URL: url, Secret: "secret"}}
+		manager.Outbox = []appointment.Delivery{{
+			ID:            7,
+			WebhookID:     1,
+			Event:         appointment.Event{ID: 3, Type: appointment.EventCreated, At: now, Appointment: appointment.Appointment{ID: 4, TrainerID: 1}},
+			NextAttemptAt: now,
+		}}
+		d := NewDispatcher(appointment.NewSingleTenant(manager))
+		d.now = func() time.Time { return now }
+		d.MaxAttempts = 3
+		return d, manager
+	}
+
+	t.Run("delivered", func(t *testing.T) {
+		var (
+			headers http.Header
+			payload Payload
+			body    []byte
+		)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			headers = r.Header
+			body, _ = io.ReadAll(r.Body)
+			json.Unmarshal(body, &payload)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		d, manager := newDispatcher(server.URL)
+		d.DeliverDue(context.Background())
+
+		assert.Empty(t, manager.Outbox)
+		assert.Equal(t, "appointment.created", headers.Get(HeaderEvent))
+		assert.Equal(t, "7", headers.Get(HeaderDelivery))
+		assert.Equal(t, Sign("secret", now, body), headers.Get(HeaderSignature))
+		assert.Equal(t, Payload{ID: 3, Type: appointment.EventCreated, CreatedAt: now, Tenant: appointment.DefaultTenantID, Appointment: appointment.Appointment{ID: 4, TrainerID: 1}}, payload)
+	})
+	t.Run("retried then dead lettered", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		d, manager := newDispatcher(server.URL)
+		d.DeliverDue(context.Background())
+		require.Len(t, manager.Outbox, 1)
+		assert.Equal(t, now.Add(30*time.Second), manager.Outbox[0].NextAttemptAt)
+		assert.Equal(t, "webhook responded 500 Internal Server Error", manager.Outbox[0].LastError)
+
+		// Nothing is due until the retry
+		d.DeliverDue(context.Background())
+		assert.Equal(t, 1, calls)
+
+		now = now.Add(30 * time.Second)
+		d.DeliverDue(context.Background())
+		require.Len(t, manager.Outbox, 1)
+		assert.Equal(t, now.Add(time.Minute), manager.Outbox[0].NextAttemptAt)
+
+		now = now.Add(time.Minute)
+		d.DeliverDue(context.Background())
+		assert.Equal(t, 3, calls)
+		assert.Empty(t, manager.Outbox)
+		require.Len(t, manager.DeadLetters, 1)
+		assert.Equal(t, 3, manager.DeadLetters[0].Attempts)
+	})
+	t.Run("later events wait for a failed one", func(t *testing.T) {
+		var delivered []string
+		fail := true
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if fail {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			delivered = append(delivered, r.Header.Get(HeaderDelivery))
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		d, manager := newDispatcher(server.URL)
+		manager.Outbox = append(manager.Outbox, appointment.Delivery{
+			ID:            8,
+			WebhookID:     1,
+			Event:         appointment.Event{ID: 4, Type: appointment.EventDeleted, At: now, Appointment: appointment.Appointment{ID: 4, TrainerID: 1}},
+			NextAttemptAt: now,
+		})
+		d.DeliverDue(context.Background())
+		require.Len(t, manager.Outbox, 2)
+		assert.Equal(t, 1, manager.Outbox[0].Attempts)
+		assert.Zero(t, manager.Outbox[1].Attempts)
+
+		// The second delivery is due but waits for the first one's retry
+		fail = false
+		d.DeliverDue(context.Background())
+		assert.Empty(t, delivered)
+
+		now = now.Add(30 * time.Second)
+		d.DeliverDue(context.Background())
+		assert.Equal(t, []string{"7", "8"}, delivered)
+		assert.Empty(t, manager.Outbox)
+	})
+}
+
+func TestRetryAt(t *testing.T) {
+	now := time.Date(2030, 1, 7, 17, 0, 0, 0, time.UTC)
+	d := NewDispatcher(nil)
+	d.now = func() time.Time { return now }
+
+	assert.Equal(t, now.Add(30*time.Second), d.retryAt(1))
+	assert.Equal(t, now.Add(4*time.Minute), d.retryAt(4))
+	assert.Equal(t, now.Add(6*time.Hour), d.retryAt(11))
+	assert.True(t, d.retryAt(12).IsZero())
+}
+
+func TestSign(t *testing.T) {
+	// Checked with: printf '1893603600.{}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "t=1893603600,v1=7d9715cc19bb6c1c130e7ab08a1cb5b66f20ac9ac9a9a57db9c29756a47f10aa",
+		Sign("secret", time.Unix(1893603600, 0), []byte("{}")))
+}